@@ -2,9 +2,13 @@
 package lu
 
 import (
+	"cmp"
 	"context"
 	"runtime/pprof"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/luno/jettison/errors"
@@ -14,10 +18,69 @@ import (
 	"k8s.io/utils/clock"
 )
 
-var errProcessStillRunning = errors.New("process still running after shutdown", j.C("ERR_fa232f807b75bab6"))
+var (
+	errProcessStillRunning = errors.New("process still running after shutdown", j.C("ERR_fa232f807b75bab6"))
+	errUnknownDependency   = errors.New("process depends on an unknown process", j.C("ERR_6a0c5d9e41f7b283"))
+	errDuplicateProcesses  = errors.New("processes have the same name", j.C("ERR_d1b7e08c25f943a6"))
+	errUnnamedProcess      = errors.New("process has no name", j.C("ERR_0e6f3a87c4d2b159"))
+)
+
+// ErrShutdownInProgress is returned by LastShutdownError while Shutdown is still running
+var ErrShutdownInProgress = errors.New("app shutdown in progress", j.C("ERR_b46e0d2a9c5f7183"))
+
+// shutdownCause is used as the cause when cancelling the app context, so that processes
+// can tell why they're being stopped using context.Cause.
+// It matches context.Canceled so that it's handled the same as any other cancellation.
+type shutdownCause string
+
+func (c shutdownCause) Error() string { return string(c) }
+
+func (c shutdownCause) Unwrap() error { return context.Canceled }
+
+var (
+	// ErrSignalReceived is the cause of the app context being cancelled when Run receives a terminating OS signal
+	ErrSignalReceived error = shutdownCause("received OS signal")
+	// ErrShutdownCalled is the cause of the app context being cancelled by calling Shutdown
+	ErrShutdownCalled error = shutdownCause("app shutdown called")
+	// ErrStopCalled is the cause of the app context being cancelled by calling Stop without a cause
+	ErrStopCalled error = shutdownCause("app stop called")
+)
+
+// stopCause is used as the cause when cancelling the app context with Stop.
+// It matches both the cause given to Stop and context.Canceled, so that the
+// processes returning it are treated as having stopped cleanly.
+type stopCause struct {
+	cause error
+}
+
+func (c stopCause) Error() string { return "app stopped: " + c.cause.Error() }
+
+func (c stopCause) Unwrap() []error { return []error{c.cause, context.Canceled} }
+
+// The pprof labels set on the goroutines running hooks and processes, so that profiles can be broken down
+// by hook or by process. Goroutines started by a process inherit its label.
+const (
+	ProcessProfileLabel = "lu_process"
+	HookProfileLabel    = "lu_hook"
+)
+
+// Exit codes returned by App.Run
+const (
+	// ExitOK is returned when the app shut down cleanly
+	ExitOK = 0
+	// ExitProcessError is returned when a process or its shutdown returned an error
+	ExitProcessError = 1
+	// ExitStartupFailed is returned when the app failed to launch, e.g. a start-up hook returned an error
+	ExitStartupFailed = 2
+	// ExitShutdownTimeout is returned when processes were still running after ShutdownTimeout
+	ExitShutdownTimeout = 3
+)
 
 // App will manage the lifecycle of the service. Emitting events for each stage of the application.
 type App struct {
+	// Name of the application, it's added to the log context and to the lu_app_info metric.
+	Name string
+
 	// StartupTimeout is the deadline for running the start-up hooks and starting all the Processes
 	// Defaults to 15 seconds.
 	StartupTimeout time.Duration
@@ -27,13 +90,82 @@ type App struct {
 	// Defaults to 15 seconds.
 	ShutdownTimeout time.Duration
 
+	// ReloadTimeout is the deadline for running all the reload hooks.
+	// Defaults to 15 seconds.
+	ReloadTimeout time.Duration
+
+	// PreShutdownDelay is how long Run waits after receiving SIGTERM before stopping the Processes.
+	// This gives load balancers time to stop routing requests to the app, an AppDraining event
+	// is emitted at the start of the delay which can be used to start failing readiness checks.
+	// Defaults to no delay.
+	PreShutdownDelay time.Duration
+
+	// ShutdownProgressInterval is how often a ProcessStillRunning event is emitted for each of the
+	// Processes which haven't stopped yet during Shutdown, so that it's clear what is holding it up.
+	// Defaults to no ProcessStillRunning events.
+	ShutdownProgressInterval time.Duration
+
 	// OnEvent will be called for every lifecycle event in the app. See EventType for details.
 	OnEvent OnEvent
 
+	// EventBufferSize makes OnEvent be called from a separate goroutine so that a slow OnEvent doesn't hold up
+	// starting and stopping the Processes. Up to EventBufferSize events are queued and OnEvent is called with
+	// them in the order they were emitted, the context passed to OnEvent may be done by the time it's called.
+	// When the buffer is full, emitting an event waits for space unless DropEventsWhenFull is set.
+	// Shutdown waits up to ShutdownTimeout for the queued events to be handled.
+	// Defaults to calling OnEvent straight away.
+	EventBufferSize int
+
+	// DropEventsWhenFull drops events when the EventBufferSize buffer is full instead of waiting for OnEvent.
+	// The number of dropped events is logged after Shutdown.
+	DropEventsWhenFull bool
+
+	// Logger is used to log the lifecycle of the app.
+	// Defaults to JettisonLogger.
+	Logger Logger
+
+	// ProcessWrapper is called with the name and Run of each Process when it's started, the returned
+	// ProcessFunc is run instead. Use it to instrument every Process in the app in one place, e.g. to trace
+	// the lifetime of each Process. The context passed to the ProcessFunc has the process logging and pprof labels.
+	ProcessWrapper func(name string, next ProcessFunc) ProcessFunc
+
+	// EnableGracefulRestart makes Run start a new copy of the app on receiving SIGUSR2 and then shut down
+	// once the new copy has launched, the listeners opened with Listen, e.g. by the HTTP processes, are passed
+	// to the new copy so that no connections are refused during the restart. The app carries on running if the
+	// new copy fails to launch. SIGUSR2 isn't handled on platforms which don't have it. When UseProcessFile is set,
+	// ExclusivePIDFile and FlockPIDFile hand the process file over to the new copy, any other PIDFile has to let
+	// the new copy create the file whilst this one is still running.
+	EnableGracefulRestart bool
+
+	// Restart starts the new copy of the app when EnableGracefulRestart is set, it's given the files of the
+	// listeners to hand over. Use it to pass other sockets or state to the new copy.
+	// Defaults to ReExec.
+	Restart RestartFunc
+
 	// UseProcessFile will write a file at /tmp/lu.pid whilst the app is still running.
 	// The file will be removed after a graceful shutdown.
 	UseProcessFile bool
 
+	// PIDFile creates and removes the process file when UseProcessFile is set.
+	// Defaults to ExclusivePIDFile, see also FlockPIDFile.
+	PIDFile PIDFile
+
+	// MaxConcurrentStart limits how many Processes Launch starts at once, to smooth out the load of
+	// every Process starting up together, e.g. connecting to a database. The Processes are started in waves,
+	// in the order they were added, and each wave is started once every Process in the previous wave with
+	// SignalsReady set has called SignalReady or returned, the other Processes count as started once they're run.
+	// If that takes longer than StartupTimeout then Launch fails. Processes should come after any Process they
+	// depend on. Defaults to starting every Process at once.
+	MaxConcurrentStart int
+
+	// AllowDuplicateProcessNames stops Launch from failing when more than one Process has the same Name.
+	// Processes without a Name are never treated as duplicates.
+	AllowDuplicateProcessNames bool
+
+	// RequireProcessNames makes Launch and StartProcess fail when a Process which has a Run func has no Name.
+	// Unnamed Processes are ambiguous in logs and events, and the process package labels their metrics "unnamed".
+	RequireProcessNames bool
+
 	// OnShutdownErr is called after failing to shut down cleanly.
 	// You can use this hook to change the error or do last minute reporting.
 	// This hook is only called when using Run not when using Shutdown
@@ -41,14 +173,48 @@ type App struct {
 
 	startupHooks  []hook
 	shutdownHooks []hook
+	reloadHooks   []hook
+	finalHooks    []func(ctx context.Context, shutdownErr error)
+	reloadMu      sync.Mutex
 
+	processMu      sync.Mutex
 	processes      []Process
 	processRunning []chan struct{}
+	processReady   map[string]*readySignal
 	ctx            context.Context
 	eg             *errgroup.Group
-	cancel         context.CancelFunc
+	cancel         context.CancelCauseFunc
+
+	shutdownOnce    sync.Once
+	shutdownMu      sync.Mutex
+	shutdownRunning bool
+	shutdownErr     error
+
+	runningOnce  sync.Once
+	launchedOnce sync.Once
+	running      chan struct{}
+
+	processErrorsOnce sync.Once
+	processErrorsMu   sync.Mutex
+	processErrors     chan ProcessError
+
+	events *eventBuffer
+
+	// tiers are the contexts of the processes with a ShutdownTier, which Shutdown cancels in order
+	tiers map[uint]tier
+
+	// pidFileHandedOver is set once a graceful restart has handed the process file over to the new copy
+	pidFileHandedOver atomic.Bool
+}
+
+type tier struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
 }
 
+// processErrorsBuffer is how many errors ProcessErrors holds before dropping the oldest
+const processErrorsBuffer = 100
+
 func (a *App) setDefaults() {
 	if a.StartupTimeout == 0 {
 		a.StartupTimeout = 15 * time.Second
@@ -56,9 +222,25 @@ func (a *App) setDefaults() {
 	if a.ShutdownTimeout == 0 {
 		a.ShutdownTimeout = 15 * time.Second
 	}
+	if a.ReloadTimeout == 0 {
+		a.ReloadTimeout = 15 * time.Second
+	}
 	if a.OnEvent == nil {
 		a.OnEvent = func(context.Context, Event) {}
 	}
+	if a.Logger == nil {
+		a.Logger = JettisonLogger{}
+	}
+	if a.PIDFile == nil {
+		a.PIDFile = ExclusivePIDFile{}
+	}
+	if a.Restart == nil {
+		a.Restart = ReExec
+	}
+	if a.EventBufferSize > 0 && a.events == nil {
+		a.events = newEventBuffer(a.OnEvent, a.EventBufferSize, a.DropEventsWhenFull)
+		a.OnEvent = a.events.emit
+	}
 }
 
 // OnStartUp will call f before the app starts working
@@ -78,14 +260,109 @@ func (a *App) OnShutdown(f ProcessFunc, opts ...HookOption) {
 	sortHooks(a.shutdownHooks)
 }
 
+// OnFinal will call f at the very end of Shutdown, after the shutdown hooks and before the AppTerminated event,
+// however the shutdown went. shutdownErr is the error returned by Shutdown, e.g. context.DeadlineExceeded when
+// processes didn't stop in time. Use this for last minute reporting, e.g. flushing telemetry.
+// f gets its own ShutdownTimeout, so it runs even when Shutdown has timed out.
+func (a *App) OnFinal(f func(ctx context.Context, shutdownErr error)) {
+	a.finalHooks = append(a.finalHooks, f)
+}
+
+// OnReload will call f when the app is asked to reload, e.g. to re-read config.
+// When using Run, reload hooks are called on receiving SIGHUP, the app continues running throughout.
+func (a *App) OnReload(f ProcessFunc, opts ...HookOption) {
+	h := hook{F: f, createOrder: len(a.reloadHooks)}
+	applyHookOptions(&h, opts)
+	a.reloadHooks = append(a.reloadHooks, h)
+	sortHooks(a.reloadHooks)
+}
+
 // AddProcess adds a Process that is started in parallel after start up.
 // If any Process finish with an error, then the application will be stopped.
 func (a *App) AddProcess(processes ...Process) {
+	a.processMu.Lock()
+	defer a.processMu.Unlock()
 	a.processes = append(a.processes, processes...)
 }
 
+// StartProcess adds a Process to the app like AddProcess, but if the app has already been launched
+// then p is started straight away, calling its Start within StartupTimeout. It will be stopped along
+// with the other processes by Shutdown. It returns an error if the app is shutting down.
+func (a *App) StartProcess(p Process) error {
+	a.processMu.Lock()
+	if a.eg == nil {
+		a.processes = append(a.processes, p)
+		a.processMu.Unlock()
+		return nil
+	}
+	ctx := a.ctx
+	err := a.checkStartProcess(p)
+	a.processMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	startCtx, cancel := context.WithTimeout(ctx, a.StartupTimeout)
+	defer cancel()
+	if err := callStart(startCtx, p); err != nil {
+		return err
+	}
+
+	a.processMu.Lock()
+	// Check again as the app may have started shutting down, or another process been added, during Start
+	if err := a.checkStartProcess(p); err != nil {
+		a.processMu.Unlock()
+		a.shutdownProcesses([]Process{p})
+		return err
+	}
+	a.processes = append(a.processes, p)
+	done, begin := a.startProcess(&a.processes[len(a.processes)-1])
+	a.processRunning = append(a.processRunning, done)
+	setProcessCount(a.Name, len(a.processes))
+	a.processMu.Unlock()
+
+	begin()
+	return nil
+}
+
+// checkStartProcess returns an error if p can't be started, processMu must be held
+func (a *App) checkStartProcess(p Process) error {
+	if err := context.Cause(a.ctx); err != nil {
+		return errors.Wrap(err, "app is shutting down", j.KV("process", p.Name))
+	}
+	return a.checkProcesses(append(slices.Clone(a.processes), p))
+}
+
+// shutdownProcesses calls Shutdown for each of the processes, within ShutdownTimeout, to release anything
+// set up by their Start when they're not going to be run, any errors are logged
+func (a *App) shutdownProcesses(processes []Process) {
+	ctx, cancel := context.WithTimeout(context.Background(), a.ShutdownTimeout)
+	defer cancel()
+	for _, p := range processes {
+		if p.Shutdown == nil {
+			continue
+		}
+		if err := p.Shutdown(ctx); err != nil {
+			// NoReturnErr: Log, the process was never run
+			a.Logger.Error(ctx, errors.Wrap(err, "process shutdown", j.KV("process", p.Name)))
+		}
+	}
+}
+
+// Schedules returns the ScheduleInfo for every Process which runs on a schedule, e.g. from process.Scheduled,
+// a Process can have more than one, e.g. from process.Scheduler
+func (a *App) Schedules() []ScheduleInfo {
+	var ret []ScheduleInfo
+	for _, p := range a.GetProcesses() {
+		ret = append(ret, p.Schedules...)
+	}
+	return ret
+}
+
 // GetProcesses returns all the configured processes for the App
 func (a *App) GetProcesses() []Process {
+	a.processMu.Lock()
+	defer a.processMu.Unlock()
 	ret := make([]Process, len(a.processes))
 	copy(ret, a.processes)
 	return ret
@@ -97,35 +374,88 @@ func (a *App) startup(ctx context.Context) error {
 	// Revert the labels after running all the hooks
 	defer pprof.SetGoroutineLabels(ctx)
 
-	for idx, h := range a.startupHooks {
+	for _, group := range parallelGroups(a.startupHooks) {
 		if context.Cause(ctx) != nil {
 			return context.Cause(ctx)
 		}
-		a.OnEvent(ctx, Event{Type: PreHookStart, Name: h.Name})
-		hookCtx := ctx
-		if h.Name != "" {
-			hookCtx = log.ContextWith(hookCtx, j.MKV{"hook_idx": idx, "hook_name": h.Name})
-			hookCtx = pprof.WithLabels(hookCtx, pprof.Labels("lu_hook", h.Name))
-			pprof.SetGoroutineLabels(hookCtx)
+		if len(group) == 1 {
+			if err := a.runStartupHook(ctx, group[0]); err != nil {
+				return err
+			}
+			continue
 		}
-
-		if err := h.F(hookCtx); err != nil {
-			return errors.Wrap(err, "start hook")
+		eg, groupCtx := errgroup.WithContext(ctx)
+		for _, idx := range group {
+			eg.Go(func() error { return a.runStartupHook(groupCtx, idx) })
+		}
+		if err := eg.Wait(); err != nil {
+			return err
 		}
-		a.OnEvent(ctx, Event{Type: PostHookStart, Name: h.Name})
 	}
 	return context.Cause(ctx)
 }
 
+// runStartupHook runs the start-up hook at idx, labelling the goroutine with its name and applying its Timeout
+func (a *App) runStartupHook(ctx context.Context, idx int) error {
+	h := a.startupHooks[idx]
+	a.OnEvent(ctx, Event{Type: PreHookStart, Name: h.Name})
+	hookCtx := ctx
+	if h.Name != "" {
+		hookCtx = log.ContextWith(hookCtx, j.MKV{"hook_idx": idx, "hook_name": h.Name})
+		hookCtx = pprof.WithLabels(hookCtx, pprof.Labels(HookProfileLabel, h.Name))
+		pprof.SetGoroutineLabels(hookCtx)
+	}
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		hookCtx, cancel = context.WithTimeout(hookCtx, h.Timeout)
+		defer cancel()
+	}
+
+	hookKVs := j.MKV{"hook_idx": idx, "hook_name": h.Name}
+	if err := h.run(hookCtx); err != nil {
+		return errors.Wrap(err, "start hook", hookKVs)
+	}
+	if err := context.Cause(ctx); err != nil {
+		// The hook ignored StartupTimeout, name it as the one which used up the time
+		return errors.Wrap(err, "start hook", hookKVs)
+	}
+	a.OnEvent(ctx, Event{Type: PostHookStart, Name: h.Name})
+	return nil
+}
+
+// callStarts calls Start for each of the processes, it returns the first error
+// after calling Shutdown for the processes which have already started
+func (a *App) callStarts(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, a.StartupTimeout)
+	defer cancel()
+	processes := a.GetProcesses()
+	for i, p := range processes {
+		if err := callStart(ctx, p); err != nil {
+			a.shutdownProcesses(processes[:i])
+			return err
+		}
+	}
+	return nil
+}
+
+func callStart(ctx context.Context, p Process) error {
+	if p.Start == nil {
+		return nil
+	}
+	if err := p.Start(ctx); err != nil {
+		return errors.Wrap(err, "process start", j.KV("process", p.Name))
+	}
+	return nil
+}
+
+// runShutdownHooks runs every shutdown hook, even if earlier hooks fail or time out.
+// Each hook has its own timeout, but none of them can run past the deadline of ctx,
+// the hooks left when it has expired are still called with an expired context.
 func (a *App) runShutdownHooks(ctx context.Context) error {
 	var errs []error
 	for idx, h := range a.shutdownHooks {
-		if context.Cause(ctx) != nil {
-			return context.Cause(ctx)
-		}
 		a.OnEvent(ctx, Event{Type: PreHookStop, Name: h.Name})
-		hookCtx := log.ContextWith(ctx, j.MKV{"hook_idx": idx, "hook_name": h.Name})
-		err := h.F(hookCtx)
+		err := a.runShutdownHook(ctx, idx, h)
 		if err != nil {
 			// NoReturnErr: Collect errors
 			errs = append(errs, errors.Wrap(err, "stop hook", j.KV("hook_name", h.Name)))
@@ -135,20 +465,93 @@ func (a *App) runShutdownHooks(ctx context.Context) error {
 	// TODO(adam): Return all the errors
 	if len(errs) > 0 {
 		for i := 1; i < len(errs); i++ {
-			log.Error(ctx, errs[i])
+			a.Logger.Error(ctx, errs[i])
 		}
 		return errs[0]
 	}
 	return nil
 }
 
+// runFinalHooks calls every final hook with shutdownErr, with a new timeout as ctx may have expired
+func (a *App) runFinalHooks(ctx context.Context, shutdownErr error) {
+	if len(a.finalHooks) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), a.ShutdownTimeout)
+	defer cancel()
+	for _, f := range a.finalHooks {
+		f(ctx, shutdownErr)
+	}
+}
+
+// runShutdownHook runs h within its own timeout, which is capped at the time left before the deadline of ctx
+func (a *App) runShutdownHook(ctx context.Context, idx int, h hook) error {
+	deadline := time.Now().Add(cmp.Or(h.Timeout, a.ShutdownTimeout))
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	hookCtx, cancel := context.WithDeadline(context.WithoutCancel(ctx), deadline)
+	defer cancel()
+	hookCtx = log.ContextWith(hookCtx, j.MKV{"hook_idx": idx, "hook_name": h.Name})
+	return h.run(hookCtx)
+}
+
+// Reload runs all the reload hooks one after the other, within ReloadTimeout.
+// Every hook is run even if an earlier one fails, neither the app nor any of
+// the processes are stopped.
+func (a *App) Reload(ctx context.Context) error {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, a.ReloadTimeout)
+	defer cancel()
+
+	a.OnEvent(ctx, Event{Type: AppReloading})
+	defer a.OnEvent(ctx, Event{Type: AppReloaded})
+
+	var errs []error
+	for idx, h := range a.reloadHooks {
+		if context.Cause(ctx) != nil {
+			errs = append(errs, context.Cause(ctx))
+			break
+		}
+		hookCtx := log.ContextWith(ctx, j.MKV{"hook_idx": idx, "hook_name": h.Name})
+		if err := h.run(hookCtx); err != nil {
+			// NoReturnErr: Collect errors
+			errs = append(errs, errors.Wrap(err, "reload hook", j.KV("hook_name", h.Name)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (a *App) reload(ctx context.Context) {
+	if err := a.Reload(ctx); err != nil {
+		// NoReturnErr: Log
+		a.Logger.Error(ctx, errors.Wrap(err, "app reload"))
+	}
+}
+
 var background = context.Background()
 
 // Run will start the App, running the startup Hooks, then the Processes.
 // It will wait for any signals before shutting down first the Processes then the shutdown Hooks.
 // This behaviour can be customised by using Launch, WaitForShutdown, and Shutdown.
+// It returns one of the exit codes, e.g. ExitOK or ExitStartupFailed, depending on where it failed.
 func (a *App) Run() int {
-	ac := NewAppContext(background)
+	a.setDefaults()
+	var onReload func(context.Context)
+	if len(a.reloadHooks) > 0 {
+		onReload = a.reload
+	}
+	var beforeTerminate func(context.Context)
+	if a.PreShutdownDelay > 0 {
+		beforeTerminate = a.drain
+	}
+	var onRestart func(context.Context) error
+	if a.EnableGracefulRestart {
+		onRestart = a.restart
+	}
+	ac := newAppContext(background, a.Logger, onReload, beforeTerminate, onRestart)
 	defer ac.Stop()
 	defer a.cleanup(ac.TerminationContext)
 
@@ -156,25 +559,26 @@ func (a *App) Run() int {
 
 	if err := a.Launch(ctx); err != nil {
 		// NoReturnErr: Log
-		log.Error(ctx, errors.Wrap(err, "app launch"))
-		return 1
+		a.Logger.Error(ctx, errors.Wrap(err, "app launch"))
+		a.flushEvents()
+		return ExitStartupFailed
 	}
 	<-a.WaitForShutdown()
-	var exit int
+	exit := ExitOK
 	err := a.Shutdown()
 	if err != nil {
 		// NoReturnErr: Log
+		exit = shutdownExitCode(a, err)
 		err = handleShutdownErr(a, ac, err)
-		log.Error(ctx, errors.Wrap(err, "app shutdown"))
-		exit = 1
+		a.Logger.Error(ctx, errors.Wrap(err, "app shutdown"))
 	}
 
-	log.Info(ctx, "Waiting to terminate", j.MKV{"exit_code": exit})
+	a.Logger.Info(ctx, "Waiting to terminate", map[string]any{"exit_code": exit})
 
 	// Wait for termination in case we've only been told to quit
 	<-ac.TerminationContext.Done()
 
-	log.Info(ctx, "App terminated", j.MKV{"exit_code": exit})
+	a.Logger.Info(ctx, "App terminated", map[string]any{"exit_code": exit})
 
 	return exit
 }
@@ -183,57 +587,384 @@ func (a *App) Run() int {
 // If any hook returns an error, we will return early, processes will not be started.
 // ctx will be used for startup and also the main application context.
 // If the hooks take longer than StartupTimeout then launch will return a deadline exceeded error.
-func (a *App) Launch(ctx context.Context) error {
+// Processes with DependsOn are launched once their dependencies are ready, if that takes longer than
+// StartupTimeout then launch will shut down the app and return a deadline exceeded error.
+func (a *App) Launch(ctx context.Context) (err error) {
+	defer a.launchedOnce.Do(func() { close(a.runningChan()) })
+	defer func() { notifyLaunched(err == nil) }()
 	a.setDefaults()
 
+	if err := a.checkProcesses(a.GetProcesses()); err != nil {
+		return err
+	}
+
 	if a.UseProcessFile {
-		if err := createPIDFile(); err != nil {
+		if err := a.PIDFile.Create(); err != nil {
 			return err
 		}
 	}
 
+	if a.Name != "" {
+		ctx = log.ContextWith(ctx, j.KV("app", a.Name))
+		setAppInfo(a.Name)
+	}
+	ctx = withLogger(ctx, a.Logger)
+
 	a.OnEvent(ctx, Event{Type: AppStartup})
 
 	if err := a.startup(ctx); err != nil {
 		return err
 	}
 
+	if err := a.callStarts(ctx); err != nil {
+		return err
+	}
+
 	// Create the app context now
-	appCtx, appCancel := context.WithCancel(ctx)
+	// When a process returns an error, the errgroup uses that error as the cause
+	appCtx, appCancel := context.WithCancelCause(ctx)
 	eg, appCtx := errgroup.WithContext(appCtx)
 
+	a.processMu.Lock()
 	a.ctx = appCtx
 	a.cancel = appCancel
 	a.eg = eg
 
 	a.processRunning = make([]chan struct{}, len(a.processes))
-	for i := range a.processes {
-		p := &a.processes[i]
-		p.app = a
+	setProcessCount(a.Name, len(a.processes))
+	a.processMu.Unlock()
+
+	if err := a.startProcesses(); err != nil {
+		return a.abortLaunch(ctx, err)
+	}
+
+	if err := a.waitForDependencies(); err != nil {
+		return a.abortLaunch(ctx, err)
+	}
+
+	a.OnEvent(ctx, Event{Type: AppRunning})
+	return context.Cause(ctx)
+}
+
+// abortLaunch stops the processes which have already been started when Launch fails with err,
+// it runs the whole of Shutdown so that e.g. servers stop before Launch returns
+func (a *App) abortLaunch(ctx context.Context, err error) error {
+	a.cancel(err)
+	// The processes stopped by err return it, so don't log it twice
+	if shutdownErr := a.Shutdown(); shutdownErr != nil && !errors.Is(shutdownErr, err) {
+		// NoReturnErr: Log, err is what Launch failed with
+		a.Logger.Error(ctx, errors.Wrap(shutdownErr, "app shutdown"))
+	}
+	return err
+}
 
-		doneCh := make(chan struct{})
-		a.processRunning[i] = doneCh
-		if p.Run == nil {
-			close(doneCh)
+// MustLaunch calls Launch, for use in main when the app is run without Run.
+// If Launch fails then the error is logged, the process file is removed and MustLaunch panics.
+func (a *App) MustLaunch(ctx context.Context) {
+	err := a.Launch(ctx)
+	if err == nil {
+		return
+	}
+	err = errors.Wrap(err, "app launch")
+	a.Logger.Error(ctx, err)
+	a.cleanup(ctx)
+	panic(err)
+}
+
+// checkProcesses returns an error if the processes have missing or duplicate names or unknown dependencies
+func (a *App) checkProcesses(processes []Process) error {
+	if a.RequireProcessNames {
+		if err := checkNamed(processes); err != nil {
+			return err
+		}
+	}
+	if !a.AllowDuplicateProcessNames {
+		if err := checkUniqueNames(processes); err != nil {
+			return err
+		}
+	}
+	return checkDependencies(processes)
+}
+
+// checkNamed returns an error if any of the processes which run have no name
+func checkNamed(processes []Process) error {
+	for i, p := range processes {
+		if p.Name == "" && p.Run != nil {
+			return errors.Wrap(errUnnamedProcess, "", j.KV("index", i))
+		}
+	}
+	return nil
+}
+
+// checkUniqueNames returns an error listing any names shared by more than one of the processes
+func checkUniqueNames(processes []Process) error {
+	counts := make(map[string]int, len(processes))
+	var dups []string
+	for _, p := range processes {
+		if p.Name == "" {
 			continue
 		}
-		ctx := a.ctx
-		if p.Name != "" {
-			ctx = log.ContextWith(ctx, j.KV("process", p.Name))
-			ctx = pprof.WithLabels(ctx, pprof.Labels("lu_process", p.Name))
+		counts[p.Name]++
+		if counts[p.Name] == 2 {
+			dups = append(dups, p.Name)
+		}
+	}
+	if len(dups) > 0 {
+		return errors.Wrap(errDuplicateProcesses, "", j.KV("names", strings.Join(dups, ",")))
+	}
+	return nil
+}
+
+// checkDependencies returns an error if any of the processes depend on a process which isn't in processes
+func checkDependencies(processes []Process) error {
+	names := make(map[string]bool, len(processes))
+	for _, p := range processes {
+		names[p.Name] = true
+	}
+	for _, p := range processes {
+		for _, dep := range p.DependsOn {
+			if !names[dep] {
+				return errors.Wrap(errUnknownDependency, "", j.MKV{"process": p.Name, "dependency": dep})
+			}
 		}
+	}
+	return nil
+}
 
-		a.OnEvent(ctx, Event{Type: ProcessStart, Name: p.Name})
-		eg.Go(func() error {
-			pprof.SetGoroutineLabels(ctx)
-			defer close(doneCh)
-			defer a.OnEvent(ctx, Event{Type: ProcessEnd, Name: p.Name})
-			// NOTE: Any error returned by any of the processes will cause the entire App to terminate
-			return p.Run(ctx)
+// readySignal is closed when a process is ready. It's shared by every process with the same name,
+// so it's closed by the first of them to call SignalReady.
+type readySignal struct {
+	ch   chan struct{}
+	once sync.Once
+}
+
+func (r *readySignal) signal() {
+	r.once.Do(func() { close(r.ch) })
+}
+
+// readySignal returns the signal for when the named process is ready, processMu must be held
+func (a *App) readySignal(name string) *readySignal {
+	if a.processReady == nil {
+		a.processReady = make(map[string]*readySignal)
+	}
+	r, ok := a.processReady[name]
+	if !ok {
+		r = &readySignal{ch: make(chan struct{})}
+		a.processReady[name] = r
+	}
+	return r
+}
+
+// readyChan returns the channel which is closed when the named process is ready, processMu must be held
+func (a *App) readyChan(name string) chan struct{} {
+	return a.readySignal(name).ch
+}
+
+// startProcesses starts the processes in waves of at most MaxConcurrentStart, waiting up to StartupTimeout
+// for each process in a wave with SignalsReady to call SignalReady or to return before starting the next wave
+func (a *App) startProcesses() error {
+	a.processMu.Lock()
+	count := len(a.processRunning)
+	a.processMu.Unlock()
+
+	size := a.MaxConcurrentStart
+	if size <= 0 {
+		size = count
+	}
+	ctx, cancel := context.WithTimeout(a.ctx, a.StartupTimeout)
+	defer cancel()
+	for start := 0; start < count; start += size {
+		end := min(start+size, count)
+		started, err := a.startWave(start, end)
+		if err != nil {
+			return err
+		}
+		if end == count {
+			break
+		}
+		for _, w := range started {
+			if !w.waitReady {
+				continue
+			}
+			select {
+			case <-w.ready:
+			case <-w.done:
+			case <-ctx.Done():
+				return errors.Wrap(context.Cause(ctx), "process not ready", j.KV("process", w.name))
+			}
+		}
+	}
+	return nil
+}
+
+type startedProcess struct {
+	name      string
+	waitReady bool
+	ready     chan struct{}
+	done      chan struct{}
+}
+
+// startWave starts the processes from index start to end, unless the app is already shutting down
+func (a *App) startWave(start, end int) ([]startedProcess, error) {
+	a.processMu.Lock()
+	if err := context.Cause(a.ctx); err != nil {
+		a.processMu.Unlock()
+		return nil, errors.Wrap(err, "app is shutting down")
+	}
+	started := make([]startedProcess, 0, end-start)
+	begins := make([]func(), 0, end-start)
+	for i := start; i < end; i++ {
+		p := &a.processes[i]
+		done, begin := a.startProcess(p)
+		a.processRunning[i] = done
+		begins = append(begins, begin)
+		started = append(started, startedProcess{
+			name:      p.Name,
+			waitReady: p.SignalsReady,
+			ready:     a.readyChan(p.Name),
+			done:      done,
 		})
 	}
-	a.OnEvent(ctx, Event{Type: AppRunning})
-	return context.Cause(ctx)
+	a.processMu.Unlock()
+
+	for _, begin := range begins {
+		begin()
+	}
+	return started, nil
+}
+
+// waitForDependencies waits up to StartupTimeout for the dependencies of all the processes to be ready
+func (a *App) waitForDependencies() error {
+	ctx, cancel := context.WithTimeout(a.ctx, a.StartupTimeout)
+	defer cancel()
+	for _, p := range a.GetProcesses() {
+		for _, dep := range p.DependsOn {
+			a.processMu.Lock()
+			ready := a.readyChan(dep)
+			a.processMu.Unlock()
+			if _, err := WaitFor(ctx, ready); err != nil {
+				return errors.Wrap(err, "process dependency not ready", j.MKV{"process": p.Name, "dependency": dep})
+			}
+		}
+	}
+	return nil
+}
+
+// startProcess runs p in the app's errgroup, processMu must be held. The returned channel is closed once p
+// has finished. p doesn't run until the returned func is called, which emits ProcessStart and must be called
+// after releasing processMu, so that OnEvent can call the App.
+func (a *App) startProcess(p *Process) (chan struct{}, func()) {
+	p.app = a
+
+	doneCh := make(chan struct{})
+	if p.Run == nil {
+		close(doneCh)
+		return doneCh, func() {}
+	}
+	ctx := a.ctx
+	if p.ShutdownTier > 0 {
+		ctx = a.tierContext(p.ShutdownTier)
+	}
+	if p.Name != "" {
+		ctx = log.ContextWith(ctx, j.KV("process", p.Name))
+		ctx = pprof.WithLabels(ctx, pprof.Labels(ProcessProfileLabel, p.Name))
+	}
+	if len(p.Tags) > 0 {
+		ctx = withProcessTags(ctx, p.Tags)
+	}
+	ctx = withSignalReady(ctx, a.readySignal(p.Name).signal)
+	ctx = withEmitEvent(ctx, func(ctx context.Context, t EventType) {
+		a.OnEvent(ctx, Event{Type: t, Name: p.Name})
+	})
+	ctx = withReportError(ctx, func(err error, errCount uint) {
+		a.reportProcessError(ProcessError{Name: p.Name, Err: err, ErrCount: errCount})
+	})
+	deps := make([]chan struct{}, 0, len(p.DependsOn))
+	for _, dep := range p.DependsOn {
+		deps = append(deps, a.readyChan(dep))
+	}
+
+	registerMetrics()
+	running := processesRunning.WithLabelValues(a.Name)
+	running.Inc()
+
+	begin := make(chan struct{})
+	a.eg.Go(func() error {
+		pprof.SetGoroutineLabels(ctx)
+		defer close(doneCh)
+		defer running.Dec()
+		<-begin
+		if len(deps) > 0 {
+			for _, dep := range deps {
+				if _, err := WaitFor(ctx, dep); err != nil {
+					return err
+				}
+			}
+			a.OnEvent(ctx, Event{Type: ProcessStart, Name: p.Name})
+		}
+		defer a.OnEvent(ctx, Event{Type: ProcessEnd, Name: p.Name})
+		run := p.Run
+		if a.ProcessWrapper != nil {
+			run = a.ProcessWrapper(p.Name, run)
+		}
+		// NOTE: Any error returned by any of the essential processes will cause the entire App to terminate
+		err := run(ctx)
+		if err != nil && p.NonEssential && ctx.Err() == nil {
+			// NoReturnErr: Carry on without the process
+			a.Logger.Error(ctx, errors.Wrap(err, "non-essential process ended"))
+			return nil
+		}
+		return err
+	})
+	return doneCh, func() {
+		if len(deps) == 0 {
+			a.OnEvent(ctx, Event{Type: ProcessStart, Name: p.Name})
+		}
+		close(begin)
+	}
+}
+
+// WaitForRunning returns a channel which is closed when Launch returns, after the AppRunning event
+// or when the app fails to start. It can be called before Launch, e.g. from another goroutine.
+// Use the error from Launch, or the channel from WaitForShutdown, to tell whether the app is running.
+func (a *App) WaitForRunning() <-chan struct{} {
+	return a.runningChan()
+}
+
+func (a *App) runningChan() chan struct{} {
+	a.runningOnce.Do(func() { a.running = make(chan struct{}) })
+	return a.running
+}
+
+// ProcessErrors returns a channel which receives the errors that Processes report with ReportProcessError,
+// e.g. every error which the loops in the process package log, so that they can be forwarded elsewhere.
+// The channel holds the latest 100 errors, older errors are dropped when it isn't read quickly enough.
+// The same channel is returned every time, and it's never closed.
+func (a *App) ProcessErrors() <-chan ProcessError {
+	return a.processErrorsChan()
+}
+
+func (a *App) processErrorsChan() chan ProcessError {
+	a.processErrorsOnce.Do(func() { a.processErrors = make(chan ProcessError, processErrorsBuffer) })
+	return a.processErrors
+}
+
+// reportProcessError sends pe to ProcessErrors, dropping the oldest error if it's full
+func (a *App) reportProcessError(pe ProcessError) {
+	ch := a.processErrorsChan()
+	a.processErrorsMu.Lock()
+	defer a.processErrorsMu.Unlock()
+	for {
+		select {
+		case ch <- pe:
+			return
+		default:
+		}
+		select {
+		case <-ch:
+		default:
+		}
+	}
 }
 
 // WaitForShutdown returns a channel that waits for the application to be cancelled.
@@ -243,27 +974,85 @@ func (a *App) WaitForShutdown() <-chan struct{} {
 	return a.ctx.Done()
 }
 
+// Stop asks the running App to shut down, cancelling the app context with cause, e.g. when a process
+// has finished all the work the app needs to do. It's an intentional stop rather than a failure, so the
+// app exits with ExitOK. context.Cause of the processes' context matches both cause and context.Canceled.
+// The channel from WaitForShutdown is closed, so Run goes on to call Shutdown, otherwise the caller of
+// Launch should call Shutdown after waiting for WaitForShutdown. Stop does nothing before Launch is called.
+func (a *App) Stop(cause error) {
+	a.processMu.Lock()
+	defer a.processMu.Unlock()
+	if a.cancel == nil {
+		return
+	}
+	a.cancel(stopCause{cause: cmp.Or(cause, ErrStopCalled)})
+}
+
 // Shutdown will synchronously stop all the resources running in the app.
+// It's safe to call more than once, only the first call stops the app and
+// later calls wait for it to finish and then return the same result.
 func (a *App) Shutdown() error {
+	a.shutdownOnce.Do(func() {
+		a.shutdownMu.Lock()
+		a.shutdownRunning = true
+		a.shutdownMu.Unlock()
+
+		err := a.shutdown()
+		a.flushEvents()
+
+		a.shutdownMu.Lock()
+		defer a.shutdownMu.Unlock()
+		a.shutdownRunning = false
+		a.shutdownErr = err
+	})
+	a.shutdownMu.Lock()
+	defer a.shutdownMu.Unlock()
+	return a.shutdownErr
+}
+
+// LastShutdownError returns the error from Shutdown, which is also
+// called by Run. It will be nil when the app shut down cleanly, or when Shutdown hasn't been called.
+// If any process took longer than ShutdownTimeout to stop the error will be context.DeadlineExceeded,
+// otherwise it's the error returned by one of the processes.
+// It returns ErrShutdownInProgress while Shutdown is still running.
+// It's safe to call from any goroutine.
+func (a *App) LastShutdownError() error {
+	a.shutdownMu.Lock()
+	defer a.shutdownMu.Unlock()
+	if a.shutdownRunning {
+		return ErrShutdownInProgress
+	}
+	return a.shutdownErr
+}
+
+func (a *App) shutdown() (err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), a.ShutdownTimeout)
 	defer cancel()
 
 	a.OnEvent(ctx, Event{Type: AppTerminating})
 	defer a.OnEvent(ctx, Event{Type: AppTerminated})
+	defer func() { a.runFinalHooks(ctx, err) }()
+
+	if a.ShutdownProgressInterval > 0 {
+		progressCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		go a.reportProgress(progressCtx)
+	}
 
 	defer func() {
 		err := a.runShutdownHooks(ctx)
 		if err != nil {
 			// NoReturnErr: Log
-			log.Error(ctx, errors.Wrap(err, ""))
+			a.Logger.Error(ctx, errors.Wrap(err, ""))
 		}
 	}()
 
 	shutErrs := make(chan error)
 	var shutCount int
+	processes := a.GetProcesses()
 	// Shutdown processes which need shutting down explicitly first
-	for i := range a.processes {
-		p := &a.processes[i]
+	for i := range processes {
+		p := &processes[i]
 		if p.Shutdown != nil {
 			shutCount++
 			go func() {
@@ -288,8 +1077,16 @@ func (a *App) Shutdown() error {
 		}
 	}
 
-	// Cancel the context for all the other processes
-	a.cancel()
+	// Cancel the context for all the other processes,
+	// holding the lock so that StartProcess can't start any more after this
+	a.processMu.Lock()
+	a.cancel(ErrShutdownCalled)
+	a.processMu.Unlock()
+	defer a.cancelTiers()
+
+	if err := a.stopTiers(ctx); err != nil {
+		return err
+	}
 
 	groupErr, err := WaitFor(ctx, ErrGroupWait(a.eg))
 	if err != nil {
@@ -300,9 +1097,18 @@ func (a *App) Shutdown() error {
 		errs = append(errs, groupErr)
 	}
 
+	for _, p := range processes {
+		if p.InFlight == nil {
+			continue
+		}
+		if _, err := WaitFor(ctx, SyncGroupWait(p.InFlight)); err != nil {
+			return errors.Wrap(err, "waiting for in-flight work", j.KV("process", p.Name))
+		}
+	}
+
 	if len(errs) > 0 {
 		for i := 1; i < len(errs); i++ {
-			log.Error(ctx, errs[i])
+			a.Logger.Error(ctx, errs[i])
 		}
 		return errs[0]
 	}
@@ -310,7 +1116,82 @@ func (a *App) Shutdown() error {
 	return nil
 }
 
+// tierContext returns the context for the processes in shutdown tier t, processMu must be held.
+// It isn't cancelled along with the app context, only by Shutdown once the lower tiers have stopped.
+func (a *App) tierContext(t uint) context.Context {
+	if a.tiers == nil {
+		a.tiers = make(map[uint]tier)
+	}
+	tr, ok := a.tiers[t]
+	if !ok {
+		tr.ctx, tr.cancel = context.WithCancelCause(context.WithoutCancel(a.ctx))
+		a.tiers[t] = tr
+	}
+	return tr.ctx
+}
+
+// stopTiers cancels the processes with a ShutdownTier one tier at a time,
+// waiting for every process in the lower tiers to finish before cancelling the next tier
+func (a *App) stopTiers(ctx context.Context) error {
+	a.processMu.Lock()
+	processes := slices.Clone(a.processes)
+	running := slices.Clone(a.processRunning)
+	tiers := make([]uint, 0, len(a.tiers))
+	for t := range a.tiers {
+		tiers = append(tiers, t)
+	}
+	a.processMu.Unlock()
+	slices.Sort(tiers)
+
+	for _, t := range tiers {
+		for i, p := range processes {
+			if p.ShutdownTier >= t || running[i] == nil {
+				continue
+			}
+			if _, err := WaitFor(ctx, running[i]); err != nil {
+				return errors.Wrap(err, "waiting for lower shutdown tier", j.MKV{"process": p.Name, "tier": t})
+			}
+		}
+		a.processMu.Lock()
+		a.tiers[t].cancel(context.Cause(a.ctx))
+		a.processMu.Unlock()
+	}
+	return nil
+}
+
+// cancelTiers cancels the processes in every shutdown tier
+func (a *App) cancelTiers() {
+	a.processMu.Lock()
+	defer a.processMu.Unlock()
+	for _, tr := range a.tiers {
+		tr.cancel(context.Cause(a.ctx))
+	}
+}
+
+// Quiesce stops all the Processes which support it from starting any new work, e.g. new iterations of
+// a process.Loop or new runs of a process.Scheduled, and waits for any work in progress to finish.
+// The app keeps running, Shutdown should still be called to stop it.
+func (a *App) Quiesce(ctx context.Context) error {
+	var eg errgroup.Group
+	processes := a.GetProcesses()
+	for i := range processes {
+		p := &processes[i]
+		if p.Quiesce == nil {
+			continue
+		}
+		eg.Go(func() error {
+			if err := p.Quiesce(ctx); err != nil {
+				return errors.Wrap(err, "", j.KV("process", p.Name))
+			}
+			return nil
+		})
+	}
+	return eg.Wait()
+}
+
 func (a *App) RunningProcesses() []string {
+	a.processMu.Lock()
+	defer a.processMu.Unlock()
 	var ret []string
 	for idx, p := range a.processes {
 		select {
@@ -322,8 +1203,54 @@ func (a *App) RunningProcesses() []string {
 	return ret
 }
 
+// reportProgress emits a ProcessStillRunning event for each running process every ShutdownProgressInterval until ctx is done
+func (a *App) reportProgress(ctx context.Context) {
+	ti := time.NewTicker(a.ShutdownProgressInterval)
+	defer ti.Stop()
+	for {
+		if _, err := WaitFor(ctx, ti.C); err != nil {
+			// NoReturnErr: Shutdown has finished
+			return
+		}
+		for _, name := range a.RunningProcesses() {
+			a.OnEvent(ctx, Event{Type: ProcessStillRunning, Name: name})
+		}
+	}
+}
+
+// flushEvents waits for OnEvent to handle the events queued when EventBufferSize is set
+func (a *App) flushEvents() {
+	if a.events == nil {
+		return
+	}
+	ctx := context.Background()
+	dropped, err := a.events.flush(a.ShutdownTimeout)
+	if err != nil {
+		// NoReturnErr: We're stopping anyway, the remaining events are handled in the background
+		a.Logger.Error(ctx, err)
+	}
+	if dropped > 0 {
+		a.Logger.Info(ctx, "Dropped events, OnEvent was too slow", map[string]any{"dropped": dropped})
+	}
+}
+
+// drain waits for PreShutdownDelay before the app is stopped
+func (a *App) drain(ctx context.Context) {
+	a.OnEvent(ctx, Event{Type: AppDraining})
+	a.Logger.Info(ctx, "Waiting before shutting down", map[string]any{"delay": a.PreShutdownDelay.String()})
+	// NoReturnErr: Only cancelled when we need to stop straight away
+	_ = Wait(ctx, clock.RealClock{}, a.PreShutdownDelay)
+}
+
 func (a *App) cleanup(ctx context.Context) {
-	removePIDFile(ctx)
+	if a.pidFileHandedOver.Load() {
+		// The new copy of the app removes it
+		return
+	}
+	if err := a.PIDFile.Remove(); err != nil {
+		// NoReturnErr: We'll terminate after this so just log
+		a.Logger.Error(ctx, err)
+	}
 }
 
 // Wait is a cancellable wait, it will return either when
@@ -371,6 +1298,15 @@ func SyncGroupWait(wg *sync.WaitGroup) <-chan struct{} {
 	return ch
 }
 
+// shutdownExitCode returns ExitShutdownTimeout if err is because processes are still running
+// after ShutdownTimeout, otherwise ExitProcessError.
+func shutdownExitCode(a *App, err error) int {
+	if errors.Is(err, context.DeadlineExceeded) && len(a.RunningProcesses()) > 0 {
+		return ExitShutdownTimeout
+	}
+	return ExitProcessError
+}
+
 func handleShutdownErr(a *App, ac AppContext, err error) error {
 	if !errors.Is(err, context.DeadlineExceeded) {
 		return err
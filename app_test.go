@@ -1,14 +1,19 @@
 package lu_test
 
 import (
+	"bytes"
 	"context"
 	"io"
 	"os"
+	"runtime/pprof"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/luno/jettison/jtest"
 	"github.com/luno/jettison/log"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -98,6 +103,90 @@ func TestLifecycle(t *testing.T) {
 	)
 }
 
+func TestReload(t *testing.T) {
+	ev := make(test.EventLog, 100)
+	a := &lu.App{OnEvent: ev.Append}
+
+	var calls []string
+	a.OnReload(func(ctx context.Context) error {
+		calls = append(calls, "second")
+		return nil
+	}, lu.WithHookPriority(lu.HookPriorityLast))
+	a.OnReload(func(ctx context.Context) error {
+		calls = append(calls, "first")
+		return io.ErrUnexpectedEOF
+	})
+	a.AddProcess(process.NoOp())
+
+	jtest.RequireNil(t, a.Launch(context.Background()))
+
+	err := a.Reload(context.Background())
+	jtest.Assert(t, io.ErrUnexpectedEOF, err)
+	assert.Equal(t, []string{"first", "second"}, calls)
+
+	select {
+	case <-a.WaitForShutdown():
+		assert.Fail(t, "app should still be running")
+	default:
+	}
+
+	jtest.RequireNil(t, a.Shutdown())
+
+	close(ev)
+	test.AssertEvents(t, ev,
+		test.Event{Type: lu.AppStartup},
+		test.Event{Type: lu.ProcessStart, Name: "noop"},
+		test.Event{Type: lu.AppRunning},
+		test.Event{Type: lu.AppReloading},
+		test.Event{Type: lu.AppReloaded},
+		test.Event{Type: lu.AppTerminating},
+		test.Event{Type: lu.ProcessEnd, Name: "noop"},
+		test.Event{Type: lu.AppTerminated},
+	)
+}
+
+func TestProcessTags(t *testing.T) {
+	type tagged struct {
+		Type lu.EventType
+		Name string
+		Tags map[string]string
+	}
+	events := make(chan tagged, 100)
+	a := lu.App{OnEvent: func(ctx context.Context, e lu.Event) {
+		if e.Type == lu.ProcessStart || e.Type == lu.ProcessEnd {
+			events <- tagged{Type: e.Type, Name: e.Name, Tags: lu.ProcessTags(ctx)}
+		}
+	}}
+
+	critical := map[string]string{"severity": "critical"}
+	a.AddProcess(
+		lu.Process{Name: "critical", Tags: critical, Run: func(ctx context.Context) error {
+			assert.Equal(t, critical, lu.ProcessTags(ctx))
+			<-ctx.Done()
+			return context.Cause(ctx)
+		}},
+		lu.Process{Name: "untagged", Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return context.Cause(ctx)
+		}},
+	)
+
+	jtest.RequireNil(t, a.Launch(context.Background()))
+	jtest.RequireNil(t, a.Shutdown())
+	close(events)
+
+	var got []tagged
+	for e := range events {
+		got = append(got, e)
+	}
+	assert.ElementsMatch(t, []tagged{
+		{Type: lu.ProcessStart, Name: "critical", Tags: critical},
+		{Type: lu.ProcessStart, Name: "untagged"},
+		{Type: lu.ProcessEnd, Name: "critical", Tags: critical},
+		{Type: lu.ProcessEnd, Name: "untagged"},
+	}, got)
+}
+
 func TestShutdownWithParentContext(t *testing.T) {
 	var a lu.App
 	a.AddProcess(lu.Process{
@@ -241,6 +330,1120 @@ func TestRunningProcesses(t *testing.T) {
 	}
 }
 
+func TestShutdownProgress(t *testing.T) {
+	var mu sync.Mutex
+	var stillRunning []string
+	a := lu.App{
+		ShutdownTimeout:          time.Second,
+		ShutdownProgressInterval: 10 * time.Millisecond,
+		OnEvent: func(ctx context.Context, e lu.Event) {
+			if e.Type == lu.ProcessStillRunning {
+				mu.Lock()
+				defer mu.Unlock()
+				stillRunning = append(stillRunning, e.Name)
+			}
+		},
+	}
+	a.AddProcess(
+		lu.Process{Name: "quick", Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}},
+		lu.Process{Name: "slow", Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			time.Sleep(100 * time.Millisecond)
+			return nil
+		}},
+	)
+
+	jtest.RequireNil(t, a.Launch(context.Background()))
+	jtest.RequireNil(t, a.Shutdown())
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.NotEmpty(t, stillRunning)
+	for _, name := range stillRunning {
+		assert.Equal(t, "slow", name)
+	}
+}
+
+func TestEventBuffer(t *testing.T) {
+	ev := make(test.EventLog, 100)
+	release := make(chan struct{})
+	a := lu.App{
+		EventBufferSize: 100,
+		OnEvent: func(ctx context.Context, e lu.Event) {
+			<-release
+			ev.Append(ctx, e)
+		},
+	}
+	a.AddProcess(lu.Process{Name: "one", Run: func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}})
+
+	// Launch doesn't wait for OnEvent
+	jtest.RequireNil(t, a.Launch(context.Background()))
+	assert.Empty(t, ev)
+
+	close(release)
+	jtest.RequireNil(t, a.Shutdown())
+
+	close(ev)
+	test.AssertEvents(t, ev,
+		test.Event{Type: lu.AppStartup},
+		test.Event{Type: lu.ProcessStart, Name: "one"},
+		test.Event{Type: lu.AppRunning},
+		test.Event{Type: lu.AppTerminating},
+		test.Event{Type: lu.ProcessEnd, Name: "one"},
+		test.Event{Type: lu.AppTerminated},
+	)
+}
+
+func TestEventBufferDropsWhenFull(t *testing.T) {
+	ev := make(test.EventLog, 100)
+	release := make(chan struct{})
+	var l test.Logger
+	a := lu.App{
+		Logger:             &l,
+		EventBufferSize:    1,
+		DropEventsWhenFull: true,
+		OnEvent: func(ctx context.Context, e lu.Event) {
+			<-release
+			ev.Append(ctx, e)
+		},
+	}
+	for _, name := range []string{"one", "two", "three"} {
+		a.AddProcess(lu.Process{Name: name, Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}})
+	}
+
+	jtest.RequireNil(t, a.Launch(context.Background()))
+	close(release)
+	jtest.RequireNil(t, a.Shutdown())
+
+	close(ev)
+	var got []lu.Event
+	for e := range ev {
+		got = append(got, e)
+	}
+	// OnEvent is blocked during Launch, so only the first events fit in the buffer
+	assert.Less(t, len(got), 10)
+	assert.Equal(t, lu.AppStartup, got[0].Type)
+	assert.Contains(t, l.Infos(), "Dropped events, OnEvent was too slow")
+}
+
+func TestShutdownTiers(t *testing.T) {
+	var mu sync.Mutex
+	var stopped []string
+	record := func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		stopped = append(stopped, name)
+	}
+	poolCause := make(chan error, 1)
+	var a lu.App
+	a.AddProcess(
+		lu.Process{Name: "pool", ShutdownTier: 1, Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			poolCause <- context.Cause(ctx)
+			record("pool")
+			return nil
+		}},
+		lu.Process{Name: "consumer", Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			time.Sleep(20 * time.Millisecond)
+			record("consumer")
+			return nil
+		}},
+	)
+	jtest.RequireNil(t, a.Launch(context.Background()))
+
+	// The pool keeps running after the app is stopped until Shutdown is called
+	a.Stop(nil)
+	<-a.WaitForShutdown()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, []string{"pool"}, a.RunningProcesses())
+
+	jtest.RequireNil(t, a.Shutdown())
+	assert.Equal(t, []string{"consumer", "pool"}, stopped)
+	jtest.Assert(t, lu.ErrStopCalled, <-poolCause)
+}
+
+func TestShutdownWaitsForInFlight(t *testing.T) {
+	testCases := []struct {
+		name    string
+		work    time.Duration
+		timeout time.Duration
+		expErr  error
+	}{
+		{name: "work finishes", work: 50 * time.Millisecond, timeout: time.Second},
+		{name: "work times out", work: time.Second, timeout: 50 * time.Millisecond, expErr: context.DeadlineExceeded},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			var finished atomic.Bool
+			a := lu.App{ShutdownTimeout: tc.timeout}
+			a.AddProcess(lu.Process{
+				Name:     "worker",
+				InFlight: &wg,
+				Run: func(ctx context.Context) error {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						time.Sleep(tc.work)
+						finished.Store(true)
+					}()
+					<-ctx.Done()
+					return nil
+				},
+			})
+
+			jtest.RequireNil(t, a.Launch(context.Background()))
+			err := a.Shutdown()
+			jtest.Require(t, tc.expErr, err)
+			assert.Equal(t, tc.expErr == nil, finished.Load())
+		})
+	}
+}
+
+func TestProcessWrapper(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	record := func(s string) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, s)
+	}
+	a := lu.App{
+		ProcessWrapper: func(name string, next lu.ProcessFunc) lu.ProcessFunc {
+			return func(ctx context.Context) error {
+				record("start " + name)
+				err := next(ctx)
+				record("end " + name)
+				return err
+			}
+		},
+	}
+	a.AddProcess(lu.Process{
+		Name: "worker",
+		Run: func(ctx context.Context) error {
+			record("run worker")
+			<-ctx.Done()
+			return nil
+		},
+	})
+
+	jtest.RequireNil(t, a.Launch(context.Background()))
+	jtest.RequireNil(t, a.Shutdown())
+	assert.Equal(t, []string{"start worker", "run worker", "end worker"}, calls)
+}
+
+func TestNonEssentialProcess(t *testing.T) {
+	var l test.Logger
+	a := lu.App{Logger: &l}
+	a.AddProcess(
+		lu.Process{
+			Name:         "exporter",
+			NonEssential: true,
+			Run: func(ctx context.Context) error {
+				return io.ErrUnexpectedEOF
+			},
+		},
+		lu.Process{
+			Name: "worker",
+			Run: func(ctx context.Context) error {
+				<-ctx.Done()
+				return nil
+			},
+		},
+	)
+
+	jtest.RequireNil(t, a.Launch(context.Background()))
+	assert.Eventually(t, func() bool {
+		return len(a.RunningProcesses()) == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"worker"}, a.RunningProcesses())
+	select {
+	case <-a.WaitForShutdown():
+		t.Fatal("app shouldn't shut down when a non-essential process fails")
+	default:
+	}
+
+	jtest.RequireNil(t, a.Shutdown())
+	require.Len(t, l.Errors(), 1)
+	jtest.Assert(t, io.ErrUnexpectedEOF, l.Errors()[0])
+}
+
+func TestProcessErrors(t *testing.T) {
+	reported := make(chan struct{})
+	var a lu.App
+	a.AddProcess(lu.Process{
+		Name: "flaky",
+		Run: func(ctx context.Context) error {
+			for i := uint(1); i <= 105; i++ {
+				lu.ReportProcessError(ctx, io.ErrUnexpectedEOF, i)
+			}
+			close(reported)
+			<-ctx.Done()
+			return nil
+		},
+	})
+	// Does nothing outside of an App
+	lu.ReportProcessError(context.Background(), io.EOF, 1)
+
+	jtest.RequireNil(t, a.Launch(context.Background()))
+	<-reported
+	jtest.RequireNil(t, a.Shutdown())
+
+	errs := a.ProcessErrors()
+	require.Len(t, errs, 100)
+	first := <-errs
+	assert.Equal(t, "flaky", first.Name)
+	jtest.Assert(t, io.ErrUnexpectedEOF, first.Err)
+	// The oldest errors are dropped
+	assert.Equal(t, uint(6), first.ErrCount)
+}
+
+func TestWaitForRunning(t *testing.T) {
+	testCases := []struct {
+		name   string
+		hook   lu.ProcessFunc
+		expErr error
+	}{
+		{name: "running", hook: func(context.Context) error { return nil }},
+		{name: "fails to start", hook: func(context.Context) error { return io.ErrUnexpectedEOF }, expErr: io.ErrUnexpectedEOF},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ev := make(test.EventLog, 100)
+			a := lu.App{OnEvent: ev.Append}
+			a.OnStartUp(tc.hook)
+			a.AddProcess(lu.Process{Run: func(ctx context.Context) error {
+				<-ctx.Done()
+				return nil
+			}})
+			running := a.WaitForRunning()
+
+			launched := make(chan error, 1)
+			go func() { launched <- a.Launch(context.Background()) }()
+
+			<-running
+			jtest.Require(t, tc.expErr, <-launched)
+			if tc.expErr == nil {
+				var last lu.Event
+				for len(ev) > 0 {
+					last = <-ev
+				}
+				assert.Equal(t, lu.AppRunning, last.Type)
+				jtest.RequireNil(t, a.Shutdown())
+			}
+		})
+	}
+}
+
+func TestStartProcess(t *testing.T) {
+	ev := make(test.EventLog, 100)
+	a := lu.App{OnEvent: ev.Append}
+	a.AddProcess(process.NoOp())
+	jtest.RequireNil(t, a.Launch(context.Background()))
+
+	started := make(chan struct{})
+	err := a.StartProcess(lu.Process{Name: "plugin", Run: func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return nil
+	}})
+	jtest.RequireNil(t, err)
+
+	<-started
+	assert.Equal(t, []string{"noop", "plugin"}, a.RunningProcesses())
+
+	jtest.RequireNil(t, a.Shutdown())
+	assert.Empty(t, a.RunningProcesses())
+
+	err = a.StartProcess(lu.Process{Name: "late", Run: func(ctx context.Context) error { return nil }})
+	jtest.Assert(t, context.Canceled, err)
+
+	test.AssertEvents(t, ev,
+		test.Event{Type: lu.AppStartup},
+		test.Event{Type: lu.ProcessStart, Name: "noop"},
+		test.Event{Type: lu.AppRunning},
+		test.Event{Type: lu.ProcessStart, Name: "plugin"},
+		test.Event{Type: lu.AppTerminating},
+		test.AnyOrder(
+			test.Event{Type: lu.ProcessEnd, Name: "noop"},
+			test.Event{Type: lu.ProcessEnd, Name: "plugin"},
+		),
+		test.Event{Type: lu.AppTerminated},
+	)
+}
+
+func TestOnEventCallsApp(t *testing.T) {
+	var a lu.App
+	running := make(chan []string, 2)
+	a.OnEvent = func(ctx context.Context, e lu.Event) {
+		if e.Type == lu.ProcessStart {
+			running <- a.RunningProcesses()
+			_ = a.GetProcesses()
+		}
+	}
+	a.AddProcess(process.NoOp())
+
+	launched := make(chan error, 1)
+	go func() { launched <- a.Launch(context.Background()) }()
+	select {
+	case err := <-launched:
+		jtest.RequireNil(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("launch deadlocked")
+	}
+	jtest.RequireNil(t, a.StartProcess(lu.Process{Name: "plugin", Run: func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}}))
+	assert.Equal(t, []string{"noop"}, <-running)
+	assert.Equal(t, []string{"noop", "plugin"}, <-running)
+	jtest.RequireNil(t, a.Shutdown())
+}
+
+func TestStartProcessStartupTimeout(t *testing.T) {
+	a := lu.App{StartupTimeout: 10 * time.Millisecond}
+	jtest.RequireNil(t, a.Launch(context.Background()))
+	t.Cleanup(func() { jtest.RequireNil(t, a.Shutdown()) })
+
+	var shutdown bool
+	err := a.StartProcess(lu.Process{
+		Name: "slow",
+		Start: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		Shutdown: func(ctx context.Context) error {
+			shutdown = true
+			return nil
+		},
+		Run: func(ctx context.Context) error { return nil },
+	})
+	jtest.Assert(t, context.DeadlineExceeded, err)
+	assert.Empty(t, a.GetProcesses())
+	assert.False(t, shutdown)
+}
+
+func TestShutdownCause(t *testing.T) {
+	testCases := []struct {
+		name     string
+		failing  bool
+		expCause error
+	}{
+		{name: "shutdown called", expCause: lu.ErrShutdownCalled},
+		{name: "peer process failed", failing: true, expCause: io.ErrUnexpectedEOF},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			causes := make(chan error, 1)
+			var a lu.App
+			a.AddProcess(lu.Process{Run: func(ctx context.Context) error {
+				<-ctx.Done()
+				causes <- context.Cause(ctx)
+				return nil
+			}})
+			if tc.failing {
+				a.AddProcess(lu.Process{Run: func(ctx context.Context) error {
+					return io.ErrUnexpectedEOF
+				}})
+			}
+			jtest.RequireNil(t, a.Launch(context.Background()))
+			if tc.failing {
+				<-a.WaitForShutdown()
+			}
+			_ = a.Shutdown()
+			jtest.Assert(t, tc.expCause, <-causes)
+		})
+	}
+}
+
+func TestProcessDependencies(t *testing.T) {
+	warm := make(chan struct{})
+	apiStarted := make(chan struct{})
+
+	var a lu.App
+	a.AddProcess(
+		lu.Process{Name: "api", DependsOn: []string{"warmer"}, Run: func(ctx context.Context) error {
+			close(apiStarted)
+			<-ctx.Done()
+			return nil
+		}},
+		lu.Process{Name: "warmer", Run: func(ctx context.Context) error {
+			<-warm
+			lu.SignalReady(ctx)
+			<-ctx.Done()
+			return nil
+		}},
+	)
+
+	launched := make(chan error)
+	go func() { launched <- a.Launch(context.Background()) }()
+
+	select {
+	case <-apiStarted:
+		t.Fatal("api started before warmer was ready")
+	case <-launched:
+		t.Fatal("launch finished before warmer was ready")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(warm)
+	jtest.RequireNil(t, <-launched)
+	<-apiStarted
+	jtest.RequireNil(t, a.Shutdown())
+}
+
+func TestProcessDependencies_errors(t *testing.T) {
+	testCases := []struct {
+		name   string
+		dep    string
+		expErr error
+	}{
+		{name: "never ready", dep: "slow", expErr: context.DeadlineExceeded},
+		{name: "unknown dependency", dep: "missing"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := lu.App{StartupTimeout: 10 * time.Millisecond}
+			a.AddProcess(
+				lu.Process{Name: "slow", Run: func(ctx context.Context) error {
+					<-ctx.Done()
+					return nil
+				}},
+				lu.Process{Name: "api", DependsOn: []string{tc.dep}, Run: func(ctx context.Context) error {
+					return io.ErrUnexpectedEOF
+				}},
+			)
+			err := a.Launch(context.Background())
+			require.Error(t, err)
+			if tc.expErr != nil {
+				jtest.Assert(t, tc.expErr, err)
+			}
+		})
+	}
+}
+
+func TestSignalReadySharedName(t *testing.T) {
+	var a lu.App
+	for range 2 {
+		a.AddProcess(lu.Process{Run: func(ctx context.Context) error {
+			lu.SignalReady(ctx)
+			<-ctx.Done()
+			return nil
+		}})
+	}
+	a.AddProcess(lu.Process{Name: "dependent", DependsOn: []string{""}, Run: func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}})
+	jtest.RequireNil(t, a.Launch(context.Background()))
+	jtest.RequireNil(t, a.Shutdown())
+}
+
+func TestLaunchFailureShutsDownProcesses(t *testing.T) {
+	stopped := make(chan struct{})
+	a := lu.App{StartupTimeout: 10 * time.Millisecond}
+	a.AddProcess(
+		lu.Process{
+			Name: "server",
+			Run: func(ctx context.Context) error {
+				<-stopped
+				return nil
+			},
+			Shutdown: func(ctx context.Context) error {
+				close(stopped)
+				return nil
+			},
+		},
+		lu.Process{Name: "api", DependsOn: []string{"server"}, Run: func(ctx context.Context) error {
+			return nil
+		}},
+	)
+	jtest.Assert(t, context.DeadlineExceeded, a.Launch(context.Background()))
+	select {
+	case <-stopped:
+	default:
+		t.Fatal("server wasn't shut down")
+	}
+	assert.Empty(t, a.RunningProcesses())
+}
+
+func TestMaxConcurrentStart(t *testing.T) {
+	var mu sync.Mutex
+	var starting, maxStarting int
+	a := lu.App{MaxConcurrentStart: 2}
+	for _, name := range []string{"one", "two", "three", "four", "five"} {
+		a.AddProcess(lu.Process{Name: name, SignalsReady: true, Run: func(ctx context.Context) error {
+			mu.Lock()
+			starting++
+			maxStarting = max(maxStarting, starting)
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			starting--
+			mu.Unlock()
+			lu.SignalReady(ctx)
+			<-ctx.Done()
+			return nil
+		}})
+	}
+	a.AddProcess(lu.Process{Name: "returns", Run: func(ctx context.Context) error { return nil }})
+
+	jtest.RequireNil(t, a.Launch(context.Background()))
+	jtest.RequireNil(t, a.Shutdown())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 2, maxStarting)
+}
+
+func TestMaxConcurrentStart_notReady(t *testing.T) {
+	var started atomic.Bool
+	a := lu.App{MaxConcurrentStart: 1, StartupTimeout: 10 * time.Millisecond}
+	a.AddProcess(
+		lu.Process{Name: "never ready", SignalsReady: true, Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}},
+		lu.Process{Name: "next", Run: func(ctx context.Context) error {
+			started.Store(true)
+			return nil
+		}},
+	)
+	jtest.Assert(t, context.DeadlineExceeded, a.Launch(context.Background()))
+	assert.False(t, started.Load())
+}
+
+func TestMaxConcurrentStart_withoutSignalsReady(t *testing.T) {
+	a := lu.App{MaxConcurrentStart: 1, StartupTimeout: 10 * time.Millisecond}
+	a.AddProcess(
+		process.NoOp(),
+		lu.Process{Name: "loop", Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}},
+	)
+	jtest.RequireNil(t, a.Launch(context.Background()))
+	jtest.RequireNil(t, a.Shutdown())
+}
+
+func TestAppName(t *testing.T) {
+	a := lu.App{Name: "test-app"}
+	a.AddProcess(process.NoOp())
+	jtest.RequireNil(t, a.Launch(context.Background()))
+	jtest.RequireNil(t, a.Shutdown())
+
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	jtest.RequireNil(t, err)
+	var found bool
+	for _, mf := range mfs {
+		if mf.GetName() != "lu_app_info" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			if m.GetLabel()[0].GetValue() == "test-app" {
+				found = true
+				assert.Equal(t, 1.0, m.GetGauge().GetValue())
+			}
+		}
+	}
+	assert.True(t, found, "lu_app_info not found for the app")
+}
+
+// appGauge returns the value of the gauge metric for the app called name
+func appGauge(t *testing.T, metric, name string) float64 {
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	jtest.RequireNil(t, err)
+	for _, mf := range mfs {
+		if mf.GetName() != metric {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			if m.GetLabel()[0].GetValue() == name {
+				return m.GetGauge().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestProcessCountMetrics(t *testing.T) {
+	a := lu.App{Name: "process-count-app"}
+	a.AddProcess(
+		lu.Process{Name: "exits", Run: func(ctx context.Context) error { return nil }},
+		lu.Process{Name: "blocks", Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}},
+		lu.Process{Name: "no run"},
+	)
+	jtest.RequireNil(t, a.Launch(context.Background()))
+
+	assert.Equal(t, 3.0, appGauge(t, "lu_app_processes_total", "process-count-app"))
+	assert.Eventually(t, func() bool {
+		return appGauge(t, "lu_app_processes_running", "process-count-app") == 1
+	}, time.Second, time.Millisecond)
+
+	jtest.RequireNil(t, a.StartProcess(lu.Process{Name: "started"}))
+	assert.Equal(t, 4.0, appGauge(t, "lu_app_processes_total", "process-count-app"))
+
+	jtest.RequireNil(t, a.Shutdown())
+	assert.Equal(t, 0.0, appGauge(t, "lu_app_processes_running", "process-count-app"))
+}
+
+func TestDuplicateProcessNames(t *testing.T) {
+	testCases := []struct {
+		name      string
+		allow     bool
+		processes []lu.Process
+		expErr    bool
+	}{
+		{name: "unique", processes: []lu.Process{{Name: "a"}, {Name: "b"}}},
+		{name: "unnamed", processes: []lu.Process{{}, {}}},
+		{name: "duplicates", processes: []lu.Process{{Name: "a"}, {Name: "b"}, {Name: "a"}}, expErr: true},
+		{name: "allowed", allow: true, processes: []lu.Process{{Name: "a"}, {Name: "a"}}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := lu.App{AllowDuplicateProcessNames: tc.allow}
+			a.AddProcess(tc.processes...)
+			err := a.Launch(context.Background())
+			if tc.expErr {
+				require.Error(t, err)
+				return
+			}
+			jtest.RequireNil(t, err)
+			jtest.RequireNil(t, a.Shutdown())
+		})
+	}
+}
+
+func TestRequireProcessNames(t *testing.T) {
+	run := func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}
+	testCases := []struct {
+		name      string
+		require   bool
+		processes []lu.Process
+		expErr    bool
+	}{
+		{name: "named", require: true, processes: []lu.Process{{Name: "a", Run: run}}},
+		{name: "unnamed", require: true, processes: []lu.Process{{Name: "a", Run: run}, {Run: run}}, expErr: true},
+		{name: "unnamed without run", require: true, processes: []lu.Process{{}}},
+		{name: "not required", processes: []lu.Process{{Run: run}}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := lu.App{RequireProcessNames: tc.require}
+			a.AddProcess(tc.processes...)
+			err := a.Launch(context.Background())
+			if tc.expErr {
+				require.Error(t, err)
+				return
+			}
+			jtest.RequireNil(t, err)
+			jtest.RequireNil(t, a.Shutdown())
+		})
+	}
+}
+
+func TestStop(t *testing.T) {
+	causes := make(chan error, 1)
+	var a lu.App
+	a.AddProcess(lu.Process{Name: "worker", Run: func(ctx context.Context) error {
+		<-ctx.Done()
+		causes <- context.Cause(ctx)
+		return context.Cause(ctx)
+	}})
+	jtest.RequireNil(t, a.Launch(context.Background()))
+
+	a.Stop(io.EOF)
+	<-a.WaitForShutdown()
+	jtest.RequireNil(t, a.Shutdown())
+
+	cause := <-causes
+	jtest.Require(t, io.EOF, cause)
+	jtest.Require(t, context.Canceled, cause)
+}
+
+func TestProcessProfileLabels(t *testing.T) {
+	started := make(chan struct{})
+	var a lu.App
+	a.AddProcess(lu.Process{Name: "labelled", Run: func(ctx context.Context) error {
+		go func() {
+			started <- struct{}{}
+			<-ctx.Done()
+		}()
+		<-ctx.Done()
+		return nil
+	}})
+	jtest.RequireNil(t, a.Launch(context.Background()))
+	t.Cleanup(func() { jtest.RequireNil(t, a.Shutdown()) })
+	<-started
+
+	var buf bytes.Buffer
+	jtest.RequireNil(t, pprof.Lookup("goroutine").WriteTo(&buf, 1))
+	// Both the process and the goroutine it started have the label
+	assert.Equal(t, 2, bytes.Count(buf.Bytes(), []byte(`# labels: {"lu_process":"labelled"}`)))
+}
+
+func TestShutdownTwice(t *testing.T) {
+	ev := make(test.EventLog, 100)
+	a := lu.App{OnEvent: ev.Append}
+	a.AddProcess(lu.Process{Name: "failer", Run: func(ctx context.Context) error {
+		return io.ErrUnexpectedEOF
+	}})
+	jtest.RequireNil(t, a.Launch(context.Background()))
+	<-a.WaitForShutdown()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			jtest.Assert(t, io.ErrUnexpectedEOF, a.Shutdown())
+		}()
+	}
+	wg.Wait()
+
+	test.AssertEvents(t, ev,
+		test.Event{Type: lu.AppStartup},
+		test.Event{Type: lu.ProcessStart, Name: "failer"},
+		test.Event{Type: lu.AppRunning},
+		test.Event{Type: lu.ProcessEnd, Name: "failer"},
+		test.Event{Type: lu.AppTerminating},
+		test.Event{Type: lu.AppTerminated},
+	)
+}
+
+func TestLastShutdownErrorInProgress(t *testing.T) {
+	stopping := make(chan struct{})
+	release := make(chan struct{})
+	var a lu.App
+	a.AddProcess(lu.Process{Name: "slow", Run: func(ctx context.Context) error {
+		<-ctx.Done()
+		close(stopping)
+		<-release
+		return nil
+	}})
+	jtest.RequireNil(t, a.Launch(context.Background()))
+
+	shutdown := make(chan error)
+	go func() { shutdown <- a.Shutdown() }()
+
+	<-stopping
+	jtest.Assert(t, lu.ErrShutdownInProgress, a.LastShutdownError())
+	close(release)
+	jtest.RequireNil(t, <-shutdown)
+	jtest.AssertNil(t, a.LastShutdownError())
+}
+
+func TestLastShutdownError(t *testing.T) {
+	testCases := []struct {
+		name      string
+		processes []lu.Process
+		expErr    error
+	}{
+		{name: "clean", processes: []lu.Process{process.NoOp()}},
+		{
+			name: "stuck process",
+			processes: []lu.Process{
+				{Name: "blocker", Run: func(ctx context.Context) error {
+					var c chan struct{}
+					<-c
+					return nil
+				}},
+			},
+			expErr: context.DeadlineExceeded,
+		},
+		{
+			name: "process error",
+			processes: []lu.Process{
+				{Name: "failer", Run: func(ctx context.Context) error {
+					return io.ErrUnexpectedEOF
+				}},
+			},
+			expErr: io.ErrUnexpectedEOF,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := lu.App{ShutdownTimeout: 100 * time.Millisecond}
+			a.AddProcess(tc.processes...)
+
+			jtest.RequireNil(t, a.Launch(context.Background()))
+			jtest.RequireNil(t, a.LastShutdownError())
+
+			err := a.Shutdown()
+			jtest.Assert(t, tc.expErr, err)
+			jtest.Assert(t, tc.expErr, a.LastShutdownError())
+		})
+	}
+}
+
+func TestShutdownHookTimeouts(t *testing.T) {
+	a := lu.App{ShutdownTimeout: 50 * time.Millisecond}
+	a.OnShutdown(func(ctx context.Context) error {
+		<-ctx.Done()
+		return context.Cause(ctx)
+	}, lu.WithHookName("slow"), lu.WithHookTimeout(10*time.Millisecond))
+
+	var lastRan bool
+	a.OnShutdown(func(ctx context.Context) error {
+		jtest.AssertNil(t, ctx.Err())
+		lastRan = true
+		return nil
+	}, lu.WithHookName("critical"))
+
+	jtest.RequireNil(t, a.Launch(context.Background()))
+	jtest.RequireNil(t, a.Shutdown())
+	assert.True(t, lastRan)
+}
+
+func TestShutdownHooksWithinShutdownTimeout(t *testing.T) {
+	a := lu.App{ShutdownTimeout: 20 * time.Millisecond}
+	var ran int
+	for range 3 {
+		a.OnShutdown(func(ctx context.Context) error {
+			ran++
+			<-ctx.Done()
+			return nil
+		})
+	}
+
+	jtest.RequireNil(t, a.Launch(context.Background()))
+	t0 := time.Now()
+	jtest.RequireNil(t, a.Shutdown())
+	assert.Less(t, time.Since(t0), 40*time.Millisecond)
+	assert.Equal(t, 3, ran)
+}
+
+func TestParallelStartupHooks(t *testing.T) {
+	var a lu.App
+	var order []string
+	a.OnStartUp(func(ctx context.Context) error {
+		order = append(order, "first")
+		return nil
+	})
+	// Each hook in the group waits for the other, so they only finish if they run at the same time
+	var wg sync.WaitGroup
+	wg.Add(2)
+	warm := func(ctx context.Context) error {
+		wg.Done()
+		wg.Wait()
+		return nil
+	}
+	a.OnStartUp(warm, lu.WithParallelGroup("caches"))
+	a.OnStartUp(warm, lu.WithParallelGroup("caches"))
+	a.OnStartUp(func(ctx context.Context) error {
+		order = append(order, "last")
+		return nil
+	})
+
+	jtest.RequireNil(t, a.Launch(context.Background()))
+	jtest.RequireNil(t, a.Shutdown())
+	assert.Equal(t, []string{"first", "last"}, order)
+}
+
+func TestParallelStartupHookFails(t *testing.T) {
+	var a lu.App
+	a.OnStartUp(func(ctx context.Context) error {
+		<-ctx.Done()
+		return context.Cause(ctx)
+	}, lu.WithParallelGroup("caches"))
+	a.OnStartUp(func(ctx context.Context) error {
+		return io.ErrUnexpectedEOF
+	}, lu.WithParallelGroup("caches"))
+
+	jtest.Require(t, io.ErrUnexpectedEOF, a.Launch(context.Background()))
+}
+
+func TestStartupHookTimeout(t *testing.T) {
+	var a lu.App
+	a.OnStartUp(func(ctx context.Context) error {
+		<-ctx.Done()
+		return context.Cause(ctx)
+	}, lu.WithHookTimeout(time.Millisecond))
+
+	jtest.Require(t, context.DeadlineExceeded, a.Launch(context.Background()))
+}
+
+func TestStartupHookOverrunsStartupTimeout(t *testing.T) {
+	ev := make(test.EventLog, 10)
+	a := lu.App{StartupTimeout: 10 * time.Millisecond, OnEvent: ev.Append}
+	a.OnStartUp(func(ctx context.Context) error {
+		// Ignores ctx and finishes after the deadline
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	}, lu.WithHookName("slow"))
+	var nextRan bool
+	a.OnStartUp(func(ctx context.Context) error {
+		nextRan = true
+		return nil
+	}, lu.WithHookName("next"))
+
+	jtest.Require(t, context.DeadlineExceeded, a.Launch(context.Background()))
+	assert.False(t, nextRan)
+
+	close(ev)
+	test.AssertEvents(t, ev,
+		test.Event{Type: lu.AppStartup},
+		test.Event{Type: lu.PreHookStart, Name: "slow"},
+	)
+}
+
+func TestProcessWait(t *testing.T) {
+	var stopped atomic.Int32
+	onStop := func(ctx context.Context) error {
+		jtest.RequireNil(t, ctx.Err())
+		_, ok := ctx.Deadline()
+		assert.True(t, ok)
+		stopped.Add(1)
+		return nil
+	}
+	var a lu.App
+	a.AddProcess(
+		process.Wait("flush", time.Second, onStop),
+		process.Wait("close", time.Second, onStop),
+	)
+
+	jtest.RequireNil(t, a.Launch(context.Background()))
+	assert.Equal(t, []string{"flush", "close"}, a.RunningProcesses())
+	assert.Zero(t, stopped.Load())
+	jtest.RequireNil(t, a.Shutdown())
+	assert.Equal(t, int32(2), stopped.Load())
+}
+
+func TestHookPanics(t *testing.T) {
+	t.Run("start hook", func(t *testing.T) {
+		var a lu.App
+		a.OnStartUp(func(ctx context.Context) error {
+			panic("oops")
+		})
+		jtest.Require(t, lu.ErrHookPanicked, a.Launch(context.Background()))
+	})
+	t.Run("stop hook", func(t *testing.T) {
+		var l test.Logger
+		a := lu.App{Logger: &l}
+		a.OnShutdown(func(ctx context.Context) error {
+			panic("oops")
+		})
+		var lastRan bool
+		a.OnShutdown(func(ctx context.Context) error {
+			lastRan = true
+			return nil
+		})
+		jtest.RequireNil(t, a.Launch(context.Background()))
+		jtest.RequireNil(t, a.Shutdown())
+		assert.True(t, lastRan)
+		require.Len(t, l.Errors(), 1)
+		jtest.Require(t, lu.ErrHookPanicked, l.Errors()[0])
+	})
+}
+
+func TestOnFinal(t *testing.T) {
+	testCases := []struct {
+		name   string
+		stuck  bool
+		expErr error
+	}{
+		{name: "clean"},
+		{name: "process timed out", stuck: true, expErr: context.DeadlineExceeded},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var calls []string
+			record := func(s string) {
+				mu.Lock()
+				defer mu.Unlock()
+				calls = append(calls, s)
+			}
+			a := lu.App{
+				ShutdownTimeout: 50 * time.Millisecond,
+				OnEvent: func(ctx context.Context, e lu.Event) {
+					if e.Type == lu.AppTerminated {
+						record("terminated")
+					}
+				},
+			}
+			stuck := make(chan struct{})
+			t.Cleanup(func() { close(stuck) })
+			a.AddProcess(lu.Process{Run: func(ctx context.Context) error {
+				if tc.stuck {
+					<-stuck
+				}
+				<-ctx.Done()
+				return nil
+			}})
+			a.OnShutdown(func(ctx context.Context) error {
+				record("shutdown hook")
+				return nil
+			})
+			var finalErr error
+			a.OnFinal(func(ctx context.Context, shutdownErr error) {
+				jtest.AssertNil(t, ctx.Err())
+				finalErr = shutdownErr
+				record("final")
+			})
+
+			jtest.RequireNil(t, a.Launch(context.Background()))
+			jtest.Require(t, tc.expErr, a.Shutdown())
+			jtest.Require(t, tc.expErr, finalErr)
+			assert.Equal(t, []string{"shutdown hook", "final", "terminated"}, calls)
+		})
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var l test.Logger
+	a := lu.App{Logger: &l}
+	a.OnShutdown(func(ctx context.Context) error {
+		return io.ErrUnexpectedEOF
+	})
+	a.OnShutdown(func(ctx context.Context) error {
+		return io.ErrClosedPipe
+	})
+
+	jtest.RequireNil(t, a.Launch(context.Background()))
+	jtest.RequireNil(t, a.Shutdown())
+
+	errs := l.Errors()
+	require.Len(t, errs, 2)
+	jtest.Assert(t, io.ErrClosedPipe, errs[0])
+	jtest.Assert(t, io.ErrUnexpectedEOF, errs[1])
+}
+
+func TestLoggerFromContext(t *testing.T) {
+	var l test.Logger
+	a := lu.App{Logger: &l}
+	a.AddProcess(process.Sequence(func(ctx context.Context) error {
+		lu.LoggerFromContext(ctx).Info(ctx, "from the process", nil)
+		return nil
+	}))
+
+	jtest.RequireNil(t, a.Launch(context.Background()))
+	assert.Eventually(t, func() bool { return len(l.Infos()) == 3 }, time.Second, time.Millisecond)
+	jtest.RequireNil(t, a.Shutdown())
+
+	assert.Equal(t, []string{"Running sequence step", "from the process", "Finished sequence step"}, l.Infos())
+	assert.Equal(t, lu.JettisonLogger{}, lu.LoggerFromContext(context.Background()))
+}
+
 func TestPIDRemoved(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -254,7 +1457,7 @@ func TestPIDRemoved(t *testing.T) {
 				a.AddProcess(process.NoOp())
 				return &a
 			},
-			expExit: 1,
+			expExit: lu.ExitProcessError,
 		},
 		{
 			name: "normal app",
@@ -263,7 +1466,7 @@ func TestPIDRemoved(t *testing.T) {
 				a.AddProcess(process.NoOp())
 				return &a
 			},
-			expExit: 1,
+			expExit: lu.ExitProcessError,
 		},
 		{
 			name: "app fails to start",
@@ -275,7 +1478,7 @@ func TestPIDRemoved(t *testing.T) {
 				a.AddProcess(process.NoOp())
 				return &a
 			},
-			expExit: 1,
+			expExit: lu.ExitStartupFailed,
 		},
 		{
 			name: "app fails to shutdown",
@@ -287,7 +1490,21 @@ func TestPIDRemoved(t *testing.T) {
 				a.AddProcess(process.NoOp())
 				return &a
 			},
-			expExit: 1,
+			expExit: lu.ExitProcessError,
+		},
+		{
+			name: "process doesn't stop",
+			app: func(t *testing.T) *lu.App {
+				a := lu.App{UseProcessFile: true, ShutdownTimeout: 10 * time.Millisecond}
+				stuck := make(chan struct{})
+				t.Cleanup(func() { close(stuck) })
+				a.AddProcess(lu.Process{Run: func(ctx context.Context) error {
+					<-stuck
+					return nil
+				}})
+				return &a
+			},
+			expExit: lu.ExitShutdownTimeout,
 		},
 	}
 	for _, tc := range tests {
@@ -304,6 +1521,26 @@ func TestPIDRemoved(t *testing.T) {
 	}
 }
 
+func TestMustLaunch(t *testing.T) {
+	a := lu.App{UseProcessFile: true}
+	a.OnStartUp(func(ctx context.Context) error {
+		return io.ErrUnexpectedEOF
+	})
+	a.AddProcess(process.NoOp())
+
+	func() {
+		defer func() {
+			err, ok := recover().(error)
+			require.True(t, ok)
+			jtest.Assert(t, io.ErrUnexpectedEOF, err)
+		}()
+		a.MustLaunch(context.Background())
+	}()
+
+	_, err := os.Open("/tmp/lu.pid")
+	assert.True(t, os.IsNotExist(err))
+}
+
 func TestWaitFor(t *testing.T) {
 	tests := []struct {
 		name   string
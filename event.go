@@ -1,6 +1,16 @@
 package lu
 
-import "context"
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+var errEventsNotFlushed = errors.New("timed out waiting for OnEvent to handle the queued events", j.C("ERR_8d1f52c07a3e94b6"))
 
 //go:generate stringer -type=EventType
 
@@ -9,20 +19,105 @@ type OnEvent func(context.Context, Event)
 type EventType int
 
 const (
-	Unknown        EventType = iota
-	AppStartup               // First event, emitted right at the start
-	PreHookStart             // Emitted just before running each Hook.Start
-	PostHookStart            // Emitted just after completing a Hook.Start
-	AppRunning               // Emitted after starting every process
-	ProcessStart             // Emitted before starting to run a Process
-	ProcessEnd               // Emitted when a Process terminates
-	AppTerminating           // Emitted when the application starts termination
-	PreHookStop              // Emitted before running each Hook.Stop
-	PostHookStop             // Emitted after running each Hook.Stop
-	AppTerminated            // Emitted before calling os.Exit
+	Unknown             EventType = iota
+	AppStartup                    // First event, emitted right at the start
+	PreHookStart                  // Emitted just before running each Hook.Start
+	PostHookStart                 // Emitted just after completing a Hook.Start
+	AppRunning                    // Emitted after starting every process
+	ProcessStart                  // Emitted before starting to run a Process
+	ProcessEnd                    // Emitted when a Process terminates
+	AppTerminating                // Emitted when the application starts termination
+	PreHookStop                   // Emitted before running each Hook.Stop
+	PostHookStop                  // Emitted after running each Hook.Stop
+	AppTerminated                 // Emitted before calling os.Exit
+	AppReloading                  // Emitted before running the reload hooks
+	AppReloaded                   // Emitted after running the reload hooks
+	AppDraining                   // Emitted on SIGTERM when waiting for PreShutdownDelay before stopping
+	ProcessStillRunning           // Emitted for each Process still running every ShutdownProgressInterval during Shutdown
 )
 
 type Event struct {
 	Type EventType
 	Name string
 }
+
+// eventBuffer calls OnEvent from its own goroutine so that a slow OnEvent doesn't hold up the App,
+// the events are queued in a buffered channel and are passed to OnEvent in the order they were emitted.
+type eventBuffer struct {
+	next   OnEvent
+	drop   bool
+	events chan queuedEvent
+	done   chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+
+	closeOnce sync.Once
+	dropped   atomic.Int64
+}
+
+type queuedEvent struct {
+	ctx context.Context
+	e   Event
+}
+
+func newEventBuffer(next OnEvent, size int, drop bool) *eventBuffer {
+	b := &eventBuffer{
+		next:   next,
+		drop:   drop,
+		events: make(chan queuedEvent, size),
+		done:   make(chan struct{}),
+	}
+	go b.dispatch()
+	return b
+}
+
+func (b *eventBuffer) dispatch() {
+	defer close(b.done)
+	for qe := range b.events {
+		b.next(qe.ctx, qe.e)
+	}
+}
+
+// emit queues e for OnEvent, when the buffer is full it waits for space or drops e.
+// Once the buffer is closed, OnEvent is called straight away.
+func (b *eventBuffer) emit(ctx context.Context, e Event) {
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		b.next(ctx, e)
+		return
+	}
+	defer b.mu.RUnlock()
+	qe := queuedEvent{ctx: ctx, e: e}
+	if !b.drop {
+		b.events <- qe
+		return
+	}
+	select {
+	case b.events <- qe:
+	default:
+		b.dropped.Add(1)
+	}
+}
+
+// flush stops queuing events and waits up to timeout for the queued events to be passed to OnEvent.
+// It returns how many events were dropped because the buffer was full.
+func (b *eventBuffer) flush(timeout time.Duration) (int64, error) {
+	b.closeOnce.Do(func() {
+		go func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			b.closed = true
+			close(b.events)
+		}()
+	})
+	ti := time.NewTimer(timeout)
+	defer ti.Stop()
+	select {
+	case <-b.done:
+		return b.dropped.Load(), nil
+	case <-ti.C:
+		return b.dropped.Load(), errEventsNotFlushed
+	}
+}
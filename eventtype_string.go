@@ -19,11 +19,15 @@ func _() {
 	_ = x[PreHookStop-8]
 	_ = x[PostHookStop-9]
 	_ = x[AppTerminated-10]
+	_ = x[AppReloading-11]
+	_ = x[AppReloaded-12]
+	_ = x[AppDraining-13]
+	_ = x[ProcessStillRunning-14]
 }
 
-const _EventType_name = "UnknownAppStartupPreHookStartPostHookStartAppRunningProcessStartProcessEndAppTerminatingPreHookStopPostHookStopAppTerminated"
+const _EventType_name = "UnknownAppStartupPreHookStartPostHookStartAppRunningProcessStartProcessEndAppTerminatingPreHookStopPostHookStopAppTerminatedAppReloadingAppReloadedAppDrainingProcessStillRunning"
 
-var _EventType_index = [...]uint8{0, 7, 17, 29, 42, 52, 64, 74, 88, 99, 111, 124}
+var _EventType_index = [...]uint8{0, 7, 17, 29, 42, 52, 64, 74, 88, 99, 111, 124, 136, 147, 158, 177}
 
 func (i EventType) String() string {
 	if i < 0 || i >= EventType(len(_EventType_index)-1) {
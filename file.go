@@ -1,44 +1,139 @@
 package lu
 
 import (
-	"context"
+	"cmp"
 	"os"
 	"strconv"
+	"strings"
+	"syscall"
 
 	"github.com/luno/jettison/errors"
 	"github.com/luno/jettison/j"
-	"github.com/luno/jettison/log"
 )
 
 const fileName = "/tmp/lu.pid"
 
-func createPIDFile() error {
-	f, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o666)
-	if errors.Is(err, os.ErrExist) {
-		kv := j.MKV{"my_pid": os.Getpid(), "file": fileName, "open_err": err.Error()}
-		contents, readErr := os.ReadFile(fileName)
-		if readErr != nil {
-			// NoReturnErr: Something up with the file, add the error to the original one
-			kv["read_err"] = readErr.Error()
-		} else {
-			kv["existing_pid"] = string(contents)
+// PIDFile creates the process file when the App is launched with UseProcessFile,
+// so that a second copy of the app can't be started, and removes it when the App terminates.
+type PIDFile interface {
+	Create() error
+	Remove() error
+}
+
+// pidFileHandover is implemented by the PIDFiles which can be handed over to the new copy of the app on a
+// graceful restart. The new copy takes over the file in Create rather than failing because it already exists.
+type pidFileHandover interface {
+	// handover returns the file to pass to the new copy and its key
+	handover() (string, *os.File, error)
+}
+
+// ExclusivePIDFile is the default PIDFile, it fails to create the file if it already exists.
+// Use FlockPIDFile instead on filesystems where exclusive creation isn't reliable.
+type ExclusivePIDFile struct {
+	// Path of the file, defaults to /tmp/lu.pid
+	Path string
+	// ReclaimStale replaces the file when the process it names isn't running, e.g. after a crash,
+	// instead of failing to start.
+	ReclaimStale bool
+}
+
+func (f ExclusivePIDFile) Create() error {
+	path := cmp.Or(f.Path, fileName)
+	if inherited := inheritedFile(pidFileKey(path)); inherited != nil {
+		// Handed over by the copy of the app which started this one, take it over
+		_ = inherited.Close()
+		return writePIDFile(path)
+	}
+	err := createPIDFile(path)
+	if errors.Is(err, os.ErrExist) && f.ReclaimStale && isStalePIDFile(path) {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.Wrap(err, "remove stale pid file", j.KV("file", path))
 		}
-		return errors.New("process already running", kv)
+		err = createPIDFile(path)
+	}
+	if errors.Is(err, os.ErrExist) {
+		return alreadyRunning(path, err)
+	}
+	return err
+}
+
+func (f ExclusivePIDFile) Remove() error {
+	return removePIDFile(cmp.Or(f.Path, fileName))
+}
+
+func (f ExclusivePIDFile) handover() (string, *os.File, error) {
+	path := cmp.Or(f.Path, fileName)
+	file, err := os.Open(path)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "open pid file", j.KV("file", path))
+	}
+	return pidFileKey(path), file, nil
+}
+
+// writePIDFile replaces the contents of the file at path with our PID
+func writePIDFile(path string) error {
+	err := os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())), 0o666)
+	if err != nil {
+		return errors.Wrap(err, "creating pid file", j.KV("file", path))
+	}
+	return nil
+}
+
+func createPIDFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o666)
+	if err != nil {
+		return err
 	}
 	defer f.Close()
 	_, err = f.WriteString(strconv.Itoa(os.Getpid()))
 	if err != nil {
-		return errors.Wrap(err, "creating pid file", j.KV("file", fileName))
+		return errors.Wrap(err, "creating pid file", j.KV("file", path))
 	}
 	return nil
 }
 
-func removePIDFile(ctx context.Context) {
-	err := os.Remove(fileName)
+// isStalePIDFile returns true if the process named in the file at path isn't running.
+// A file with our own PID is stale, e.g. left by an earlier container which also ran as PID 1.
+func isStalePIDFile(path string) bool {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(contents)))
+	if err != nil {
+		return false
+	}
+	if pid == os.Getpid() {
+		return true
+	}
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return true
+	}
+	err = proc.Signal(syscall.Signal(0))
+	return err != nil && !errors.Is(err, os.ErrPermission) && !errors.Is(err, syscall.EPERM)
+}
+
+// alreadyRunning returns the error for a pid file which is held by another process
+func alreadyRunning(path string, err error) error {
+	kv := j.MKV{"my_pid": os.Getpid(), "file": path, "open_err": err.Error()}
+	contents, readErr := os.ReadFile(path)
+	if readErr != nil {
+		// NoReturnErr: Something up with the file, add the error to the original one
+		kv["read_err"] = readErr.Error()
+	} else {
+		kv["existing_pid"] = string(contents)
+	}
+	return errors.New("process already running", kv)
+}
+
+func removePIDFile(path string) error {
+	err := os.Remove(path)
 	if errors.Is(err, os.ErrNotExist) {
 		// NoReturnErr: File already gone, no worries
+		return nil
 	} else if err != nil {
-		// NoReturnErr: We'll terminate after this so just log
-		log.Error(ctx, errors.Wrap(err, "remove pid file", j.KV("file", fileName)))
+		return errors.Wrap(err, "remove pid file", j.KV("file", path))
 	}
+	return nil
 }
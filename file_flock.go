@@ -0,0 +1,112 @@
+//go:build unix
+
+package lu
+
+import (
+	"cmp"
+	"os"
+	"strconv"
+	"syscall"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+// FlockPIDFile is a PIDFile which holds an advisory lock on the file, using flock, for as long as the app runs.
+// The lock is released when the process exits, so a file left behind by a crash doesn't stop the app from starting.
+// It must be used as a pointer, e.g. App{PIDFile: &lu.FlockPIDFile{}}.
+type FlockPIDFile struct {
+	// Path of the file, defaults to /tmp/lu.pid
+	Path string
+
+	f *os.File
+}
+
+func (l *FlockPIDFile) Create() error {
+	path := cmp.Or(l.Path, fileName)
+	if f := inheritedFile(pidFileKey(path)); f != nil {
+		// Handed over by the copy of the app which started this one, which shares the lock with us
+		return l.writePID(f, path)
+	}
+	for {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o666)
+		if err != nil {
+			return errors.Wrap(err, "open pid file", j.KV("file", path))
+		}
+		locked, err := lockPIDFile(f, path)
+		if err != nil {
+			_ = f.Close()
+			return err
+		}
+		if !locked {
+			// The file was removed by the process which held the lock, lock the file which is there now
+			_ = f.Close()
+			continue
+		}
+		return l.writePID(f, path)
+	}
+}
+
+// lockPIDFile takes the lock on f, which was opened at path. It returns false if f is no longer the file at path,
+// e.g. when the process which held the lock removed it between us opening and locking it, since holding the lock
+// on a removed file wouldn't stop another copy of the app from starting.
+func lockPIDFile(f *os.File, path string) (bool, error) {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return false, alreadyRunning(path, err)
+	} else if err != nil {
+		return false, errors.Wrap(err, "lock pid file", j.KV("file", path))
+	}
+	locked, err := f.Stat()
+	if err != nil {
+		return false, errors.Wrap(err, "stat pid file", j.KV("file", path))
+	}
+	current, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrap(err, "stat pid file", j.KV("file", path))
+	}
+	return os.SameFile(locked, current), nil
+}
+
+// writePID writes our PID to the locked file f and keeps it open to hold the lock
+func (l *FlockPIDFile) writePID(f *os.File, path string) error {
+	if err := f.Truncate(0); err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "creating pid file", j.KV("file", path))
+	}
+	if _, err := f.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0); err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "creating pid file", j.KV("file", path))
+	}
+	l.f = f
+	return nil
+}
+
+// handover returns a copy of the locked file, the lock is held until both copies are closed
+func (l *FlockPIDFile) handover() (string, *os.File, error) {
+	path := cmp.Or(l.Path, fileName)
+	if l.f == nil {
+		return "", nil, errors.New("pid file not created", j.KV("file", path))
+	}
+	fd, err := syscall.Dup(int(l.f.Fd()))
+	if err != nil {
+		return "", nil, errors.Wrap(err, "copy pid file", j.KV("file", path))
+	}
+	return pidFileKey(path), os.NewFile(uintptr(fd), path), nil
+}
+
+// Remove removes the file before releasing the lock, so that the file isn't removed once it's been locked by another process.
+// A process which opened the file before it was removed sees that it's been removed once it has the lock, see lockPIDFile.
+func (l *FlockPIDFile) Remove() error {
+	if l.f == nil {
+		return nil
+	}
+	err := removePIDFile(cmp.Or(l.Path, fileName))
+	if closeErr := l.f.Close(); err == nil && closeErr != nil {
+		err = errors.Wrap(closeErr, "close pid file")
+	}
+	l.f = nil
+	return err
+}
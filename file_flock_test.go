@@ -0,0 +1,64 @@
+//go:build unix
+
+package lu
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlockPIDFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lu.pid")
+	// A file left behind by a crash doesn't stop the lock being taken
+	jtest.RequireNil(t, os.WriteFile(path, []byte("123456789"), 0o666))
+
+	first := FlockPIDFile{Path: path}
+	jtest.RequireNil(t, first.Create())
+	contents, err := os.ReadFile(path)
+	jtest.RequireNil(t, err)
+	assert.Equal(t, strconv.Itoa(os.Getpid()), string(contents))
+
+	second := FlockPIDFile{Path: path}
+	require.Error(t, second.Create())
+	jtest.RequireNil(t, second.Remove())
+	_, err = os.Stat(path)
+	jtest.RequireNil(t, err)
+
+	jtest.RequireNil(t, first.Remove())
+	_, err = os.Stat(path)
+	jtest.Assert(t, os.ErrNotExist, err)
+
+	jtest.RequireNil(t, second.Create())
+	jtest.RequireNil(t, second.Remove())
+}
+
+func TestFlockPIDFileRemovedBeforeLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lu.pid")
+	first := FlockPIDFile{Path: path}
+	jtest.RequireNil(t, first.Create())
+
+	// Open the file before the first process removes it and releases the lock
+	f, err := os.OpenFile(path, os.O_RDWR, 0o666)
+	jtest.RequireNil(t, err)
+	t.Cleanup(func() { _ = f.Close() })
+	jtest.RequireNil(t, first.Remove())
+
+	locked, err := lockPIDFile(f, path)
+	jtest.RequireNil(t, err)
+	assert.False(t, locked)
+
+	// A third process has created the file again
+	third := FlockPIDFile{Path: path}
+	jtest.RequireNil(t, third.Create())
+	t.Cleanup(func() { jtest.RequireNil(t, third.Remove()) })
+
+	locked, err = lockPIDFile(f, path)
+	jtest.RequireNil(t, err)
+	assert.False(t, locked)
+}
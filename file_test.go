@@ -1,24 +1,59 @@
 package lu
 
 import (
-	"context"
 	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
 
 	"github.com/luno/jettison/jtest"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestPidFile(t *testing.T) {
-	err := createPIDFile()
+	f := ExclusivePIDFile{}
+	err := f.Create()
 	jtest.RequireNil(t, err)
 
 	contents, err := os.ReadFile(fileName)
 	jtest.RequireNil(t, err)
 	assert.NotEmpty(t, string(contents))
 
-	removePIDFile(context.Background())
+	err = f.Remove()
+	jtest.RequireNil(t, err)
 
 	_, err = os.ReadFile(fileName)
 	jtest.Assert(t, os.ErrNotExist, err)
 }
+
+func TestExclusivePIDFileStale(t *testing.T) {
+	testCases := []struct {
+		name      string
+		pid       int
+		reclaim   bool
+		expCreate bool
+	}{
+		{name: "running", pid: os.Getppid(), reclaim: true},
+		{name: "stale", pid: 1 << 22, reclaim: true, expCreate: true},
+		{name: "own pid", pid: os.Getpid(), reclaim: true, expCreate: true},
+		{name: "stale not reclaimed", pid: 1 << 22},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "lu.pid")
+			jtest.RequireNil(t, os.WriteFile(path, []byte(strconv.Itoa(tc.pid)), 0o666))
+
+			f := ExclusivePIDFile{Path: path, ReclaimStale: tc.reclaim}
+			err := f.Create()
+			if !tc.expCreate {
+				require.Error(t, err)
+				return
+			}
+			jtest.RequireNil(t, err)
+			contents, err := os.ReadFile(path)
+			jtest.RequireNil(t, err)
+			assert.Equal(t, strconv.Itoa(os.Getpid()), string(contents))
+		})
+	}
+}
@@ -4,17 +4,38 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
 )
 
+// ErrHookPanicked is returned in place of a panic in a start-up, shutdown or reload hook
+var ErrHookPanicked = errors.New("hook panicked", j.C("ERR_8a5f2c61d09e7b43"))
+
 type hook struct {
 	Name        string
 	createOrder int
 	Priority    HookPriority
+	// Timeout for running a hook, zero means the app's ShutdownTimeout or StartupTimeout
+	Timeout time.Duration
+	// ParallelGroup of a start-up hook, hooks in the same group run at the same time
+	ParallelGroup string
 	// F is called either at the start or at the end of the application lifecycle
 	// ctx will be cancelled if the function takes too long
 	F func(ctx context.Context) error
 }
 
+// run calls F, returning ErrHookPanicked if it panics
+func (h hook) run(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Wrap(ErrHookPanicked, "", j.KV("panic", fmt.Sprint(r)))
+		}
+	}()
+	return h.F(ctx)
+}
+
 func sortHooks(h []hook) {
 	sort.Slice(h, func(i, j int) bool {
 		hi, hj := h[i], h[j]
@@ -59,3 +80,44 @@ func WithHookPriority(p HookPriority) HookOption {
 		options.Priority = p
 	}
 }
+
+// WithHookTimeout sets the deadline for running a shutdown hook, each shutdown hook has its own
+// deadline so that a slow hook doesn't stop the others from running.
+// The default for shutdown hooks is the app's ShutdownTimeout, and it's capped at the time left of it.
+// It also sets a deadline for a start-up hook, e.g. one in a parallel group, within the app's StartupTimeout.
+func WithHookTimeout(d time.Duration) HookOption {
+	return func(options *hook) {
+		options.Timeout = d
+	}
+}
+
+// WithParallelGroup runs a start-up hook at the same time as the other start-up hooks in the same group,
+// e.g. to warm up independent caches without each one waiting for the last. The group is run at the position
+// of its first hook, after ordering the hooks by priority, and Launch waits for all of them before carrying on.
+// When a hook in the group fails, the context of the others is cancelled and Launch fails.
+// It has no effect on shutdown or reload hooks.
+func WithParallelGroup(id string) HookOption {
+	return func(options *hook) {
+		options.ParallelGroup = id
+	}
+}
+
+// parallelGroups splits the indexes of the sorted hooks into the groups which are run one after the other,
+// each hook is in a group of its own unless it has a ParallelGroup
+func parallelGroups(hooks []hook) [][]int {
+	var groups [][]int
+	pos := make(map[string]int)
+	for idx, h := range hooks {
+		if h.ParallelGroup == "" {
+			groups = append(groups, []int{idx})
+			continue
+		}
+		if g, ok := pos[h.ParallelGroup]; ok {
+			groups[g] = append(groups[g], idx)
+			continue
+		}
+		pos[h.ParallelGroup] = len(groups)
+		groups = append(groups, []int{idx})
+	}
+	return groups
+}
@@ -106,3 +106,15 @@ func TestPriorityPanic(t *testing.T) {
 		WithHookPriority(101)
 	})
 }
+
+func TestParallelGroups(t *testing.T) {
+	hooks := []hook{
+		{Name: "a"},
+		{Name: "b", ParallelGroup: "caches"},
+		{Name: "c"},
+		{Name: "d", ParallelGroup: "caches"},
+		{Name: "e", ParallelGroup: "other"},
+	}
+	assert.Equal(t, [][]int{{0}, {1, 3}, {2}, {4}}, parallelGroups(hooks))
+	assert.Empty(t, parallelGroups(nil))
+}
@@ -0,0 +1,51 @@
+package lu
+
+import (
+	"context"
+
+	"github.com/luno/jettison/j"
+	"github.com/luno/jettison/log"
+)
+
+// Logger is used for logging the lifecycle of the App and its Processes
+type Logger interface {
+	Info(ctx context.Context, msg string, fields map[string]any)
+	Error(ctx context.Context, err error)
+}
+
+// JettisonLogger is the default Logger, it logs using the jettison log package
+type JettisonLogger struct{}
+
+func (JettisonLogger) Info(ctx context.Context, msg string, fields map[string]any) {
+	if len(fields) == 0 {
+		log.Info(ctx, msg)
+		return
+	}
+	log.Info(ctx, msg, j.MKV(fields))
+}
+
+func (JettisonLogger) Error(ctx context.Context, err error) {
+	log.Error(ctx, err)
+}
+
+// DiscardLogger is a Logger which doesn't log anything, e.g. for quietening tests
+type DiscardLogger struct{}
+
+func (DiscardLogger) Info(context.Context, string, map[string]any) {}
+
+func (DiscardLogger) Error(context.Context, error) {}
+
+type loggerKey struct{}
+
+func withLogger(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// LoggerFromContext returns the Logger of the App from the context given to its hooks and Processes,
+// so that they can log in the same way as the App. It returns JettisonLogger if there's no App Logger in ctx.
+func LoggerFromContext(ctx context.Context) Logger {
+	if l, ok := ctx.Value(loggerKey{}).(Logger); ok {
+		return l
+	}
+	return JettisonLogger{}
+}
@@ -0,0 +1,43 @@
+package lu
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var appInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "lu_app_info",
+	Help: "Information about the running app, the value is always 1",
+}, []string{"name"})
+
+var processesTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "lu_app_processes_total",
+	Help: "Number of processes in the app, including those without a Run func",
+}, []string{"name"})
+
+var processesRunning = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "lu_app_processes_running",
+	Help: "Number of processes of the app which are still running",
+}, []string{"name"})
+
+var registerAppInfo sync.Once
+
+// setAppInfo sets the lu_app_info metric for the app, registering it the first time it's used
+func setAppInfo(name string) {
+	registerMetrics()
+	appInfo.WithLabelValues(name).Set(1)
+}
+
+// registerMetrics registers the app metrics with prometheus.DefaultRegisterer the first time it's called
+func registerMetrics() {
+	registerAppInfo.Do(func() {
+		prometheus.MustRegister(appInfo, processesTotal, processesRunning)
+	})
+}
+
+// setProcessCount sets the lu_app_processes_total metric to the number of processes in the app
+func setProcessCount(name string, count int) {
+	registerMetrics()
+	processesTotal.WithLabelValues(name).Set(float64(count))
+}
@@ -2,13 +2,15 @@ package lu
 
 import (
 	"context"
+	"sync"
+	"time"
 )
 
 // ProcessFunc is a core process. See Process.Run for more details
 type ProcessFunc func(ctx context.Context) error
 
 // Process will be a long-running part of the application which,
-// if/when it errors, should bring the application down with it.
+// if/when it errors, should bring the application down with it, unless it's NonEssential.
 // It takes a context, if that context is canceled then the Process
 // should return as soon as possible.
 type Process struct {
@@ -19,9 +21,125 @@ type Process struct {
 	// Run takes a context, if that context is canceled then the ProcessFunc
 	// should return as soon as possible
 	// If Run returns an error, the application will begin the shutdown procedure
+	// unless the Process is NonEssential
 	Run ProcessFunc
+	// NonEssential Processes don't bring the application down when Run returns an error,
+	// the error is logged and the rest of the application keeps running without the Process.
+	// Use it for auxiliary Processes, e.g. exporting metrics, which the application can do without.
+	NonEssential bool
+	// Start is called by Launch after running the start-up hooks and before running any Processes.
+	// It's for setting up anything which can fail straight away, e.g. binding to a port, so that
+	// the failure is returned by Launch rather than bringing the app down after it's started.
+	// Together with Shutdown it keeps the set-up and tear-down of the Process's resources next to its Run,
+	// rather than in start-up and shutdown hooks. The time taken counts towards StartupTimeout.
+	Start func(ctx context.Context) error
 	// Shutdown will be called to terminate the Process
 	// prior to cancelling the Run context.
 	// This is for Processes where synchronous shutdown is necessary
 	Shutdown func(ctx context.Context) error
+	// Quiesce will be called to stop the Process from starting any new work,
+	// it should return once any work in progress has finished.
+	// Run should keep running until its context is cancelled.
+	Quiesce func(ctx context.Context) error
+	// InFlight tracks work started by the Process which may outlive Run, e.g. requests being handled.
+	// Shutdown waits for it, after Run has returned, for up to ShutdownTimeout.
+	InFlight *sync.WaitGroup
+	// Tags are arbitrary metadata about the Process, e.g. its severity for alerting.
+	// They're available from the context of the Run func and of the ProcessStart and ProcessEnd events
+	// by calling ProcessTags.
+	Tags map[string]string
+	// ShutdownTier orders the cancellation of the Processes when the app stops, e.g. so that consumers stop
+	// before the connection pool they share. Processes in tier 0 are cancelled along with the app context,
+	// then each higher tier is cancelled by Shutdown once every Process in the lower tiers has returned.
+	// Processes in a higher tier keep running after the app context is cancelled until Shutdown is called.
+	// It's all bounded by ShutdownTimeout. Defaults to 0, so every Process is cancelled at once.
+	ShutdownTier uint
+	// DependsOn are the names of other Processes which must call SignalReady before this Process is run.
+	DependsOn []string
+	// SignalsReady means that Run calls SignalReady once the Process has started up, so that when
+	// App.MaxConcurrentStart is set the next wave of Processes isn't started until it has.
+	SignalsReady bool
+	// Schedules describe when the Process does its work, if it runs on a schedule, e.g. one for process.Scheduled
+	// and one for each job of a process.Scheduler. They're listed by App.Schedules.
+	Schedules []ScheduleInfo
+}
+
+// ScheduleInfo describes a Process which runs on a schedule
+type ScheduleInfo struct {
+	// Name of the scheduled Process, also used as the name of its cursor unless it's set with process.WithCursorName
+	Name string
+	// Description of when the Process runs, e.g. "every 1h0m0s"
+	Description string
+	// LastRun returns the time of the last completed run, it's zero if the Process has never run
+	LastRun func(ctx context.Context) (time.Time, error)
+	// NextRun returns the time that the Process will next run
+	NextRun func(ctx context.Context) (time.Time, error)
+}
+
+type tagsKey struct{}
+
+func withProcessTags(ctx context.Context, tags map[string]string) context.Context {
+	return context.WithValue(ctx, tagsKey{}, tags)
+}
+
+type readyKey struct{}
+
+func withSignalReady(ctx context.Context, ready func()) context.Context {
+	return context.WithValue(ctx, readyKey{}, ready)
+}
+
+// SignalReady marks the Process being run with ctx as ready, which starts any Processes that depend on it.
+// It's safe to call more than once, and it does nothing if ctx isn't from a Process run by an App.
+func SignalReady(ctx context.Context) {
+	if ready, ok := ctx.Value(readyKey{}).(func()); ok {
+		ready()
+	}
+}
+
+type emitKey struct{}
+
+func withEmitEvent(ctx context.Context, emit func(context.Context, EventType)) context.Context {
+	return context.WithValue(ctx, emitKey{}, emit)
+}
+
+// EmitProcessEvent calls OnEvent of the App with an event of type t for the Process being run with ctx,
+// e.g. for a Process which starts and stops its work while it's running.
+// It does nothing if ctx isn't from a Process run by an App.
+func EmitProcessEvent(ctx context.Context, t EventType) {
+	if emit, ok := ctx.Value(emitKey{}).(func(context.Context, EventType)); ok {
+		emit(ctx, t)
+	}
+}
+
+// ProcessError is an error which a Process carried on running after, e.g. from one iteration of a loop.
+// See App.ProcessErrors.
+type ProcessError struct {
+	// Name of the Process
+	Name string
+	Err  error
+	// ErrCount is how many errors the Process has had in a row, including this one
+	ErrCount uint
+}
+
+type reportErrorKey struct{}
+
+func withReportError(ctx context.Context, report func(err error, errCount uint)) context.Context {
+	return context.WithValue(ctx, reportErrorKey{}, report)
+}
+
+// ReportProcessError sends err, from the Process being run with ctx, to App.ProcessErrors. errCount is how many
+// errors the Process has had in a row. The loops in the process package report every error that they log.
+// It does nothing if ctx isn't from a Process run by an App.
+func ReportProcessError(ctx context.Context, err error, errCount uint) {
+	if report, ok := ctx.Value(reportErrorKey{}).(func(error, uint)); ok {
+		report(err, errCount)
+	}
+}
+
+// ProcessTags returns the Tags of the Process from the context given to the
+// Process when it's run or to OnEvent for ProcessStart and ProcessEnd events.
+// It returns nil if there are no tags in ctx.
+func ProcessTags(ctx context.Context) map[string]string {
+	tags, _ := ctx.Value(tagsKey{}).(map[string]string)
+	return tags
 }
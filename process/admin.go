@@ -0,0 +1,67 @@
+package process
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/luno/lu"
+)
+
+type adminOptions struct {
+	disablePprof bool
+	gatherer     prometheus.Gatherer
+}
+
+type AdminOption func(*adminOptions)
+
+// WithoutPprof stops AdminHTTP from serving the /debug/pprof endpoints, e.g. in production
+func WithoutPprof() AdminOption {
+	return func(o *adminOptions) {
+		o.disablePprof = true
+	}
+}
+
+// WithGatherer serves the metrics from g at /metrics instead of prometheus.DefaultGatherer
+func WithGatherer(g prometheus.Gatherer) AdminOption {
+	return func(o *adminOptions) {
+		o.gatherer = g
+	}
+}
+
+// AdminHTTP is a Process which serves prometheus metrics at /metrics and the
+// standard pprof endpoints under /debug/pprof/ on addr.
+// Like HTTP, the server is shut down gracefully when the app stops.
+// The Process is named after addr, so that an app can serve more than one.
+func AdminHTTP(addr string, opts ...AdminOption) lu.Process {
+	var o adminOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           adminMux(o),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return HTTP("admin "+addr, server)
+}
+
+func adminMux(o adminOptions) *http.ServeMux {
+	mux := http.NewServeMux()
+	if o.gatherer == nil {
+		mux.Handle("/metrics", promhttp.Handler())
+	} else {
+		mux.Handle("/metrics", promhttp.HandlerFor(o.gatherer, promhttp.HandlerOpts{}))
+	}
+	if !o.disablePprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+	return mux
+}
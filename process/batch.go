@@ -0,0 +1,81 @@
+package process
+
+import (
+	"context"
+	"time"
+
+	"github.com/luno/lu"
+)
+
+// FetchFunc returns the items after the cursor value and the cursor value to store once they've all been handled.
+// The cursor value is empty when nothing has been handled yet.
+type FetchFunc[T any] func(ctx context.Context, after string) (items []T, next string, err error)
+
+func defaultBatchOptions() options {
+	return options{
+		sleep:      SleepFor(time.Minute),
+		errorSleep: ErrorSleepFor(10 * time.Second),
+	}
+}
+
+// Batch will create a lu.Process which repeatedly fetches the items after the cursor value stored in curs,
+// calls handle for each of them in order and then stores the next cursor value returned by fetch.
+// If an item fails to be handled then the whole batch will be fetched again, so handle should be idempotent.
+// When fetch returns no items, the process has caught up and will sleep for the duration set by
+// WithSleep or WithSleepFunc, defaults to one minute. Otherwise, the next batch is fetched straight away.
+// Errors are handled the same as with ContextLoop.
+func Batch[T any](awaitFunc AwaitRoleFunc, curs Cursor,
+	name string, fetch FetchFunc[T], handle func(ctx context.Context, item T) error,
+	ol ...Option,
+) lu.Process {
+	opts := resolveOptions(defaultBatchOptions(), append(ol, WithName(name)))
+	opts.quiescer = new(quiescer)
+
+	if opts.role == "" {
+		opts.role = opts.name
+	}
+
+	var caughtUp bool
+	idle := opts.sleep
+	opts.sleep = func() time.Duration {
+		if caughtUp {
+			return idle()
+		}
+		return 0
+	}
+
+	f := func(ctx context.Context) error {
+		var err error
+		caughtUp, err = processBatch(ctx, curs, name, fetch, handle)
+		return err
+	}
+
+	return lu.Process{
+		Name:    opts.name,
+		Run:     wrapContextLoop(timeAcquire(awaitFunc(opts.role), opts), f, opts),
+		Quiesce: opts.quiescer.Quiesce,
+	}
+}
+
+// processBatch handles the next batch of items and moves the cursor on, it returns true when there were no items
+func processBatch[T any](ctx context.Context, curs Cursor, name string,
+	fetch FetchFunc[T], handle func(ctx context.Context, item T) error,
+) (bool, error) {
+	after, err := curs.Get(ctx, name)
+	if err != nil {
+		return false, err
+	}
+	items, next, err := fetch(ctx, after)
+	if err != nil {
+		return false, err
+	}
+	if len(items) == 0 {
+		return true, nil
+	}
+	for _, item := range items {
+		if err := handle(ctx, item); err != nil {
+			return false, err
+		}
+	}
+	return false, curs.Set(ctx, name, next)
+}
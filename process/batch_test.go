@@ -0,0 +1,54 @@
+package process
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/jtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	rows := []int{1, 2, 3, 4, 5}
+	var fetches []string
+	fetch := func(ctx context.Context, after string) ([]int, string, error) {
+		fetches = append(fetches, after)
+		var from int
+		if after != "" {
+			from, _ = strconv.Atoi(after)
+		}
+		if from >= len(rows) {
+			// Caught up, stop the test
+			cancel()
+			return nil, after, nil
+		}
+		to := min(from+2, len(rows))
+		return rows[from:to], strconv.Itoa(to), nil
+	}
+
+	var handled []int
+	failed := false
+	handle := func(ctx context.Context, row int) error {
+		if row == 4 && !failed {
+			failed = true
+			return errors.New("failed once")
+		}
+		handled = append(handled, row)
+		return nil
+	}
+
+	curs := make(memCursor)
+	p := Batch(AlwaysRole, curs, "batch", fetch, handle, WithErrorSleep(0))
+
+	err := p.Run(ctx)
+	jtest.Require(t, context.Canceled, err)
+
+	assert.Equal(t, []int{1, 2, 3, 3, 4, 5}, handled)
+	assert.Equal(t, []string{"", "2", "2", "4", "5"}, fetches)
+	assert.Equal(t, "5", curs["batch"])
+}
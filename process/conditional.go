@@ -0,0 +1,122 @@
+package process
+
+import (
+	"context"
+	"time"
+
+	"github.com/luno/jettison/errors"
+
+	"github.com/luno/lu"
+)
+
+// Conditional is a Process which runs one of processes depending on the value returned by cond.
+// cond is called after every sleep (see WithSleep, defaults to one second), when the value changes
+// the running process is shut down and stopped before the process for the new value is started.
+// No process is run while the value doesn't have an entry in processes.
+// If the running process returns an error then Conditional stops and returns that error,
+// if it returns nil then it's not run again until the value changes.
+func Conditional(
+	cond func(ctx context.Context) (string, error),
+	processes map[string]lu.Process,
+	ol ...Option,
+) lu.Process {
+	defaults := defaultLoopOptions()
+	defaults.sleep = SleepFor(time.Second)
+	opts := resolveOptions(defaults, ol)
+	c := conditional{cond: cond, processes: processes, opts: opts}
+	return lu.Process{Name: opts.name, Run: c.run}
+}
+
+type conditional struct {
+	cond      func(ctx context.Context) (string, error)
+	processes map[string]lu.Process
+	opts      options
+}
+
+func (c conditional) run(ctx context.Context) error {
+	var (
+		current  string
+		running  *subProcess
+		errCount uint
+	)
+	defer func() {
+		c.stop(ctx, running)
+	}()
+	for ctx.Err() == nil {
+		sleep := c.opts.sleep()
+		val, err := c.cond(ctx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			// NoReturnErr: Log critical errors and keep the current process running
+			errCount += 1
+			sleep = c.opts.errorSleepFor(ctx, errCount, err)
+			c.opts.errCounter.Inc()
+			c.opts.logger.Error(ctx, err)
+			lu.ReportProcessError(ctx, err, errCount)
+		} else if err == nil {
+			errCount = 0
+			if running == nil || val != current {
+				c.stop(ctx, running)
+				running = nil
+				if p, ok := c.processes[val]; ok {
+					c.opts.logger.Info(ctx, "starting conditional process",
+						map[string]any{"condition": val, "process": p.Name})
+					running = startSubProcess(ctx, p)
+				}
+				current = val
+			}
+		}
+
+		var done <-chan error
+		if running != nil && !running.exited {
+			done = running.done
+		}
+		t := c.opts.clock.NewTimer(sleep)
+		select {
+		case <-ctx.Done():
+		case <-t.C():
+		case err := <-done:
+			running.exited = true
+			if err != nil {
+				t.Stop()
+				return err
+			}
+		}
+		t.Stop()
+	}
+	return context.Cause(ctx)
+}
+
+// subProcess is a lu.Process which has been started by Conditional
+type subProcess struct {
+	p      lu.Process
+	cancel context.CancelFunc
+	done   chan error
+	exited bool
+}
+
+func startSubProcess(ctx context.Context, p lu.Process) *subProcess {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &subProcess{p: p, cancel: cancel, done: make(chan error, 1)}
+	go func() {
+		s.done <- p.Run(ctx)
+	}()
+	return s
+}
+
+// stop shuts down the process, if it has a Shutdown func, and then cancels it and waits for it to return
+func (c conditional) stop(ctx context.Context, s *subProcess) {
+	if s == nil {
+		return
+	}
+	if s.p.Shutdown != nil && ctx.Err() == nil {
+		if err := s.p.Shutdown(ctx); err != nil {
+			// NoReturnErr: The process is cancelled regardless
+			c.opts.logger.Error(ctx, err)
+		}
+	}
+	s.cancel()
+	if !s.exited {
+		<-s.done
+		s.exited = true
+	}
+}
@@ -0,0 +1,74 @@
+package process_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/luno/lu"
+	"github.com/luno/lu/process"
+)
+
+func TestConditional(t *testing.T) {
+	var mu sync.Mutex
+	cond := "leader"
+	setCond := func(s string) {
+		mu.Lock()
+		defer mu.Unlock()
+		cond = s
+	}
+	getCond := func(ctx context.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return cond, nil
+	}
+
+	events := make(chan string, 10)
+	recorder := func(name string) lu.Process {
+		return lu.Process{
+			Name: name,
+			Run: func(ctx context.Context) error {
+				events <- "start " + name
+				<-ctx.Done()
+				events <- "stop " + name
+				return context.Cause(ctx)
+			},
+		}
+	}
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case e := <-events:
+			assert.Equal(t, want, e)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := process.Conditional(getCond, map[string]lu.Process{
+		"leader":   recorder("leader"),
+		"follower": recorder("follower"),
+	}, process.WithSleep(time.Millisecond))
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- p.Run(ctx) }()
+
+	expect("start leader")
+	setCond("follower")
+	expect("stop leader")
+	expect("start follower")
+	setCond("none")
+	expect("stop follower")
+	setCond("leader")
+	expect("start leader")
+
+	cancel()
+	expect("stop leader")
+	jtest.Require(t, context.Canceled, <-runErr)
+	assert.Empty(t, events)
+}
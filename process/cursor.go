@@ -0,0 +1,63 @@
+package process
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// TypedCursor stores a value of type T in a Cursor, so that structured state can be kept
+// in the same place as the cursors for Scheduled and Batch processes.
+type TypedCursor[T any] struct {
+	cursor    Cursor
+	name      string
+	marshal   func(T) (string, error)
+	unmarshal func(string) (T, error)
+}
+
+// NewTypedCursor returns a TypedCursor which stores values in c under name, using marshal
+// and unmarshal to convert values to and from the string stored in c.
+func NewTypedCursor[T any](
+	c Cursor,
+	name string,
+	marshal func(T) (string, error),
+	unmarshal func(string) (T, error),
+) TypedCursor[T] {
+	return TypedCursor[T]{cursor: c, name: name, marshal: marshal, unmarshal: unmarshal}
+}
+
+// JSONCursor returns a TypedCursor which stores values in c under name as JSON
+func JSONCursor[T any](c Cursor, name string) TypedCursor[T] {
+	return NewTypedCursor(c, name,
+		func(v T) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+		func(s string) (T, error) {
+			var v T
+			err := json.Unmarshal([]byte(s), &v)
+			return v, err
+		},
+	)
+}
+
+// GetValue returns the stored value, or the zero value of T if nothing has been stored yet
+func (c TypedCursor[T]) GetValue(ctx context.Context) (T, error) {
+	var zero T
+	s, err := c.cursor.Get(ctx, c.name)
+	if err != nil {
+		return zero, err
+	}
+	if s == "" {
+		return zero, nil
+	}
+	return c.unmarshal(s)
+}
+
+// SetValue stores v
+func (c TypedCursor[T]) SetValue(ctx context.Context, v T) error {
+	s, err := c.marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.cursor.Set(ctx, c.name, s)
+}
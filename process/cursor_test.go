@@ -0,0 +1,47 @@
+package process
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONCursor(t *testing.T) {
+	type state struct {
+		Offset int      `json:"offset"`
+		Seen   []string `json:"seen"`
+	}
+	ctx := context.Background()
+	store := make(memCursor)
+	c := JSONCursor[state](store, "state")
+
+	v, err := c.GetValue(ctx)
+	jtest.RequireNil(t, err)
+	assert.Equal(t, state{}, v)
+
+	jtest.RequireNil(t, c.SetValue(ctx, state{Offset: 5, Seen: []string{"a", "b"}}))
+	assert.Equal(t, `{"offset":5,"seen":["a","b"]}`, store["state"])
+
+	v, err = c.GetValue(ctx)
+	jtest.RequireNil(t, err)
+	assert.Equal(t, state{Offset: 5, Seen: []string{"a", "b"}}, v)
+}
+
+func TestTypedCursor(t *testing.T) {
+	ctx := context.Background()
+	store := make(memCursor)
+	c := NewTypedCursor(store, "count",
+		func(v int) (string, error) { return strconv.Itoa(v), nil },
+		strconv.Atoi,
+	)
+
+	jtest.RequireNil(t, c.SetValue(ctx, 42))
+	assert.Equal(t, "42", store["count"])
+
+	store["count"] = "nope"
+	_, err := c.GetValue(ctx)
+	assert.Error(t, err)
+}
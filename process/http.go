@@ -1,48 +1,150 @@
 package process
 
 import (
+	"cmp"
 	"context"
+	"net"
 	"net/http"
+	"sync"
 
 	"github.com/luno/jettison/errors"
 	"github.com/luno/jettison/j"
-	"github.com/luno/jettison/log"
 
 	"github.com/luno/lu"
 )
 
-// HTTP integrates a http.Server as an App Process
+// HTTP integrates a http.Server as an App Process.
+// The address is bound when the App is launched, so that Launch fails if it's already in use.
+// Unless server.BaseContext is set, the context of each request has the values of the context the Process is run with.
+// It isn't cancelled when the App starts shutting down, so that the requests in flight can finish, only if they're
+// still running when the Process's Shutdown runs out of time.
 func HTTP(name string, server *http.Server) lu.Process {
-	p := lu.Process{
-		Name: "http " + name,
-		Run: func(ctx context.Context) error {
-			log.Info(ctx, "Listening for HTTP requests", j.KS("address", server.Addr))
-			err := server.ListenAndServe()
-			if errors.Is(err, http.ErrServerClosed) {
-				// NoReturnErr: Don't need to return this error
-				return nil
-			}
-			return err
-		},
-		Shutdown: server.Shutdown,
-	}
-	return p
+	return httpProcess("http "+name, server, ":http", "Listening for HTTP requests", server.Serve)
 }
 
-// SecureHTTP integrates a secure http.Server as an App Process
+// SecureHTTP integrates a secure http.Server as an App Process.
+// The address is bound when the App is launched, and request contexts are derived from the Process, as with HTTP.
 func SecureHTTP(name string, server *http.Server, tlsCert, tlsKey string) lu.Process {
-	p := lu.Process{
-		Name: "https " + name,
+	serve := func(ln net.Listener) error { return server.ServeTLS(ln, tlsCert, tlsKey) }
+	return httpProcess("https "+name, server, ":https", "Listening for HTTPS requests", serve)
+}
+
+func httpProcess(name string, server *http.Server, defaultAddr, msg string, serve func(net.Listener) error) lu.Process {
+	var l listener
+	var reqCtx requestContext
+	useRunCtx := server.BaseContext == nil
+	return lu.Process{
+		Name: name,
+		Start: func(ctx context.Context) error {
+			return l.listen(ctx, cmp.Or(server.Addr, defaultAddr))
+		},
 		Run: func(ctx context.Context) error {
-			log.Info(ctx, "Listening for HTTPS requests", j.KS("address", server.Addr))
-			err := server.ListenAndServeTLS(tlsCert, tlsKey)
+			ln, err := l.take(ctx, cmp.Or(server.Addr, defaultAddr))
+			if errors.Is(err, http.ErrServerClosed) {
+				// NoReturnErr: Shut down before it was run
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if useRunCtx {
+				base := reqCtx.start(ctx)
+				server.BaseContext = func(net.Listener) context.Context { return base }
+			}
+			lu.LoggerFromContext(ctx).Info(ctx, msg, map[string]any{"address": server.Addr})
+			err = serve(ln)
 			if errors.Is(err, http.ErrServerClosed) {
 				// NoReturnErr: Don't need to return this error
 				return nil
 			}
+			reqCtx.stop(err)
 			return err
 		},
-		Shutdown: server.Shutdown,
+		Shutdown: func(ctx context.Context) error {
+			err := server.Shutdown(ctx)
+			// Cancel any requests still running after ctx has expired
+			reqCtx.stop(context.Cause(ctx))
+			if closeErr := l.close(); err == nil && closeErr != nil {
+				err = errors.Wrap(closeErr, "close listener")
+			}
+			return err
+		},
+	}
+}
+
+// requestContext is the base of the request contexts, it's detached from the cancellation of the Run context
+// so that the requests in flight aren't cancelled as soon as the App starts shutting down
+type requestContext struct {
+	mu     sync.Mutex
+	cancel context.CancelCauseFunc
+}
+
+func (r *requestContext) start(ctx context.Context) context.Context {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ctx, r.cancel = context.WithCancelCause(context.WithoutCancel(ctx))
+	return ctx
+}
+
+func (r *requestContext) stop(cause error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cancel != nil {
+		r.cancel(cause)
+	}
+}
+
+// listener holds the net.Listener bound by Start until it's served by Run,
+// it's bound with lu.Listen so that it's handed over on a graceful restart
+type listener struct {
+	mu     sync.Mutex
+	ln     net.Listener
+	closed bool
+}
+
+func (l *listener) listen(ctx context.Context, addr string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.bind(ctx, addr)
+}
+
+// bind binds the listener to addr, mu must be held
+func (l *listener) bind(ctx context.Context, addr string) error {
+	ln, err := lu.Listen(ctx, "tcp", addr)
+	if err != nil {
+		return errors.Wrap(err, "listen", j.KS("address", addr))
+	}
+	l.ln = ln
+	return nil
+}
+
+// take returns the bound listener, it binds to addr if the listener hasn't been bound,
+// e.g. when the Process is run without an App. It returns http.ErrServerClosed after close.
+func (l *listener) take(ctx context.Context, addr string) (net.Listener, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil, http.ErrServerClosed
+	}
+	if l.ln == nil {
+		if err := l.bind(ctx, addr); err != nil {
+			return nil, err
+		}
+	}
+	ln := l.ln
+	l.ln = nil
+	return ln, nil
+}
+
+// close closes the bound listener if Run hasn't taken it, e.g. when the App fails to launch
+// or is shut down before the Process is run, and stops it being bound again
+func (l *listener) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	if l.ln == nil {
+		return nil
 	}
-	return p
+	err := l.ln.Close()
+	l.ln = nil
+	return err
 }
@@ -2,11 +2,17 @@ package process
 
 import (
 	"context"
+	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/luno/jettison/jtest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/luno/lu"
 )
@@ -20,6 +26,10 @@ func TestProcess(t *testing.T) {
 			name:    "http server",
 			process: HTTP("test", &http.Server{Addr: "localhost:8080"}),
 		},
+		{
+			name:    "admin server",
+			process: AdminHTTP("localhost:8081"),
+		},
 	}
 
 	for _, tc := range testCases {
@@ -37,3 +47,189 @@ func TestProcess(t *testing.T) {
 		})
 	}
 }
+
+func TestHTTPAddressInUse(t *testing.T) {
+	ln, err := net.Listen("tcp", "localhost:0")
+	jtest.RequireNil(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+
+	var started bool
+	var a lu.App
+	a.AddProcess(
+		HTTP("test", &http.Server{Addr: ln.Addr().String()}),
+		lu.Process{Run: func(ctx context.Context) error {
+			started = true
+			return nil
+		}},
+	)
+
+	err = a.Launch(context.Background())
+	assert.ErrorContains(t, err, ln.Addr().String())
+	assert.False(t, started)
+}
+
+func TestHTTPBaseContext(t *testing.T) {
+	type key struct{}
+	testCases := []struct {
+		name     string
+		base     func(net.Listener) context.Context
+		expValue any
+	}{
+		{name: "run context", expValue: "app"},
+		{
+			name: "base context already set",
+			base: func(net.Listener) context.Context {
+				return context.WithValue(context.Background(), key{}, "server")
+			},
+			expValue: "server",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			values := make(chan any, 1)
+			server := &http.Server{
+				Addr:        "localhost:8082",
+				BaseContext: tc.base,
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					values <- r.Context().Value(key{})
+				}),
+			}
+			var a lu.App
+			a.AddProcess(HTTP("test", server))
+			jtest.RequireNil(t, a.Launch(context.WithValue(context.Background(), key{}, "app")))
+			t.Cleanup(func() { jtest.RequireNil(t, a.Shutdown()) })
+
+			assert.Eventually(t, func() bool {
+				resp, err := http.Get("http://localhost:8082")
+				if err != nil {
+					return false
+				}
+				_ = resp.Body.Close()
+				return true
+			}, time.Second, 10*time.Millisecond)
+			assert.Equal(t, tc.expValue, <-values)
+		})
+	}
+}
+
+func TestAdminHTTPNames(t *testing.T) {
+	var a lu.App
+	a.AddProcess(AdminHTTP("localhost:8084"), AdminHTTP("localhost:8085"))
+	jtest.RequireNil(t, a.Launch(context.Background()))
+	jtest.RequireNil(t, a.Shutdown())
+}
+
+func TestAdminMux(t *testing.T) {
+	testCases := []struct {
+		name    string
+		opts    []AdminOption
+		path    string
+		expCode int
+	}{
+		{name: "metrics", path: "/metrics", expCode: http.StatusOK},
+		{name: "pprof", path: "/debug/pprof/", expCode: http.StatusOK},
+		{name: "pprof disabled", opts: []AdminOption{WithoutPprof()}, path: "/debug/pprof/", expCode: http.StatusNotFound},
+		{
+			name:    "custom gatherer",
+			opts:    []AdminOption{WithGatherer(prometheus.NewRegistry())},
+			path:    "/metrics",
+			expCode: http.StatusOK,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var o adminOptions
+			for _, opt := range tc.opts {
+				opt(&o)
+			}
+			rec := httptest.NewRecorder()
+			adminMux(o).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			assert.Equal(t, tc.expCode, rec.Code)
+		})
+	}
+}
+
+func TestHTTPDrainsRequests(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	reqErr := make(chan error, 1)
+	server := &http.Server{
+		Addr: "localhost:8083",
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(entered)
+			<-release
+			reqErr <- r.Context().Err()
+		}),
+	}
+	var a lu.App
+	a.AddProcess(HTTP("test", server))
+	jtest.RequireNil(t, a.Launch(context.Background()))
+
+	respErr := make(chan error, 1)
+	go func() {
+		var resp *http.Response
+		var err error
+		for {
+			resp, err = http.Get("http://localhost:8083")
+			if err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		respErr <- resp.Body.Close()
+	}()
+	<-entered
+
+	a.Stop(nil)
+	<-a.WaitForShutdown()
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- a.Shutdown() }()
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	jtest.RequireNil(t, <-reqErr)
+	jtest.RequireNil(t, <-respErr)
+	jtest.RequireNil(t, <-shutdownErr)
+}
+
+func TestHTTPClosesListenerWhenLaunchFails(t *testing.T) {
+	testCases := []struct {
+		name      string
+		dependsOn []string
+		processes []lu.Process
+	}{
+		{
+			name: "later start fails",
+			processes: []lu.Process{{Name: "failing", Start: func(ctx context.Context) error {
+				return io.ErrUnexpectedEOF
+			}}},
+		},
+		{
+			name:      "dependency not ready",
+			dependsOn: []string{"never ready"},
+			processes: []lu.Process{{Name: "never ready", Run: func(ctx context.Context) error {
+				<-ctx.Done()
+				return nil
+			}}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "localhost:0")
+			jtest.RequireNil(t, err)
+			addr := ln.Addr().String()
+			jtest.RequireNil(t, ln.Close())
+
+			p := HTTP("test", &http.Server{Addr: addr})
+			p.DependsOn = tc.dependsOn
+			a := lu.App{StartupTimeout: 10 * time.Millisecond}
+			a.AddProcess(p)
+			a.AddProcess(tc.processes...)
+			require.Error(t, a.Launch(context.Background()))
+
+			ln, err = net.Listen("tcp", addr)
+			jtest.RequireNil(t, err)
+			jtest.RequireNil(t, ln.Close())
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package process
+
+import (
+	"context"
+	"sync"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/luno/lu"
+)
+
+// LeaderGate returns a Process which runs inner only while role is held, idling otherwise, e.g. on the instances
+// which aren't the leader. inner should run until its context is cancelled, which happens when the role is lost,
+// after which LeaderGate waits to acquire the role again. An error from inner, while the role is held, is returned.
+// When inner returns nil while the role is held, its work is done and the Process ends, releasing the role.
+//
+// A ProcessStart event is emitted when the role is acquired and a ProcessEnd event when it's released,
+// and the lu_process_is_leader metric for the role is 1 while it's held.
+// The Process is named after the role, use WithName to change it. WithRegistry is also supported.
+func LeaderGate(awaitFunc AwaitRoleFunc, role string, inner lu.ProcessFunc, ol ...Option) lu.Process {
+	opts := resolveOptions(options{name: role}, ol)
+	getCtx := awaitFunc(role)
+	leader := metricsFor(opts.registry).isLeader.With(prometheus.Labels{roleLabel: role})
+	leader.Set(0)
+	return lu.Process{
+		Name: opts.name,
+		Run: func(ctx context.Context) error {
+			var finished bool
+			for ctx.Err() == nil && !finished {
+				err := runWithContext(ctx, getCtx, func(roleCtx context.Context) error {
+					leader.Set(1)
+					lu.EmitProcessEvent(ctx, lu.ProcessStart)
+					defer func() {
+						leader.Set(0)
+						lu.EmitProcessEvent(ctx, lu.ProcessEnd)
+					}()
+					err := inner(roleCtx)
+					if roleCtx.Err() != nil {
+						// NoReturnErr: The role was lost, wait to get it back
+						return nil
+					}
+					// Don't run inner again straight away once it's done
+					finished = err == nil
+					return err
+				})
+				if err != nil && ctx.Err() == nil {
+					return err
+				}
+			}
+			if finished {
+				return nil
+			}
+			return context.Cause(ctx)
+		},
+	}
+}
+
+// ErrLeadershipLost is the cause of the context from RoleFromChannel being cancelled
+var ErrLeadershipLost = errors.New("leadership lost", j.C("ERR_4c1a8020c478d5b7"))
+
+// RoleFromChannel returns an AwaitRoleFunc for leadership which is decided elsewhere, e.g. by an existing
+// leader election, and reported on lead. Every role is held while the last value from lead is true,
+// the context for a role is cancelled with ErrLeadershipLost as soon as lead reports false.
+// Leadership isn't held until lead first reports true, and closing lead loses it for good,
+// so waiting for a role blocks until its context is cancelled.
+func RoleFromChannel(lead <-chan bool) AwaitRoleFunc {
+	l := &leadership{changed: make(chan struct{})}
+	go l.follow(lead)
+	return func(string) ContextFunc {
+		return l.await
+	}
+}
+
+// leadership tracks the latest value from a leadership channel, so that it can be waited for by many processes
+type leadership struct {
+	mu      sync.Mutex
+	leading bool
+	// changed is closed, and replaced, whenever leading changes
+	changed chan struct{}
+}
+
+func (l *leadership) follow(lead <-chan bool) {
+	for leading := range lead {
+		l.set(leading)
+	}
+	l.set(false)
+}
+
+func (l *leadership) set(leading bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if leading == l.leading {
+		return
+	}
+	l.leading = leading
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+func (l *leadership) state() (bool, chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.leading, l.changed
+}
+
+// await blocks until leadership is held and returns a context which is cancelled when it's lost
+func (l *leadership) await(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	for {
+		leading, changed := l.state()
+		if leading {
+			roleCtx, cancel := context.WithCancelCause(ctx)
+			go func() {
+				select {
+				case <-changed:
+					cancel(ErrLeadershipLost)
+				case <-roleCtx.Done():
+				}
+			}()
+			return roleCtx, func() { cancel(context.Canceled) }, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, nil, context.Cause(ctx)
+		case <-changed:
+		}
+	}
+}
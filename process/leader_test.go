@@ -0,0 +1,128 @@
+package process
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/luno/lu"
+	"github.com/luno/lu/test"
+)
+
+func TestLeaderGate(t *testing.T) {
+	grant := make(chan struct{})
+	revoke := make(chan context.CancelFunc, 1)
+	awaitRole := func(string) ContextFunc {
+		return func(ctx context.Context) (context.Context, context.CancelFunc, error) {
+			select {
+			case <-ctx.Done():
+				return nil, nil, context.Cause(ctx)
+			case <-grant:
+			}
+			roleCtx, cancel := context.WithCancel(ctx)
+			revoke <- cancel
+			return roleCtx, cancel, nil
+		}
+	}
+	started := make(chan struct{})
+	inner := func(ctx context.Context) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	reg := prometheus.NewRegistry()
+	isLeader := func() float64 {
+		return testutil.ToFloat64(metricsFor(reg).isLeader.With(prometheus.Labels{roleLabel: "migrations"}))
+	}
+
+	ev := make(test.EventLog, 100)
+	a := lu.App{OnEvent: ev.Append}
+	a.AddProcess(LeaderGate(awaitRole, "migrations", inner, WithRegistry(reg)))
+	jtest.RequireNil(t, a.Launch(context.Background()))
+	assert.Equal(t, 0.0, isLeader())
+
+	grant <- struct{}{}
+	<-started
+	assert.Equal(t, 1.0, isLeader())
+
+	(<-revoke)()
+	assert.Eventually(t, func() bool { return isLeader() == 0 }, time.Second, time.Millisecond)
+
+	jtest.RequireNil(t, a.Shutdown())
+	close(ev)
+	var events []lu.EventType
+	for e := range ev {
+		if e.Name == "migrations" {
+			events = append(events, e.Type)
+		}
+	}
+	// The App emits the outer events when the process starts and ends
+	assert.Equal(t, []lu.EventType{lu.ProcessStart, lu.ProcessStart, lu.ProcessEnd, lu.ProcessEnd}, events)
+}
+
+func TestLeaderGateInnerFinishes(t *testing.T) {
+	var calls int
+	inner := func(ctx context.Context) error {
+		calls++
+		return nil
+	}
+	reg := prometheus.NewRegistry()
+	p := LeaderGate(AlwaysRole, "migrations", inner, WithRegistry(reg))
+
+	done := make(chan error, 1)
+	go func() { done <- p.Run(context.Background()) }()
+	select {
+	case err := <-done:
+		jtest.RequireNil(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("process didn't end after inner finished")
+	}
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, 0.0, testutil.ToFloat64(metricsFor(reg).isLeader.With(prometheus.Labels{roleLabel: "migrations"})))
+}
+
+func TestRoleFromChannel(t *testing.T) {
+	lead := make(chan bool)
+	getCtx := RoleFromChannel(lead)("leader")
+
+	notLeading := func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, _, err := getCtx(ctx)
+		jtest.Require(t, context.DeadlineExceeded, err)
+	}
+	acquire := func(t *testing.T) context.Context {
+		roleCtx, cancel, err := getCtx(context.Background())
+		jtest.RequireNil(t, err)
+		t.Cleanup(cancel)
+		jtest.RequireNil(t, roleCtx.Err())
+		return roleCtx
+	}
+
+	// Not leading until the channel says so
+	notLeading(t)
+
+	lead <- true
+	roleCtx := acquire(t)
+	lead <- true
+	jtest.RequireNil(t, roleCtx.Err())
+
+	lead <- false
+	<-roleCtx.Done()
+	jtest.Require(t, ErrLeadershipLost, context.Cause(roleCtx))
+	notLeading(t)
+
+	lead <- true
+	roleCtx = acquire(t)
+
+	// Closing the channel loses leadership for good
+	close(lead)
+	<-roleCtx.Done()
+	jtest.Require(t, ErrLeadershipLost, context.Cause(roleCtx))
+	notLeading(t)
+}
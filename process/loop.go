@@ -1,6 +1,7 @@
 package process
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"time"
@@ -8,7 +9,6 @@ import (
 	"github.com/go-stack/stack"
 	"github.com/luno/jettison/errors"
 	"github.com/luno/jettison/j"
-	"github.com/luno/jettison/log"
 	"github.com/luno/jettison/trace"
 
 	"github.com/luno/lu"
@@ -18,6 +18,19 @@ import (
 // returned as an alternative when (correctly configured) a reflex stream returns a reflex.ErrSteamToHead error.
 var ErrBreakContextLoop = errors.New("the context loop has been stopped", j.C("ERR_f3833d51676ea908"))
 
+// ErrFatal can be wrapped and returned from the function of a process to stop the process straight away, returning
+// the error, which makes the App shut down. It isn't retried whatever the options, see ErrorStop.
+var ErrFatal = errors.New("fatal process error", j.C("ERR_51c8e07a2f9b4d36"))
+
+// ErrCrashLoop is returned by a loop which has failed too many times, see WithCrashLoopLimit
+var ErrCrashLoop = errors.New("process is failing repeatedly", j.C("ERR_7c2f49b0e8d3a615"))
+
+// ErrRoleNotAcquired is returned when the role of a process isn't granted in time, see WithRoleAcquireTimeout
+var ErrRoleNotAcquired = errors.New("role not acquired in time", j.C("ERR_9d04c6b1e57a382f"))
+
+// ErrIterationPanicked is returned in place of a panic in an iteration, see WithRecoverIterations
+var ErrIterationPanicked = errors.New("process iteration panicked", j.C("ERR_2b8e61d4a90f73c5"))
+
 func defaultLoopOptions() options {
 	o := options{
 		errorSleep: ErrorSleepFor(10 * time.Second),
@@ -42,9 +55,16 @@ func noOpContextFunc(ctx context.Context) (context.Context, context.CancelFunc,
 	return ctx, func() {}, nil
 }
 
+// AlwaysRole is an AwaitRoleFunc which grants every role straight away, it means "run on every instance".
+// Use it with Scheduled or ReflexConsumer when there's only a single instance of the service, or when
+// every instance should run the process.
+func AlwaysRole(string) ContextFunc {
+	return noOpContextFunc
+}
+
 // Loop is a Process that will repeatedly call f, logging errors until the process is cancelled.
 func Loop(f lu.ProcessFunc, lo ...Option) lu.Process {
-	return ContextLoop(noOpContextFunc, f, lo...)
+	return contextLoop(noOpContextFunc, f, resolveOptions(defaultLoopOptions(), lo))
 }
 
 // Retry runs the process function until it returns no error once.
@@ -53,38 +73,73 @@ func Retry(f lu.ProcessFunc, lo ...Option) lu.Process {
 }
 
 // ContextLoop is a Process that will fetch a context and run f with that context.
-// This can be used to block execution until a context is available.
+// This can be used to block execution until a context is available, the time it takes is recorded
+// in the lu_process_context_acquire_seconds metric, see also WithContextAcquireWarning.
 func ContextLoop(getCtx ContextFunc, f lu.ProcessFunc, lo ...Option) lu.Process {
 	opts := resolveOptions(defaultLoopOptions(), lo)
+	return contextLoop(timeAcquire(getCtx, opts), f, opts)
+}
+
+func contextLoop(getCtx ContextFunc, f lu.ProcessFunc, opts options) lu.Process {
+	opts.quiescer = new(quiescer)
 	return lu.Process{
 		Name: opts.name,
 		Run:  wrapContextLoop(getCtx, f, opts),
 		Shutdown: func(ctx context.Context) error {
 			return nil
 		},
+		Quiesce: opts.quiescer.Quiesce,
 	}
 }
 
 func wrapContextLoop(getCtx ContextFunc, f lu.ProcessFunc, opts options) lu.ProcessFunc {
+	f = applyMiddleware(f, opts.middleware)
+	if opts.recoverIterations {
+		inner := f
+		f = func(ctx context.Context) error {
+			return recoverPanic(func() error { return inner(ctx) })
+		}
+	}
 	return func(ctx context.Context) error {
+		if opts.heartbeat > 0 {
+			defer heartbeat(ctx, opts)()
+		}
+		if err := lu.Wait(ctx, opts.clock, opts.initialDelay); err != nil {
+			return err
+		}
 		var errCount uint
+		crashes := crashLoop{limit: opts.crashLoopLimit, window: opts.crashLoopWindow}
+		reset := backoffReset{after: opts.backoffResetAfter}
 		for ctx.Err() == nil {
 			err := runWithContext(ctx, getCtx, func(ctx context.Context) error {
-				err := f(ctx)
+				err := runUnlessQuiesced(ctx, opts.quiescer, func() error { return f(ctx) })
 				sleep := opts.sleep()
 				if opts.isBreakableLoop && errors.Is(err, ErrBreakContextLoop) {
 					return err
 				}
-				if err != nil && !errors.IsAny(err, context.Canceled) {
+				if opts.isFailure(ctx, err) {
 					// NoReturnErr: Log critical errors and continue loop
 					errCount += 1
-					sleep = opts.errorSleep(errCount, err)
+					reset.failed()
+					sleep = opts.errorSleepFor(ctx, errCount, err)
 					opts.errCounter.Inc()
-					log.Error(ctx, err)
+					opts.logger.Error(ctx, err)
+					lu.ReportProcessError(ctx, err, errCount)
+					if opts.classify(err) == ErrorStop {
+						return err
+					}
 					if opts.maxErrors > 0 && errCount >= opts.maxErrors {
+						opts.gaveUp(ctx, errCount)
 						return err
 					}
-				} else {
+					if crashes.failed(opts.clock.Now()) {
+						return errors.Wrap(ErrCrashLoop, "", j.MKV{
+							"failures":   crashes.limit,
+							"window":     crashes.window.String(),
+							"last_error": err.Error(),
+						})
+					}
+				} else if reset.succeeded(opts.clock.Now()) {
 					errCount = 0
 				}
 				if err = lu.Wait(ctx, opts.clock, sleep); err != nil {
@@ -95,10 +150,10 @@ func wrapContextLoop(getCtx ContextFunc, f lu.ProcessFunc, opts options) lu.Proc
 				return nil
 			})
 			if errors.Is(err, ErrBreakContextLoop) {
-				log.Info(ctx, "context loop terminated", log.WithError(err))
+				opts.logger.Info(ctx, "context loop terminated", map[string]any{"reason": err.Error()})
 				return nil
 			}
-			if err != nil && !errors.Is(err, context.Canceled) {
+			if opts.isFailure(ctx, err) {
 				// NOTE: Any error returned at this point will cause the entire App to terminate
 				return err
 			}
@@ -107,6 +162,92 @@ func wrapContextLoop(getCtx ContextFunc, f lu.ProcessFunc, opts options) lu.Proc
 	}
 }
 
+// heartbeat logs that the process is alive every opts.heartbeat until ctx is cancelled or the returned func is called
+func heartbeat(ctx context.Context, opts options) func() {
+	beats := metricsFor(opts.registry).heartbeats.With(label(opts.name))
+	ctx, cancel := context.WithCancel(ctx)
+	t := opts.clock.NewTimer(opts.heartbeat)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C():
+				beats.Inc()
+				opts.logger.Info(ctx, "process alive", nil)
+				t.Reset(opts.heartbeat)
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// crashLoop keeps track of recent failures to tell when there have been too many
+type crashLoop struct {
+	limit    uint
+	window   time.Duration
+	failures []time.Time
+}
+
+// failed records a failure at now and returns true if there have been limit failures within the window
+func (c *crashLoop) failed(now time.Time) bool {
+	if c.limit == 0 {
+		return false
+	}
+	c.failures = append(c.failures, now)
+	cutoff := now.Add(-c.window)
+	for len(c.failures) > 0 && !c.failures[0].After(cutoff) {
+		c.failures = c.failures[1:]
+	}
+	return uint(len(c.failures)) >= c.limit
+}
+
+// backoffReset tells a loop when to reset its error count, see WithBackoffResetAfter
+type backoffReset struct {
+	after time.Duration
+	// since is the time of the first success after the last error
+	since time.Time
+}
+
+// succeeded records a success at now and returns true if there have been no errors for long enough
+func (b *backoffReset) succeeded(now time.Time) bool {
+	if b.after <= 0 {
+		return true
+	}
+	if b.since.IsZero() {
+		b.since = now
+	}
+	return now.Sub(b.since) >= b.after
+}
+
+func (b *backoffReset) failed() {
+	b.since = time.Time{}
+}
+
+// recoverPanic calls f, returning ErrIterationPanicked if it panics
+func recoverPanic(f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Wrap(ErrIterationPanicked, "", j.KV("panic", fmt.Sprint(r)))
+		}
+	}()
+	return f()
+}
+
+// applyMiddleware wraps f with each of mw so that the first is outermost
+func applyMiddleware(f lu.ProcessFunc, mw []Middleware) lu.ProcessFunc {
+	for i := len(mw) - 1; i >= 0; i-- {
+		f = mw[i](f)
+	}
+	return f
+}
+
 // ContextRetry runs the process function until it returns no error once.
 func ContextRetry(
 	getCtx ContextFunc,
@@ -128,11 +269,15 @@ func ContextRetry(
 
 				errCount += 1
 				// NoReturnErr: Log critical errors and continue loop
-				if !errors.Is(err, context.Canceled) {
+				if opts.isFailure(ctx, err) {
 					opts.errCounter.Inc()
-					log.Error(ctx, err)
+					opts.logger.Error(ctx, err)
+					lu.ReportProcessError(ctx, err, errCount)
+					if opts.classify(err) == ErrorStop {
+						return err
+					}
 				}
-				sleep := opts.errorSleep(errCount, err)
+				sleep := opts.errorSleepFor(ctx, errCount, err)
 				if wErr := lu.Wait(ctx, opts.clock, sleep); wErr != nil {
 					return wErr
 				}
@@ -142,12 +287,96 @@ func ContextRetry(
 			if err == nil {
 				break
 			}
+			if opts.isFailure(ctx, err) && opts.classify(err) == ErrorStop {
+				return err
+			}
 		}
 		return context.Cause(ctx)
 	}
 	return p
 }
 
+// acquireWithin wraps getCtx so that it fails with ErrRoleNotAcquired when it doesn't return within opts.roleAcquireTimeout
+func acquireWithin(getCtx ContextFunc, opts options) ContextFunc {
+	if opts.roleAcquireTimeout <= 0 {
+		return getCtx
+	}
+	return func(ctx context.Context) (context.Context, context.CancelFunc, error) {
+		acquireCtx, cancel := context.WithCancelCause(ctx)
+		t := opts.clock.NewTimer(opts.roleAcquireTimeout)
+		acquired := make(chan struct{})
+		timerDone := make(chan struct{})
+		go func() {
+			defer close(timerDone)
+			select {
+			case <-t.C():
+				cancel(ErrRoleNotAcquired)
+			case <-acquired:
+			}
+		}()
+		roleCtx, roleCancel, err := getCtx(acquireCtx)
+		close(acquired)
+		t.Stop()
+		<-timerDone
+		if ctx.Err() == nil && errors.Is(context.Cause(acquireCtx), ErrRoleNotAcquired) {
+			if err == nil {
+				roleCancel()
+			}
+			cancel(nil)
+			return nil, nil, errors.Wrap(ErrRoleNotAcquired, "", j.KV("timeout", opts.roleAcquireTimeout.String()))
+		}
+		if err != nil {
+			cancel(nil)
+			return nil, nil, err
+		}
+		return roleCtx, func() {
+			roleCancel()
+			cancel(nil)
+		}, nil
+	}
+}
+
+// defaultAcquireWarning is how long a process waits to acquire its context before it's logged, see WithContextAcquireWarning
+const defaultAcquireWarning = time.Minute
+
+// timeAcquire wraps getCtx to record how long it takes to acquire the context,
+// and to log while it's still waiting so that a process stuck waiting for its role can be seen
+func timeAcquire(getCtx ContextFunc, opts options) ContextFunc {
+	acquireSeconds := metricsFor(opts.registry).acquire.With(label(opts.name))
+	warnAfter := cmp.Or(opts.acquireWarning, defaultAcquireWarning)
+	return func(ctx context.Context) (context.Context, context.CancelFunc, error) {
+		start := opts.clock.Now()
+		acquired := make(chan struct{})
+		warnDone := make(chan struct{})
+		go func() {
+			defer close(warnDone)
+			if warnAfter < 0 {
+				return
+			}
+			t := opts.clock.NewTimer(warnAfter)
+			defer t.Stop()
+			for {
+				select {
+				case <-t.C():
+					opts.logger.Info(ctx, "still waiting to acquire context", map[string]any{
+						"waited": opts.clock.Since(start).String(),
+					})
+					t.Reset(warnAfter)
+				case <-acquired:
+					return
+				}
+			}
+		}()
+		runCtx, cancel, err := getCtx(ctx)
+		close(acquired)
+		<-warnDone
+		if err == nil {
+			acquireSeconds.Observe(opts.clock.Since(start).Seconds())
+		}
+		return runCtx, cancel, err
+	}
+}
+
 func runWithContext(ctx context.Context, getCtx ContextFunc, f lu.ProcessFunc) error {
 	runCtx, cancel, err := getCtx(ctx)
 	if err != nil {
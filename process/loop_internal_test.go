@@ -3,9 +3,18 @@ package process
 import (
 	"context"
 	"testing"
+	"time"
 
+	"github.com/luno/jettison/errors"
 	"github.com/luno/jettison/jtest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/luno/lu/test"
 )
 
 func Test_noopContextFunc(t *testing.T) {
@@ -34,3 +43,136 @@ func Test_noopContextFunc(t *testing.T) {
 		})
 	}
 }
+
+func Test_crashLoop(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := crashLoop{limit: 3, window: time.Minute}
+
+	require.False(t, c.failed(t0))
+	require.False(t, c.failed(t0.Add(30*time.Second)))
+	// The first failure has dropped out of the window
+	require.False(t, c.failed(t0.Add(61*time.Second)))
+	require.True(t, c.failed(t0.Add(62*time.Second)))
+
+	var never crashLoop
+	for i := 0; i < 10; i++ {
+		require.False(t, never.failed(t0))
+	}
+}
+
+func TestGaveUpMetric(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	fail := errors.New("failure")
+	p := Loop(
+		func(ctx context.Context) error { return fail },
+		WithName("give_up"),
+		WithRegistry(reg),
+		WithErrorSleep(0),
+		WithMaxErrors(2),
+	)
+
+	jtest.Require(t, fail, p.Run(context.Background()))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricsFor(reg).gaveUp.With(label("give_up"))))
+	assert.Equal(t, 2.0, testutil.ToFloat64(metricsFor(reg).errors.With(label("give_up"))))
+}
+
+func TestUnnamedProcessMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	fail := errors.New("failure")
+	p := Loop(
+		func(ctx context.Context) error { return fail },
+		WithName(""),
+		WithRegistry(reg),
+		WithErrorSleep(0),
+		WithMaxErrors(1),
+	)
+
+	jtest.Require(t, fail, p.Run(context.Background()))
+	errs := metricsFor(reg).errors
+	assert.Equal(t, 1.0, testutil.ToFloat64(errs.With(prometheus.Labels{processLabel: "unnamed"})))
+	assert.Equal(t, 1, testutil.CollectAndCount(errs))
+}
+
+func Test_backoffReset(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := backoffReset{after: time.Minute}
+	assert.False(t, b.succeeded(t0))
+	assert.False(t, b.succeeded(t0.Add(59*time.Second)))
+	b.failed()
+	assert.False(t, b.succeeded(t0.Add(time.Minute)))
+	assert.True(t, b.succeeded(t0.Add(2*time.Minute)))
+
+	var always backoffReset
+	assert.True(t, always.succeeded(t0))
+}
+
+func Test_timeAcquire(t *testing.T) {
+	cl := clocktesting.NewFakeClock(time.Unix(10_000, 0))
+	reg := prometheus.NewRegistry()
+	var l test.Logger
+	opts := resolveOptions(options{}, []Option{
+		WithName("waiting"),
+		WithClock(cl),
+		WithRegistry(reg),
+		WithLogger(&l),
+	})
+	release := make(chan struct{})
+	getCtx := timeAcquire(func(ctx context.Context) (context.Context, context.CancelFunc, error) {
+		<-release
+		return ctx, func() {}, nil
+	}, opts)
+
+	done := make(chan error)
+	go func() {
+		_, cancel, err := getCtx(context.Background())
+		if err == nil {
+			cancel()
+		}
+		done <- err
+	}()
+	test.AdvanceClock(t, cl, time.Minute)
+	test.AdvanceClock(t, cl, 30*time.Second)
+	close(release)
+	jtest.RequireNil(t, <-done)
+
+	assert.Equal(t, []string{"still waiting to acquire context"}, l.Infos())
+
+	mfs, err := reg.Gather()
+	jtest.RequireNil(t, err)
+	var h *dto.Histogram
+	for _, mf := range mfs {
+		if mf.GetName() == "lu_process_context_acquire_seconds" {
+			h = mf.GetMetric()[0].GetHistogram()
+		}
+	}
+	require.NotNil(t, h)
+	assert.Equal(t, uint64(1), h.GetSampleCount())
+	assert.Equal(t, 90.0, h.GetSampleSum())
+}
+
+func TestHeartbeat(t *testing.T) {
+	cl := clocktesting.NewFakeClock(time.Unix(10_000, 0))
+	reg := prometheus.NewRegistry()
+	var l test.Logger
+	ctx, cancel := context.WithCancel(context.Background())
+	p := Loop(func(ctx context.Context) error {
+		<-ctx.Done()
+		return context.Cause(ctx)
+	}, WithName("idle"), WithClock(cl), WithRegistry(reg), WithLogger(&l), WithHeartbeat(time.Minute))
+
+	done := make(chan error)
+	go func() { done <- p.Run(ctx) }()
+
+	beats := metricsFor(reg).heartbeats.With(label("idle"))
+	for i := 1; i <= 2; i++ {
+		test.AdvanceClock(t, cl, time.Minute)
+		assert.Eventually(t, func() bool {
+			return testutil.ToFloat64(beats) == float64(i)
+		}, time.Second, time.Millisecond)
+	}
+	cancel()
+	jtest.Require(t, context.Canceled, <-done)
+
+	assert.Equal(t, []string{"process alive", "process alive"}, l.Infos())
+	assert.False(t, cl.HasWaiters(), "heartbeat should stop with the process")
+}
@@ -12,7 +12,9 @@ import (
 	"k8s.io/utils/clock"
 	clock_testing "k8s.io/utils/clock/testing"
 
+	"github.com/luno/lu"
 	"github.com/luno/lu/process"
+	"github.com/luno/lu/test"
 )
 
 func ctxRetry(ctx context.Context) (context.Context, context.CancelFunc, error) {
@@ -118,7 +120,6 @@ func TestContextRetry_cancelRoleContext(t *testing.T) {
 
 func TestContextRetry_cancelLuContext(t *testing.T) {
 	chStart := make(chan struct{})
-	chDone := make(chan struct{})
 
 	fnGetRole := func(ctx context.Context) (context.Context, context.CancelFunc, error) {
 		ctx, cancel := context.WithCancel(ctx)
@@ -137,30 +138,9 @@ func TestContextRetry_cancelLuContext(t *testing.T) {
 		}),
 	)
 
-	ctx, cancel := context.WithCancel(context.Background())
-	t.Cleanup(cancel)
-
-	go func() {
-		_ = p.Run(ctx)
-		close(chDone)
-	}()
-
-	select {
-	case <-chStart:
-	case <-time.After(time.Second):
-		assert.Fail(t, "timeout wiating for process to start")
-	}
-
-	time.Sleep(time.Second * 5)
-
-	// Lu cancelles process
-	cancel()
-
-	select {
-	case <-chStart:
-	case <-time.After(time.Second):
-		assert.Fail(t, "timeout waiting for next getCtx")
-	}
+	// Lu cancels the process whilst it's sleeping after the error
+	err := test.AssertStopsWithinAfter(t, p, chStart, time.Second)
+	jtest.Require(t, context.Canceled, err)
 }
 
 // testClock is a clock.Clock implementation that returns a fakeTimer and keeps
@@ -353,3 +333,268 @@ func TestSleepContextCancelled(t *testing.T) {
 		assert.Fail(t, "timeout waiting for next getCtx")
 	}
 }
+
+func TestInitialDelay(t *testing.T) {
+	fakeClock := &testClock{
+		FakeClock: *clock_testing.NewFakeClock(time.Now()),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	var iterations int
+	p := process.Loop(
+		func(ctx context.Context) error {
+			iterations++
+			if iterations == 3 {
+				cancel()
+			}
+			return nil
+		},
+		process.WithInitialDelay(time.Minute),
+		process.WithClock(fakeClock),
+	)
+
+	err := p.Run(ctx)
+	jtest.Require(t, context.Canceled, err)
+	assert.Equal(t, 3, iterations)
+	assert.Equal(t, []time.Duration{time.Minute}, fakeClock.newTimerCalls,
+		"Expecting only the first iteration to be delayed")
+}
+
+func TestLoopReportsErrors(t *testing.T) {
+	var a lu.App
+	a.AddProcess(process.Loop(
+		func(ctx context.Context) error { return errors.New("failure") },
+		process.WithName("failing"),
+		process.WithErrorSleep(time.Hour),
+		process.WithLogger(lu.DiscardLogger{}),
+	))
+	jtest.RequireNil(t, a.Launch(context.Background()))
+	t.Cleanup(func() { jtest.RequireNil(t, a.Shutdown()) })
+
+	pe := <-a.ProcessErrors()
+	assert.Equal(t, "failing", pe.Name)
+	assert.Equal(t, uint(1), pe.ErrCount)
+	assert.EqualError(t, pe.Err, "failure")
+}
+
+func TestLoopLogger(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	var l test.Logger
+	var iterations int
+	p := process.Loop(
+		func(ctx context.Context) error {
+			iterations++
+			if iterations > 2 {
+				return process.ErrBreakContextLoop
+			}
+			return errors.New("failure")
+		},
+		process.WithErrorSleep(0),
+		process.WithBreakableLoop(),
+		process.WithLogger(&l),
+	)
+
+	err := p.Run(ctx)
+	jtest.RequireNil(t, err)
+	assert.Len(t, l.Errors(), 2)
+	assert.Equal(t, []string{"context loop terminated"}, l.Infos())
+}
+
+func TestLoopAppLogger(t *testing.T) {
+	var l test.Logger
+	a := lu.App{Logger: &l}
+	a.AddProcess(process.Loop(
+		func(ctx context.Context) error { return errors.New("failure") },
+		process.WithName("failing"),
+		process.WithErrorSleep(time.Hour),
+	))
+	jtest.RequireNil(t, a.Launch(context.Background()))
+	assert.Eventually(t, func() bool { return len(l.Errors()) == 1 }, time.Second, time.Millisecond)
+	jtest.RequireNil(t, a.Shutdown())
+}
+
+func TestLoopMiddleware(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	var calls []string
+	record := func(name string) process.Middleware {
+		return func(next lu.ProcessFunc) lu.ProcessFunc {
+			return func(ctx context.Context) error {
+				calls = append(calls, name+" before")
+				err := next(ctx)
+				calls = append(calls, name+" after")
+				return err
+			}
+		}
+	}
+
+	p := process.Loop(
+		func(ctx context.Context) error {
+			calls = append(calls, "run")
+			cancel()
+			return nil
+		},
+		process.WithMiddleware(record("outer")),
+		process.WithMiddleware(record("middle"), record("inner")),
+	)
+
+	err := p.Run(ctx)
+	jtest.Require(t, context.Canceled, err)
+	assert.Equal(t, []string{
+		"outer before", "middle before", "inner before",
+		"run",
+		"inner after", "middle after", "outer after",
+	}, calls)
+}
+
+func TestCrashLoopLimit(t *testing.T) {
+	var iterations int
+	p := process.Loop(
+		func(ctx context.Context) error {
+			iterations++
+			return errors.New("failure")
+		},
+		process.WithErrorSleep(0),
+		process.WithCrashLoopLimit(3, time.Minute),
+	)
+
+	err := p.Run(context.Background())
+	jtest.Require(t, process.ErrCrashLoop, err)
+	assert.Equal(t, 3, iterations)
+}
+
+func TestRecoverIterations(t *testing.T) {
+	var iterations int
+	p := process.Loop(
+		func(ctx context.Context) error {
+			iterations++
+			panic("oops")
+		},
+		process.WithErrorSleep(0),
+		process.WithMaxErrors(3),
+		process.WithRecoverIterations(),
+	)
+
+	err := p.Run(context.Background())
+	jtest.Require(t, process.ErrIterationPanicked, err)
+	assert.Equal(t, 3, iterations)
+}
+
+func TestCanceledAsError(t *testing.T) {
+	var iterations int
+	p := process.Loop(
+		func(ctx context.Context) error {
+			iterations++
+			return errors.Wrap(context.Canceled, "request cancelled")
+		},
+		process.WithErrorSleep(0),
+		process.WithMaxErrors(2),
+		process.WithCanceledAsError(),
+	)
+
+	err := p.Run(context.Background())
+	jtest.Require(t, context.Canceled, err)
+	assert.Equal(t, 2, iterations)
+}
+
+func TestErrorClassifier(t *testing.T) {
+	errBadRequest := errors.New("bad request")
+	var iterations int
+	p := process.Loop(
+		func(ctx context.Context) error {
+			iterations++
+			if iterations < 3 {
+				return errors.New("temporary failure")
+			}
+			return errBadRequest
+		},
+		process.WithErrorSleep(0),
+		process.WithErrorClassifier(func(err error) process.ErrorClass {
+			if errors.Is(err, errBadRequest) {
+				return process.ErrorStop
+			}
+			return process.ErrorRetry
+		}),
+	)
+
+	err := p.Run(context.Background())
+	jtest.Require(t, errBadRequest, err)
+	assert.Equal(t, 3, iterations)
+}
+
+func TestErrFatal(t *testing.T) {
+	testCases := []struct {
+		name    string
+		process func(f lu.ProcessFunc) lu.Process
+	}{
+		{
+			name: "loop",
+			process: func(f lu.ProcessFunc) lu.Process {
+				return process.Loop(f, process.WithErrorSleep(time.Hour), process.WithMaxErrors(10))
+			},
+		},
+		{
+			name: "retry",
+			process: func(f lu.ProcessFunc) lu.Process {
+				return process.Retry(f, process.WithErrorSleep(time.Hour))
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var iterations int
+			p := tc.process(func(ctx context.Context) error {
+				iterations++
+				return errors.Wrap(process.ErrFatal, "database is corrupt")
+			})
+
+			err := p.Run(context.Background())
+			jtest.Require(t, process.ErrFatal, err)
+			assert.Equal(t, 1, iterations)
+		})
+	}
+}
+
+func TestBackoffResetAfter(t *testing.T) {
+	testCases := []struct {
+		name      string
+		opts      []process.Option
+		expCounts []uint
+	}{
+		{name: "reset after success", expCounts: []uint{1, 1, 1}},
+		{name: "reset after a while", opts: []process.Option{process.WithBackoffResetAfter(time.Hour)}, expCounts: []uint{1, 2, 3}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var iterations int
+			var counts []uint
+			ctx, cancel := context.WithCancel(context.Background())
+			p := process.Loop(
+				func(ctx context.Context) error {
+					iterations++
+					if len(counts) == 3 {
+						cancel()
+						return nil
+					}
+					// Alternate between failing and succeeding
+					if iterations%2 == 1 {
+						return errors.New("flaky")
+					}
+					return nil
+				},
+				append(tc.opts, process.WithErrorSleepFunc(func(errCount uint, err error) time.Duration {
+					counts = append(counts, errCount)
+					return 0
+				}))...,
+			)
+
+			jtest.Require(t, context.Canceled, p.Run(ctx))
+			assert.Equal(t, tc.expCounts, counts)
+		})
+	}
+}
@@ -1,28 +1,137 @@
 package process
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"cmp"
+	"sync"
 
-const processLabel = "process_name"
+	"github.com/prometheus/client_golang/prometheus"
+)
 
-// label returns the prometheus labels for the process
+const (
+	processLabel = "process_name"
+	roleLabel    = "role"
+	// unnamedProcess labels the metrics of a process without a name, rather than an empty label
+	unnamedProcess = "unnamed"
+)
+
+// label returns the prometheus labels for the process, processes without a name are labelled "unnamed"
 func label(name string) prometheus.Labels {
-	return prometheus.Labels{processLabel: name}
+	return prometheus.Labels{processLabel: cmp.Or(name, unnamedProcess)}
+}
+
+func newProcessErrors() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lu_process_error_count",
+		Help: "Number of errors from running a process",
+	}, []string{processLabel})
+}
+
+func newScheduleCursorLag() *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "lu_process_schedule_cursor_lag_seconds",
+		Help: "Number of seconds since the last successful run of a scheduled process when its cursor is lagging.",
+	}, []string{processLabel})
+}
+
+func newScheduleMissedRuns() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lu_process_schedule_missed_runs_total",
+		Help: "Number of runs of a scheduled process which were skipped, or were run late to catch up.",
+	}, []string{processLabel})
+}
+
+func newProcessGaveUp() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lu_process_gave_up_total",
+		Help: "Number of times a process gave up after reaching its maximum number of errors",
+	}, []string{processLabel})
+}
+
+func newIsLeader() *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "lu_process_is_leader",
+		Help: "Set to 1 while a LeaderGate process holds its role, otherwise 0.",
+	}, []string{roleLabel})
+}
+
+func newContextAcquireSeconds() *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "lu_process_context_acquire_seconds",
+		Help:    "Time taken by a looping process to acquire its context, e.g. waiting for its role.",
+		Buckets: []float64{0.001, 0.01, 0.1, 1, 10, 60, 300, 1800},
+	}, []string{processLabel})
+}
+
+func newHeartbeats() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lu_process_heartbeat_total",
+		Help: "Number of heartbeats from a looping process configured with WithHeartbeat.",
+	}, []string{processLabel})
 }
 
 // processErrors is the number of errors from processing events
-var processErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
-	Name: "lu_process_error_count",
-	Help: "Number of errors from running a process",
-}, []string{processLabel})
-
-var scheduleCursorLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-	Name: "lu_process_schedule_cursor_lag_seconds",
-	Help: "Number of seconds since the last successful run of a scheduled process when its cursor is lagging.",
-}, []string{processLabel})
-
-func init() {
-	prometheus.MustRegister(
-		processErrors,
-		scheduleCursorLag,
-	)
+var processErrors = newProcessErrors()
+
+var scheduleCursorLag = newScheduleCursorLag()
+
+var scheduleMissedRuns = newScheduleMissedRuns()
+
+var processGaveUp = newProcessGaveUp()
+
+var isLeader = newIsLeader()
+
+var contextAcquireSeconds = newContextAcquireSeconds()
+
+var heartbeats = newHeartbeats()
+
+// processMetrics are all the metrics for processes, registered together with one prometheus.Registerer
+type processMetrics struct {
+	errors     *prometheus.CounterVec
+	cursorLag  *prometheus.GaugeVec
+	missedRuns *prometheus.CounterVec
+	gaveUp     *prometheus.CounterVec
+	isLeader   *prometheus.GaugeVec
+	acquire    *prometheus.HistogramVec
+	heartbeats *prometheus.CounterVec
+}
+
+var (
+	metricsMu  sync.Mutex
+	registered = make(map[prometheus.Registerer]processMetrics)
+)
+
+// metricsFor returns the process metrics for r, registering them with r the first time they're used.
+// When r is nil, the package level metrics are used with prometheus.DefaultRegisterer.
+func metricsFor(r prometheus.Registerer) processMetrics {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	m := processMetrics{
+		errors:     processErrors,
+		cursorLag:  scheduleCursorLag,
+		missedRuns: scheduleMissedRuns,
+		gaveUp:     processGaveUp,
+		isLeader:   isLeader,
+		acquire:    contextAcquireSeconds,
+		heartbeats: heartbeats,
+	}
+	if r == nil {
+		r = prometheus.DefaultRegisterer
+	} else {
+		m = processMetrics{
+			errors:     newProcessErrors(),
+			cursorLag:  newScheduleCursorLag(),
+			missedRuns: newScheduleMissedRuns(),
+			gaveUp:     newProcessGaveUp(),
+			isLeader:   newIsLeader(),
+			acquire:    newContextAcquireSeconds(),
+			heartbeats: newHeartbeats(),
+		}
+	}
+	if existing, ok := registered[r]; ok {
+		return existing
+	}
+	r.MustRegister(m.errors, m.cursorLag, m.missedRuns, m.gaveUp, m.isLeader, m.acquire, m.heartbeats)
+	registered[r] = m
+	return m
 }
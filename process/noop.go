@@ -2,6 +2,7 @@ package process
 
 import (
 	"context"
+	"time"
 
 	"github.com/luno/lu"
 )
@@ -16,3 +17,23 @@ func NoOp() lu.Process {
 		},
 	}
 }
+
+// Wait is a Process which doesn't do anything until the app is stopped, then it runs onStop, e.g. to clean up
+// after the other Processes. Unlike a shutdown hook, it's stopped along with the other Processes, so it can be
+// used with DependsOn and it's included in RunningProcesses.
+// onStop is given a context which isn't cancelled along with the app, but which times out after timeout,
+// it should be no longer than the app's ShutdownTimeout. An error from onStop is returned from the Process.
+func Wait(name string, timeout time.Duration, onStop func(ctx context.Context) error) lu.Process {
+	return lu.Process{
+		Name: name,
+		Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			stopCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+			defer cancel()
+			if err := onStop(stopCtx); err != nil {
+				return err
+			}
+			return context.Cause(ctx)
+		},
+	}
+}
@@ -1,10 +1,18 @@
 package process
 
 import (
+	"cmp"
+	"context"
+	"math/rand/v2"
+	"sync/atomic"
 	"time"
 
+	"github.com/luno/jettison/errors"
+	"github.com/luno/reflex"
 	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/utils/clock"
+
+	"github.com/luno/lu"
 )
 
 type options struct {
@@ -15,19 +23,80 @@ type options struct {
 	sleep SleepFunc
 	// Config for the time to sleep if an error occurs. Defaults to a constant 10s.
 	errorSleep ErrorSleepFunc
-	maxErrors  uint
-	clock      clock.Clock
+	// Overrides errorSleep whilst the process is running, when it's set. Default nil.
+	errorSleepControl *ErrorSleepControl
+	maxErrors         uint
+	clock             clock.Clock
 	// Callback function that's called after a loop iteration but before the next iteration.
 	// It's for internal use only, and shouldn't be exposed outside this package.
 	// Default is a no-op.
 	afterLoop func()
 
+	// Used for logging errors and lifecycle messages. Defaults to the Logger of the App, from lu.LoggerFromContext.
+	logger lu.Logger
+
 	// Counts the errors for a specific process, the default increments the error counter metric in metrics.go with the process name as a label.
 	errCounter prometheus.Counter
+	// Where the process metrics are registered, nil uses prometheus.DefaultRegisterer.
+	registry prometheus.Registerer
 
 	// EXPERIMENTAL: Added for the purposes of production testing isolated cases with the new breakable behaviour
 	// Flag to determine if we allow loops to break when an ErrBreakContextLoop is returned from the process function.
 	isBreakableLoop bool
+
+	// Time to wait before the first iteration. Default 0.
+	initialDelay time.Duration
+
+	// Wraps the process function for every iteration, the first is the outermost.
+	middleware []Middleware
+
+	// Creates the runID for each run of a Scheduled process. Defaults to defaultRunID.
+	runID RunIDFunc
+	// Make the runID from the start of the window of the run, without the offset of the schedule. Default false.
+	runIDFromWindow bool
+	// How long a loop must run without errors before its error count is reset. Default 0, reset after any success.
+	backoffResetAfter time.Duration
+	// Give up when there are this many errors within crashLoopWindow. Default 0, never give up.
+	crashLoopLimit  uint
+	crashLoopWindow time.Duration
+	// How often a looping process logs that it's alive. Default 0, no heartbeat.
+	heartbeat time.Duration
+	// Number of times to retry a failed run of a Scheduled process before the run fails. Default 0.
+	runRetries uint
+	// How long to wait between retries of a run. Defaults to no wait.
+	runRetryBackoff ErrorSleepFunc
+	// Convert a panic in an iteration into an error instead of crashing the app. Default false.
+	recoverIterations bool
+	// Starts a span around each run of a Scheduled process. Default nil, no spans.
+	tracer TracerFunc
+	// Options for individual specs of ManyReflexConsumers, keyed by spec name.
+	specOptions map[string][]Option
+	// Count context.Canceled from the process function as an error when the process hasn't been cancelled. Default false.
+	canceledAsError bool
+	// Reports whether an error from running a reflex consumer is expected, and so isn't an error. Defaults to reflex.IsExpected.
+	isExpected func(err error) bool
+	// Consume a reflex stream to its head when the app is quit rather than terminated. Default false.
+	drainOnQuit bool
+	// Flushed after each run of a reflex consumer, e.g. a BatchedCursorStore. Default nil, nothing is flushed.
+	cursorFlush reflex.CursorStore
+	// Chooses how each error is handled. Default nil, every error is ErrorRetry.
+	errorClassifier func(err error) ErrorClass
+	// Checked before each run of a Scheduled process, the run is held while it returns false. Default nil, always run.
+	shouldRun ShouldRunFunc
+	// Claim each run of a Scheduled process on its CompareAndSetCursor before running it. Default false.
+	claimRuns bool
+	// Key of the cursor of a Scheduled process. Defaults to the name.
+	cursorName string
+	// What a Scheduled process does when its cursor is empty. Default StartFromNow.
+	startPolicy StartPolicy
+	// Fail with ErrRoleNotAcquired when the role of a Scheduled process isn't granted within this time. Default 0, wait forever.
+	roleAcquireTimeout time.Duration
+	// Log while a process has been waiting this long to acquire its context, e.g. its role. Default one minute, negative to disable.
+	acquireWarning time.Duration
+
+	// Tracks the iterations in progress so that the process can be quiesced, nil if the process doesn't support it.
+	// It's set by the process builders rather than an Option.
+	quiescer *quiescer
 }
 
 // SleepFunc returns how long to sleep between loops when there was no error.
@@ -78,8 +147,86 @@ func MakeErrorSleepFunc(r uint, d time.Duration, backoff []uint) ErrorSleepFunc
 	}
 }
 
+// ErrorSleepControl changes how long processes sleep after an error whilst they're running, e.g. from an operator
+// endpoint to retry faster during an incident. It's given to processes with WithErrorSleepControl and a change
+// applies from their next error. The zero value doesn't change anything, it's safe to use from many goroutines.
+type ErrorSleepControl struct {
+	override atomic.Pointer[ErrorSleepFunc]
+}
+
+// Set makes the processes sleep for d after every error, instead of using their own ErrorSleepFunc
+func (c *ErrorSleepControl) Set(d time.Duration) {
+	c.SetFunc(ErrorSleepFor(d))
+}
+
+// SetFunc makes the processes use f to work out how long to sleep after an error, instead of their own ErrorSleepFunc
+func (c *ErrorSleepControl) SetFunc(f ErrorSleepFunc) {
+	c.override.Store(&f)
+}
+
+// Reset goes back to the ErrorSleepFunc each process was configured with
+func (c *ErrorSleepControl) Reset() {
+	c.override.Store(nil)
+}
+
+// Override returns the ErrorSleepFunc which the processes are using instead of their own, if it's been set
+func (c *ErrorSleepControl) Override() (ErrorSleepFunc, bool) {
+	if c == nil {
+		return nil, false
+	}
+	f := c.override.Load()
+	if f == nil {
+		return nil, false
+	}
+	return *f, true
+}
+
 var DefaultBackoff = []uint{1, 2, 5, 10, 20, 50, 100}
 
+// DecorrelatedJitterBackoff returns an ErrorSleepFunc based on the "decorrelated jitter" algorithm,
+// each sleep is a random duration between base and three times the longest sleep it could have made for the
+// previous error, capped at maxSleep. The randomness stops replicas which failed at the same time from retrying
+// at the same time. The sleep is worked out from errCount alone, so the func can be shared by many processes.
+func DecorrelatedJitterBackoff(base, maxSleep time.Duration) ErrorSleepFunc {
+	return func(errCount uint, err error) time.Duration {
+		upper := base
+		for i := uint(0); i < max(errCount, 1) && upper < 3*maxSleep; i++ {
+			upper *= 3
+		}
+		upper = min(upper, 3*maxSleep)
+		return min(maxSleep, base+rand.N(max(upper-base, 1)))
+	}
+}
+
+// ErrorClass is how a process handles an error, see WithErrorClassifier
+type ErrorClass int
+
+const (
+	// ErrorRetry retries after the error sleep, it's how errors are handled by default
+	ErrorRetry ErrorClass = iota
+	// ErrorBackoff retries after the error sleep multiplied by DefaultBackoff, so that it
+	// sleeps for longer after each consecutive error, e.g. for a temporary outage.
+	ErrorBackoff
+	// ErrorStop stops the process, returning the error, e.g. for an error which retrying won't fix.
+	// Errors wrapping ErrFatal are always ErrorStop.
+	ErrorStop
+)
+
+// StartPolicy is when a Scheduled process first runs when its cursor is empty, e.g. on the first deploy
+// or after the cursor has been cleared, see WithStartPolicy
+type StartPolicy int
+
+const (
+	// StartFromNow waits for the next time on the schedule after now, it's the default
+	StartFromNow StartPolicy = iota
+	// CatchUpFromCursor runs straight away for the last time on the schedule before now, as if the run had been missed.
+	// Schedules which can't work out their previous time, e.g. a custom Schedule without a Previous method,
+	// wait for the next time instead. Cron schedules, and schedules in ToTimezone, do catch up.
+	CatchUpFromCursor
+	// RunImmediately runs straight away, using now as the time of the run
+	RunImmediately
+)
+
 type Option func(*options)
 
 // resolveOptions applies the supplied LoopOptions to the defaults
@@ -101,12 +248,76 @@ func resolveOptions(defaults options, opts []Option) options {
 		res.afterLoop = func() {}
 	}
 	if res.errCounter == nil {
-		res.errCounter = processErrors.With(label(res.name))
+		res.errCounter = metricsFor(res.registry).errors.With(label(res.name))
+	}
+	if res.logger == nil {
+		res.logger = contextLogger{}
 	}
 
 	return res
 }
 
+// contextLogger logs with the Logger of the App which the process is run by, or lu.JettisonLogger without an App
+type contextLogger struct{}
+
+func (contextLogger) Info(ctx context.Context, msg string, fields map[string]any) {
+	lu.LoggerFromContext(ctx).Info(ctx, msg, fields)
+}
+
+func (contextLogger) Error(ctx context.Context, err error) {
+	lu.LoggerFromContext(ctx).Error(ctx, err)
+}
+
+// gaveUp records that the process has given up after reaching maxErrors
+func (o options) gaveUp(ctx context.Context, errCount uint) {
+	metricsFor(o.registry).gaveUp.With(label(o.name)).Inc()
+	o.logger.Info(ctx, "process gave up after max errors", map[string]any{"errors": errCount})
+}
+
+// errorSleepFor returns how long to sleep after an error, it won't be longer than the time left
+// before the deadline of ctx, since there's no point sleeping past when ctx will be cancelled.
+func (o options) errorSleepFor(ctx context.Context, errCount uint, err error) time.Duration {
+	errorSleep := o.errorSleep
+	if f, ok := o.errorSleepControl.Override(); ok {
+		errorSleep = f
+	}
+	sleep := errorSleep(errCount, err)
+	if o.classify(err) == ErrorBackoff && errCount > 0 {
+		sleep *= time.Duration(DefaultBackoff[min(int(errCount), len(DefaultBackoff))-1])
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		sleep = min(sleep, max(deadline.Sub(o.clock.Now()), 0))
+	}
+	return sleep
+}
+
+// classify returns how err should be handled
+func (o options) classify(err error) ErrorClass {
+	if errors.Is(err, ErrFatal) {
+		return ErrorStop
+	}
+	if o.errorClassifier == nil {
+		return ErrorRetry
+	}
+	return o.errorClassifier(err)
+}
+
+// cursorKey returns the key used for the cursor of a Scheduled process
+func (o options) cursorKey() string {
+	return cmp.Or(o.cursorName, o.name)
+}
+
+// isFailure returns true if err from running the process with ctx should be counted as an error
+func (o options) isFailure(ctx context.Context, err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) {
+		return o.canceledAsError && ctx.Err() == nil
+	}
+	return true
+}
+
 func WithName(name string) Option {
 	return func(o *options) {
 		o.name = name
@@ -156,6 +367,14 @@ func WithErrorSleepFunc(f ErrorSleepFunc) Option {
 	}
 }
 
+// WithErrorSleepControl lets c override the error sleep of the process whilst it's running, see ErrorSleepControl.
+// The same ErrorSleepControl can be given to many processes to change them all at once.
+func WithErrorSleepControl(c *ErrorSleepControl) Option {
+	return func(o *options) {
+		o.errorSleepControl = c
+	}
+}
+
 // WithClock overwrites the clock field with the value provided.
 // Mainly used during testing.
 func WithClock(clock clock.Clock) Option {
@@ -175,6 +394,244 @@ func WithMaxErrors(v uint) Option {
 	}
 }
 
+// WithErrorClassifier uses classify to choose how each error from a Loop, ContextLoop, Retry or Scheduled process
+// is handled, see ErrorClass. Errors are logged and counted whatever their class.
+func WithErrorClassifier(classify func(err error) ErrorClass) Option {
+	return func(o *options) {
+		o.errorClassifier = classify
+	}
+}
+
+// WithCrashLoopLimit makes a loop give up, returning ErrCrashLoop, when it fails n times within window.
+// Returning the error from the process stops the app, rather than the process failing indefinitely.
+// Unlike WithMaxErrors the failures don't need to be consecutive.
+func WithCrashLoopLimit(n uint, window time.Duration) Option {
+	return func(o *options) {
+		o.crashLoopLimit = n
+		o.crashLoopWindow = window
+	}
+}
+
+// WithBackoffResetAfter makes a Loop or ContextLoop only reset its count of errors once it has run without errors
+// for d, rather than after the first success. This stops the error sleep from dropping back to its shortest
+// whenever a flaky dependency succeeds once. It also means WithMaxErrors counts errors between brief successes.
+func WithBackoffResetAfter(d time.Duration) Option {
+	return func(o *options) {
+		o.backoffResetAfter = d
+	}
+}
+
+// WithHeartbeat makes a looping process log "process alive" every interval, and increment the
+// lu_process_heartbeat_total metric, whether or not it's doing any work, so that a process which is
+// idle, e.g. waiting for its role, can be told apart from one which is stuck. It stops when the process stops.
+func WithHeartbeat(interval time.Duration) Option {
+	return func(o *options) {
+		o.heartbeat = interval
+	}
+}
+
+// WithErrorCounter sets the counter incremented for every error from the process,
+// instead of the lu_process_error_count metric.
+func WithErrorCounter(c prometheus.Counter) Option {
+	return func(o *options) {
+		o.errCounter = c
+	}
+}
+
+// WithRegistry registers the metrics for the process with r instead of prometheus.DefaultRegisterer.
+// This can be used to isolate the metrics of processes, e.g. in tests.
+func WithRegistry(r prometheus.Registerer) Option {
+	return func(o *options) {
+		o.registry = r
+	}
+}
+
+// Middleware wraps the function run on each iteration of a process, e.g. to start a tracing span.
+type Middleware func(next lu.ProcessFunc) lu.ProcessFunc
+
+// WithMiddleware adds middleware around the function run on each iteration of a loop.
+// It can be used multiple times, middleware is applied in the order it's added with the first being outermost.
+func WithMiddleware(m ...Middleware) Option {
+	return func(o *options) {
+		o.middleware = append(o.middleware, m...)
+	}
+}
+
+// RunIDFunc returns the runID given to a ScheduledFunc for the run of the named process at scheduledTime
+type RunIDFunc func(name string, scheduledTime time.Time) string
+
+// WithRunIDFunc sets how the runID for each run of a Scheduled process is made.
+// By default, it's the process name and the unix time of the run, e.g. "my_process_1700000000".
+func WithRunIDFunc(f RunIDFunc) Option {
+	return func(o *options) {
+		o.runID = f
+	}
+}
+
+// WithRunIDFromWindow makes the runID of each run of a Scheduled process from the start of the window
+// the run is for, rather than from the time it runs. For a schedule made by Every with WithOffset, the
+// run at 10:05 of Every(time.Hour, WithOffset(5*time.Minute)) gets the runID for 10:00, so it matches
+// systems which key on the window. The process still runs at the offset time and the cursor isn't changed.
+// It makes no difference to schedules without an offset.
+func WithRunIDFromWindow() Option {
+	return func(o *options) {
+		o.runIDFromWindow = true
+	}
+}
+
+// TracerFunc starts a span for a run of the named Scheduled process, keyed on runID.
+// The returned context is used for the run and end is called with the result of the run once it's finished.
+type TracerFunc func(ctx context.Context, name, runID string) (_ context.Context, end func(err error))
+
+// WithTracer starts a span with f around each run of a Scheduled process,
+// so that everything done in a run is part of the same trace.
+func WithTracer(f TracerFunc) Option {
+	return func(o *options) {
+		o.tracer = f
+	}
+}
+
+// ShouldRunFunc reports whether the run of a Scheduled process at scheduledTime should happen now
+type ShouldRunFunc func(ctx context.Context, scheduledTime time.Time) (bool, error)
+
+// WithClaimRuns makes a Scheduled process claim each run before doing it, by moving its cursor on with
+// CompareAndSet only if it still holds the last run. When another instance has already claimed the run, e.g. during
+// a handover of the role, the run is skipped. A run which fails releases its claim so that it's tried again.
+// Runs are done at most once: if the instance crashes mid-run nothing releases the claim, so that run isn't retried.
+// The cursor must be a CompareAndSetCursor.
+func WithClaimRuns() Option {
+	return func(o *options) {
+		o.claimRuns = true
+	}
+}
+
+// WithShouldRun makes a Scheduled process check f before each run, e.g. for a feature flag.
+// When f returns false the run is held, without moving the cursor on, and f is checked again every
+// minute so that the run happens soon after f returns true.
+func WithShouldRun(f ShouldRunFunc) Option {
+	return func(o *options) {
+		o.shouldRun = f
+	}
+}
+
+// WithRunRetries makes a Scheduled process retry a failed run up to n times straight away,
+// waiting for backoff between each attempt, before the run is treated as failed.
+// The cursor is only moved on once a run succeeds.
+func WithRunRetries(n uint, backoff ErrorSleepFunc) Option {
+	return func(o *options) {
+		o.runRetries = n
+		o.runRetryBackoff = backoff
+	}
+}
+
+// WithRecoverIterations recovers from a panic in an iteration of a Loop, ContextLoop or Scheduled process,
+// the panic is returned as an ErrIterationPanicked error which is handled like any other error from the process,
+// so it will be logged and subject to the error sleep and WithMaxErrors.
+func WithRecoverIterations() Option {
+	return func(o *options) {
+		o.recoverIterations = true
+	}
+}
+
+// WithSpecOptions applies ol to only the spec called name when used with ManyReflexConsumers,
+// e.g. to give a noisy consumer a longer error sleep. They're applied after the options shared by all the specs.
+func WithSpecOptions(name string, ol ...Option) Option {
+	return func(o *options) {
+		if o.specOptions == nil {
+			o.specOptions = make(map[string][]Option)
+		}
+		o.specOptions[name] = append(o.specOptions[name], ol...)
+	}
+}
+
+// WithSpecRoles sets the role to await for each of the specs of ManyReflexConsumers, keyed by spec name.
+// Specs which aren't in roles use the shared role, this is the same as WithSpecOptions with WithRole for each spec.
+func WithSpecRoles(roles map[string]string) Option {
+	return func(o *options) {
+		for name, role := range roles {
+			WithSpecOptions(name, WithRole(role))(o)
+		}
+	}
+}
+
+// WithCursorName sets the key of the cursor of a Scheduled process, instead of using its name.
+// Use it to keep the position of a Scheduled process when renaming it, by setting it to the old name.
+func WithCursorName(name string) Option {
+	return func(o *options) {
+		o.cursorName = name
+	}
+}
+
+// WithStartPolicy sets when a Scheduled process first runs when its cursor is empty, see StartPolicy.
+func WithStartPolicy(p StartPolicy) Option {
+	return func(o *options) {
+		o.startPolicy = p
+	}
+}
+
+// WithRoleAcquireTimeout makes each run of a Scheduled process fail with ErrRoleNotAcquired when its role
+// isn't granted within d, rather than waiting for the role forever. The error is logged and counted like any other,
+// use WithErrorClassifier to return ErrorStop for ErrRoleNotAcquired so that it stops the app instead.
+func WithRoleAcquireTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.roleAcquireTimeout = d
+	}
+}
+
+// WithContextAcquireWarning sets how long a process can wait to acquire its context, e.g. waiting for its role,
+// before it's logged that it's still waiting. It's logged again each time the process waits for d more.
+// Defaults to one minute, a negative d turns off the logs. See also the lu_process_context_acquire_seconds metric.
+func WithContextAcquireWarning(d time.Duration) Option {
+	return func(o *options) {
+		o.acquireWarning = d
+	}
+}
+
+// WithExpectedReflexErrors uses isExpected, instead of reflex.IsExpected, to decide which errors from running a
+// reflex consumer are expected, e.g. reflex.ErrStopped, and so aren't counted or logged as errors.
+// The process is still stopped without an error when its context is cancelled, whatever isExpected returns.
+func WithExpectedReflexErrors(isExpected func(err error) bool) Option {
+	return func(o *options) {
+		o.isExpected = isExpected
+	}
+}
+
+// WithCursorFlush flushes cs whenever a reflex consumer stops, including when it reaches the head of its stream
+// or the app shuts down, so that the cursor held back by a BatchedCursorStore is committed.
+// cs should be the cursor store that the spec was built with.
+func WithCursorFlush(cs reflex.CursorStore) Option {
+	return func(o *options) {
+		o.cursorFlush = cs
+	}
+}
+
+// WithCanceledAsError counts context.Canceled returned by the process function as an error, like any other,
+// unless the context of the process itself has been cancelled. By default, context.Canceled is never counted
+// as an error, but it may come from the cancellation of something unrelated to the process, e.g. a request timeout.
+func WithCanceledAsError() Option {
+	return func(o *options) {
+		o.canceledAsError = true
+	}
+}
+
+// WithLogger sets the logger used by the process, use this to
+// capture the errors and messages logged by the process loop.
+// Defaults to the Logger of the App which runs the process.
+func WithLogger(l lu.Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// WithInitialDelay makes the process wait for d before running for the first time,
+// subsequent iterations are not delayed. Use this to spread out processes which would otherwise
+// all start at once when the app starts up.
+func WithInitialDelay(d time.Duration) Option {
+	return func(o *options) {
+		o.initialDelay = d
+	}
+}
+
 // WithBreakableLoop sets a flag that determines if when an ErrBreakContextLoop is returned
 // from a process function if that context loop itself can be allowed to terminate as well.
 // EXPERIMENTAL: Added for the purposes of production testing isolated cases with the new breakable behaviour
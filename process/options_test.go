@@ -1,15 +1,22 @@
 package process
 
 import (
+	"context"
+	"io"
 	"testing"
 	"time"
 
+	"github.com/luno/jettison/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"k8s.io/utils/clock"
 	clocktesting "k8s.io/utils/clock/testing"
 )
 
 func Test_ResolveOptions(t *testing.T) {
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_errors"})
+	reg := prometheus.NewRegistry()
 	cc := []struct {
 		name     string
 		defaults options
@@ -23,6 +30,7 @@ func Test_ResolveOptions(t *testing.T) {
 				sleep:      SleepFor(0),
 				errorSleep: ErrorSleepFor(10 * time.Second),
 				errCounter: processErrors.With(label("")),
+				logger:     contextLogger{},
 			},
 		},
 		{
@@ -34,6 +42,7 @@ func Test_ResolveOptions(t *testing.T) {
 				sleep:      SleepFor(0),
 				errorSleep: ErrorSleepFor(10 * time.Second),
 				errCounter: processErrors.With(label("test-name")),
+				logger:     contextLogger{},
 			},
 		},
 		{
@@ -44,6 +53,7 @@ func Test_ResolveOptions(t *testing.T) {
 				sleep:      SleepFor(time.Hour),
 				errorSleep: ErrorSleepFor(10 * time.Second),
 				errCounter: processErrors.With(label("")),
+				logger:     contextLogger{},
 			},
 		},
 		{
@@ -54,6 +64,7 @@ func Test_ResolveOptions(t *testing.T) {
 				sleep:      SleepFor(0),
 				errorSleep: ErrorSleepFor(3 * time.Hour),
 				errCounter: processErrors.With(label("")),
+				logger:     contextLogger{},
 			},
 		},
 		{
@@ -64,6 +75,7 @@ func Test_ResolveOptions(t *testing.T) {
 				sleep:      SleepFor(0),
 				errorSleep: ErrorSleepFor(10 * time.Second),
 				errCounter: processErrors.With(label("")),
+				logger:     contextLogger{},
 			},
 		},
 		{
@@ -74,6 +86,7 @@ func Test_ResolveOptions(t *testing.T) {
 				sleep:      SleepFor(0),
 				errorSleep: ErrorSleepFor(time.Minute),
 				errCounter: processErrors.With(label("")),
+				logger:     contextLogger{},
 			},
 		},
 		{
@@ -93,6 +106,7 @@ func Test_ResolveOptions(t *testing.T) {
 				sleep:      SleepFor(0),
 				errorSleep: ErrorSleepFor(10 * time.Second),
 				errCounter: processErrors.With(label("")),
+				logger:     contextLogger{},
 			},
 		},
 		{
@@ -103,6 +117,7 @@ func Test_ResolveOptions(t *testing.T) {
 				sleep:      SleepFor(-time.Nanosecond),
 				errorSleep: ErrorSleepFor(-time.Nanosecond),
 				errCounter: processErrors.With(label("")),
+				logger:     contextLogger{},
 			},
 		},
 		{
@@ -113,6 +128,30 @@ func Test_ResolveOptions(t *testing.T) {
 				sleep:      SleepFor(time.Hour),
 				errorSleep: ErrorSleepFor(10 * time.Second),
 				errCounter: processErrors.With(label("")),
+				logger:     contextLogger{},
+			},
+		},
+		{
+			name: "error counter",
+			opts: []Option{WithErrorCounter(counter)},
+			want: options{
+				clock:      clock.RealClock{},
+				sleep:      SleepFor(0),
+				errorSleep: ErrorSleepFor(10 * time.Second),
+				errCounter: counter,
+				logger:     contextLogger{},
+			},
+		},
+		{
+			name: "registry",
+			opts: []Option{WithRegistry(reg)},
+			want: options{
+				clock:      clock.RealClock{},
+				sleep:      SleepFor(0),
+				errorSleep: ErrorSleepFor(10 * time.Second),
+				errCounter: metricsFor(reg).errors.With(label("")),
+				registry:   reg,
+				logger:     contextLogger{},
 			},
 		},
 	}
@@ -139,3 +178,102 @@ func Test_ResolveOptions(t *testing.T) {
 		})
 	}
 }
+
+func TestWithRegistry(t *testing.T) {
+	reg1 := prometheus.NewRegistry()
+	reg2 := prometheus.NewRegistry()
+
+	o1 := resolveOptions(options{}, []Option{WithName("test"), WithRegistry(reg1)})
+	o2 := resolveOptions(options{}, []Option{WithName("test"), WithRegistry(reg2)})
+	o1.errCounter.Inc()
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricsFor(reg1).errors.With(label("test"))))
+	assert.Equal(t, 0.0, testutil.ToFloat64(o2.errCounter))
+}
+
+func TestErrorSleepFor(t *testing.T) {
+	o := resolveOptions(options{}, []Option{WithErrorSleep(10 * time.Minute)})
+
+	assert.Equal(t, 10*time.Minute, o.errorSleepFor(context.Background(), 1, nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	t.Cleanup(cancel)
+	sleep := o.errorSleepFor(ctx, 1, nil)
+	assert.LessOrEqual(t, sleep, time.Minute)
+	assert.Greater(t, sleep, 50*time.Second)
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	t.Cleanup(cancel)
+	assert.Equal(t, time.Duration(0), o.errorSleepFor(expired, 1, nil))
+
+	// The time left before the deadline is measured with the process's clock
+	cl := clocktesting.NewFakeClock(time.Now().Add(-time.Hour))
+	o = resolveOptions(options{}, []Option{WithErrorSleep(10 * time.Minute), WithClock(cl)})
+	assert.Equal(t, 10*time.Minute, o.errorSleepFor(expired, 1, nil))
+}
+
+func TestErrorSleepForBackoff(t *testing.T) {
+	o := resolveOptions(options{}, []Option{
+		WithErrorSleep(time.Second),
+		WithErrorClassifier(func(err error) ErrorClass {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return ErrorBackoff
+			}
+			return ErrorRetry
+		}),
+	})
+	ctx := context.Background()
+
+	assert.Equal(t, time.Second, o.errorSleepFor(ctx, 3, io.EOF))
+	assert.Equal(t, time.Second, o.errorSleepFor(ctx, 1, io.ErrUnexpectedEOF))
+	assert.Equal(t, 5*time.Second, o.errorSleepFor(ctx, 3, io.ErrUnexpectedEOF))
+	assert.Equal(t, 100*time.Second, o.errorSleepFor(ctx, 100, io.ErrUnexpectedEOF))
+}
+
+func TestErrorSleepControl(t *testing.T) {
+	var c ErrorSleepControl
+	o := resolveOptions(options{}, []Option{
+		WithErrorSleep(10 * time.Minute),
+		WithErrorSleepControl(&c),
+	})
+	ctx := context.Background()
+
+	_, ok := c.Override()
+	assert.False(t, ok)
+	assert.Equal(t, 10*time.Minute, o.errorSleepFor(ctx, 1, nil))
+
+	c.Set(time.Second)
+	_, ok = c.Override()
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, o.errorSleepFor(ctx, 1, nil))
+
+	c.SetFunc(func(errCount uint, err error) time.Duration {
+		return time.Duration(errCount) * time.Second
+	})
+	assert.Equal(t, 3*time.Second, o.errorSleepFor(ctx, 3, nil))
+
+	c.Reset()
+	assert.Equal(t, 10*time.Minute, o.errorSleepFor(ctx, 1, nil))
+}
+
+func TestDecorrelatedJitterBackoff(t *testing.T) {
+	base, maxSleep := 100*time.Millisecond, 5*time.Second
+	f := DecorrelatedJitterBackoff(base, maxSleep)
+
+	var reachedMax bool
+	for run := 0; run < 10; run++ {
+		upper := base
+		for errCount := uint(1); errCount <= 50; errCount++ {
+			upper = min(3*upper, 3*maxSleep)
+			sleep := f(errCount, nil)
+			assert.GreaterOrEqual(t, sleep, base)
+			assert.LessOrEqual(t, sleep, maxSleep)
+			assert.Less(t, sleep, upper)
+			reachedMax = reachedMax || sleep == maxSleep
+
+			// Sharing the func with a process which has just started failing doesn't change the range
+			assert.Less(t, f(1, nil), 3*base)
+		}
+	}
+	assert.True(t, reachedMax, "expected the sleep to be capped at some point")
+}
@@ -0,0 +1,57 @@
+package process
+
+import (
+	"context"
+	"sync"
+
+	"github.com/luno/lu"
+)
+
+// quiescer tracks the work in progress for a process so that it can stop
+// starting new work without the process being cancelled.
+// A nil *quiescer never stops work from starting.
+type quiescer struct {
+	mu       sync.Mutex
+	quiesced bool
+	running  sync.WaitGroup
+}
+
+// start reports whether new work can start, if it returns true then done must be called when the work finishes
+func (q *quiescer) start() bool {
+	if q == nil {
+		return true
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.quiesced {
+		return false
+	}
+	q.running.Add(1)
+	return true
+}
+
+func (q *quiescer) done() {
+	if q == nil {
+		return
+	}
+	q.running.Done()
+}
+
+// Quiesce stops any new work from starting and waits for work in progress to finish
+func (q *quiescer) Quiesce(ctx context.Context) error {
+	q.mu.Lock()
+	q.quiesced = true
+	q.mu.Unlock()
+	_, err := lu.WaitFor(ctx, lu.SyncGroupWait(&q.running))
+	return err
+}
+
+// runUnlessQuiesced runs f if new work can be started, otherwise it waits for ctx to be cancelled
+func runUnlessQuiesced(ctx context.Context, q *quiescer, f func() error) error {
+	if !q.start() {
+		<-ctx.Done()
+		return context.Cause(ctx)
+	}
+	defer q.done()
+	return f()
+}
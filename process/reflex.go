@@ -26,7 +26,11 @@ type RunFunc func(in context.Context, s reflex.Spec) error
 // ReflexLiveConsumer or the multiplexing capability from a ManyReflexConsumer this should
 // be your default choice to wait for a role, on a given consumer Spec, with any options
 // that need to be defined.
+// Events are consumed one at a time and the cursor is set before the next event is read from
+// the stream, so no more than one event is in flight at once, even when catching up on a backlog.
 func ReflexConsumer(awaitFunc AwaitRoleFunc, s reflex.Spec, ol ...Option) lu.Process {
+	// Label the metrics with the name of the process unless it's overridden
+	ol = append([]Option{WithName(s.Name())}, ol...)
 	return makeReflexProcess(awaitFunc, s, resolveOptions(defaultReflexOptions, ol))
 }
 
@@ -34,15 +38,45 @@ func ReflexConsumer(awaitFunc AwaitRoleFunc, s reflex.Spec, ol ...Option) lu.Pro
 // they all run on the same service instance against a given role (and all with the same set of options).
 // Unlike the other ReflexConsumer generating functions it returns a slice of lu.Process with a
 // cardinality directly related the size of the supplied specs parameter.
+// Each spec is named after its consumer, so that its metrics are labelled separately, and
+// WithSpecOptions can be used to override the shared options for a single spec.
 func ManyReflexConsumers(awaitFunc AwaitRoleFunc, specs []reflex.Spec, ol ...Option) []lu.Process {
-	opts := resolveOptions(defaultReflexOptions, ol)
+	var shared options
+	for _, opt := range ol {
+		opt(&shared)
+	}
 	ret := make([]lu.Process, 0, len(specs))
 	for _, s := range specs {
-		ret = append(ret, makeReflexProcess(awaitFunc, s, opts))
+		specOpts := append([]Option{WithName(s.Name())}, ol...)
+		specOpts = append(specOpts, shared.specOptions[s.Name()]...)
+		ret = append(ret, makeReflexProcess(awaitFunc, s, resolveOptions(defaultReflexOptions, specOpts)))
 	}
 	return ret
 }
 
+// WithDrainOnQuit makes a reflex consumer carry on consuming until it reaches the head of its stream when the app
+// receives SIGQUIT, rather than stopping straight away, so that a redeploy doesn't leave events behind.
+// It still stops if the app is terminated. The stream of the spec must be wrapped with DrainableStream,
+// so that it can be restarted with reflex.WithStreamToHead.
+func WithDrainOnQuit() Option {
+	return func(o *options) {
+		o.drainOnQuit = true
+	}
+}
+
+type drainingKey struct{}
+
+// DrainableStream wraps stream so that it's streamed with reflex.WithStreamToHead
+// when draining a consumer configured with WithDrainOnQuit.
+func DrainableStream(stream reflex.StreamFunc) reflex.StreamFunc {
+	return func(ctx context.Context, after string, opts ...reflex.StreamOption) (reflex.StreamClient, error) {
+		if ctx.Value(drainingKey{}) != nil {
+			opts = append(opts, reflex.WithStreamToHead())
+		}
+		return stream(ctx, after, opts...)
+	}
+}
+
 // ReflexLiveConsumer will run a consumer on every instance of the service
 // The stream will start from the latest event and the position is not restored on service restart.
 func ReflexLiveConsumer(stream reflex.StreamFunc, consumer reflex.Consumer) lu.Process {
@@ -53,7 +87,7 @@ func ReflexLiveConsumer(stream reflex.StreamFunc, consumer reflex.Consumer) lu.P
 		reflex.WithStreamFromHead(),
 	)
 	opts := resolveOptions(defaultReflexOptions, []Option{WithName(s.Name())})
-	return makeContextProcess(noOpContextFunc, makeProcessFunc(s, reflex.Run), s, opts)
+	return makeContextProcess(noOpContextFunc, makeProcessFunc(s, reflex.Run, opts.isExpected), s, opts)
 }
 
 // These two lu.Process generating functions handle the standard case with makeReflexProcess
@@ -69,8 +103,34 @@ func ReflexLiveConsumer(stream reflex.StreamFunc, consumer reflex.Consumer) lu.P
 // makeContextProcess but defines that the code can only execute if it can obtain a role and also
 // ensures that the loop is always potentially breakable.
 func makeReflexProcess(awaitFunc AwaitRoleFunc, s reflex.Spec, opts options) lu.Process {
-	rl := cmp.Or(opts.role, s.Name())
-	return makeContextProcess(awaitFunc(rl), makeBreakableProcessFunc(s, reflex.Run), s, opts)
+	getCtx := awaitFunc(cmp.Or(opts.role, s.Name()))
+	run := flushCursor(reflex.Run, opts.cursorFlush)
+	p := makeContextProcess(timeAcquire(getCtx, opts), makeBreakableProcessFunc(s, run, opts.isExpected), s, opts)
+	if opts.drainOnQuit {
+		p.Run = drainOnQuit(getCtx, s, p.Run, opts)
+	}
+	return p
+}
+
+// drainOnQuit runs the spec to the head of its stream once run has been cancelled,
+// as long as the app hasn't been terminated
+func drainOnQuit(getCtx ContextFunc, s reflex.Spec, run lu.ProcessFunc, opts options) lu.ProcessFunc {
+	return func(ctx context.Context) error {
+		err := run(ctx)
+		termCtx := lu.TerminationContext(ctx)
+		if !errors.Is(err, context.Canceled) || termCtx.Err() != nil {
+			return err
+		}
+		opts.logger.Info(ctx, "draining reflex consumer to head", nil)
+		drainCtx := context.WithValue(termCtx, drainingKey{}, true)
+		drainErr := runWithContext(drainCtx, getCtx, func(ctx context.Context) error {
+			return flushCursor(reflex.Run, opts.cursorFlush)(ctx, s)
+		})
+		if reflex.IsHeadReachedErr(drainErr) {
+			return err
+		}
+		return drainErr
+	}
 }
 
 // makeContextProcess is the core lu.Process generating function, it allows you to supply a
@@ -79,10 +139,20 @@ func makeReflexProcess(awaitFunc AwaitRoleFunc, s reflex.Spec, opts options) lu.
 // none breakable in the case of a ReflexLiveConsumer)
 func makeContextProcess(contextFunc ContextFunc, processFunc lu.ProcessFunc, s reflex.Spec, opts options) lu.Process {
 	opts.afterLoop = func() { _ = s.Stop() }
-	p := wrapContextLoop(contextFunc, processFunc, opts)
+	p := wrapContextLoop(contextFunc, stopOnCancel(s, processFunc), opts)
 	return lu.Process{Name: s.Name(), Run: p}
 }
 
+// stopOnCancel stops the spec as soon as ctx is cancelled while processFunc is running,
+// rather than waiting until the end of the loop iteration, so that the stream is released straight away.
+func stopOnCancel(s reflex.Spec, processFunc lu.ProcessFunc) lu.ProcessFunc {
+	return func(ctx context.Context) error {
+		stop := context.AfterFunc(ctx, func() { _ = s.Stop() })
+		defer stop()
+		return processFunc(ctx)
+	}
+}
+
 // These two process functions handle the cases where we may wish to break out
 // of a process loop (makeBreakableProcessFunc) or we can't break as for example
 // we are only starting running from the cursor head.
@@ -92,8 +162,8 @@ func makeContextProcess(contextFunc ContextFunc, processFunc lu.ProcessFunc, s r
 // translating a reflex head reached error into an lu.Process ErrBreakContextLoop
 // error so that for consumers configured with the reflex option reflex.WithStreamToHead()
 // they can correctly terminate when the cursor head has been reached.
-func makeBreakableProcessFunc(s reflex.Spec, run RunFunc) lu.ProcessFunc {
-	pf := makeProcessFunc(s, run)
+func makeBreakableProcessFunc(s reflex.Spec, run RunFunc, isExpected func(error) bool) lu.ProcessFunc {
+	pf := makeProcessFunc(s, run, isExpected)
 	return func(ctx context.Context) error {
 		err := pf(ctx)
 		if reflex.IsHeadReachedErr(err) {
@@ -104,14 +174,18 @@ func makeBreakableProcessFunc(s reflex.Spec, run RunFunc) lu.ProcessFunc {
 }
 
 // makeProcessFunc executes the given run function for the given spec and handles
-// any expected reflex errors such as contexts being cancelled. However, it should not
+// any expected reflex errors such as contexts being cancelled, as decided by isExpected
+// which defaults to reflex.IsExpected. However, it should not
 // be used as the basis for process loops that may need to terminate early such as those
 // configured with the reflex option reflex.WithStreamToHead() as unlike makeBreakableProcessFunc
 // they will not return the correct error to let the stream/loop terminate.
-func makeProcessFunc(s reflex.Spec, run RunFunc) lu.ProcessFunc {
+func makeProcessFunc(s reflex.Spec, run RunFunc, isExpected func(error) bool) lu.ProcessFunc {
+	if isExpected == nil {
+		isExpected = reflex.IsExpected
+	}
 	return func(ctx context.Context) error {
 		err := run(ctx, s)
-		if reflex.IsExpected(err) {
+		if isExpected(err) {
 			return nil
 		}
 		return err
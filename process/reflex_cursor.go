@@ -0,0 +1,106 @@
+package process
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/reflex"
+	"k8s.io/utils/clock"
+)
+
+// BatchedCursorStore wraps cs so that the cursor of a reflex consumer is committed every n events or once
+// interval has passed since the last commit, whichever comes first, rather than after every event.
+// A zero n or interval doesn't limit the batch by that measure. The interval is checked when each event
+// is consumed, there's no background commit while the stream is idle.
+// Build the spec with the store and pass it to WithCursorFlush so that the last batch is committed when
+// the consumer stops. Events after the last commit are consumed again if the app crashes.
+func BatchedCursorStore(cs reflex.CursorStore, n int, interval time.Duration) reflex.CursorStore {
+	return newBatchedCursorStore(cs, n, interval, clock.RealClock{})
+}
+
+func newBatchedCursorStore(cs reflex.CursorStore, n int, interval time.Duration, cl clock.Clock) *batchedCursorStore {
+	return &batchedCursorStore{
+		CursorStore: cs,
+		n:           n,
+		interval:    interval,
+		clock:       cl,
+		pending:     make(map[string]string),
+		lastCommit:  cl.Now(),
+	}
+}
+
+type batchedCursorStore struct {
+	reflex.CursorStore
+	n        int
+	interval time.Duration
+	clock    clock.Clock
+
+	mu         sync.Mutex
+	pending    map[string]string
+	count      int
+	lastCommit time.Time
+}
+
+// GetCursor returns the pending cursor for consumerName if it hasn't been committed yet
+func (b *batchedCursorStore) GetCursor(ctx context.Context, consumerName string) (string, error) {
+	b.mu.Lock()
+	cursor, ok := b.pending[consumerName]
+	b.mu.Unlock()
+	if ok {
+		return cursor, nil
+	}
+	return b.CursorStore.GetCursor(ctx, consumerName)
+}
+
+// SetCursor holds cursor back until the batch is full
+func (b *batchedCursorStore) SetCursor(ctx context.Context, consumerName string, cursor string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending[consumerName] = cursor
+	b.count++
+	full := b.n > 0 && b.count >= b.n
+	due := b.interval > 0 && b.clock.Since(b.lastCommit) >= b.interval
+	if !full && !due {
+		return nil
+	}
+	return b.commit(ctx)
+}
+
+// Flush commits the pending cursors and flushes the wrapped store
+func (b *batchedCursorStore) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.commit(ctx)
+}
+
+// commit sets the pending cursors on the wrapped store, mu must be held
+func (b *batchedCursorStore) commit(ctx context.Context) error {
+	for name, cursor := range b.pending {
+		if err := b.CursorStore.SetCursor(ctx, name, cursor); err != nil {
+			return err
+		}
+		delete(b.pending, name)
+	}
+	b.count = 0
+	b.lastCommit = b.clock.Now()
+	return b.CursorStore.Flush(ctx)
+}
+
+// flushCursor flushes cs after each run of the spec, before the error from the run is handled,
+// so that a batch is committed before reaching the head of the stream breaks the loop.
+// A failure to flush is returned instead of the error from the run.
+func flushCursor(run RunFunc, cs reflex.CursorStore) RunFunc {
+	if cs == nil {
+		return run
+	}
+	return func(ctx context.Context, s reflex.Spec) error {
+		err := run(ctx, s)
+		// Flush even though ctx is cancelled when the consumer is stopped
+		if flushErr := cs.Flush(context.WithoutCancel(ctx)); flushErr != nil {
+			return errors.Wrap(flushErr, "flush cursor")
+		}
+		return err
+	}
+}
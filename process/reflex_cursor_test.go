@@ -0,0 +1,73 @@
+package process
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rpatterns"
+	"github.com/stretchr/testify/assert"
+	clock_testing "k8s.io/utils/clock/testing"
+)
+
+func TestBatchedCursorStore(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingCursorStore{CursorStore: rpatterns.MemCursorStore()}
+	cl := clock_testing.NewFakeClock(time.Now())
+	b := newBatchedCursorStore(inner, 3, time.Minute, cl)
+
+	for i := 1; i <= 7; i++ {
+		jtest.RequireNil(t, b.SetCursor(ctx, "test", strconv.Itoa(i)))
+	}
+	// Committed after 3 and 6
+	assert.Equal(t, 2, inner.sets)
+	committed, err := inner.GetCursor(ctx, "test")
+	jtest.RequireNil(t, err)
+	assert.Equal(t, "6", committed)
+
+	// The pending cursor is read back before it's committed
+	pending, err := b.GetCursor(ctx, "test")
+	jtest.RequireNil(t, err)
+	assert.Equal(t, "7", pending)
+
+	// Committed once the interval has passed
+	cl.Step(time.Minute)
+	jtest.RequireNil(t, b.SetCursor(ctx, "test", "8"))
+	assert.Equal(t, 3, inner.sets)
+
+	jtest.RequireNil(t, b.SetCursor(ctx, "test", "9"))
+	jtest.RequireNil(t, b.Flush(ctx))
+	committed, err = inner.GetCursor(ctx, "test")
+	jtest.RequireNil(t, err)
+	assert.Equal(t, "9", committed)
+}
+
+// TestReflexConsumerCursorFlush tests that the last batch is committed when the head of the stream breaks the loop
+func TestReflexConsumerCursorFlush(t *testing.T) {
+	awaitFunc := func(role string) func(ctx context.Context) (context.Context, context.CancelFunc, error) {
+		return func(ctx context.Context) (context.Context, context.CancelFunc, error) {
+			return ctx, func() {}, context.Cause(ctx)
+		}
+	}
+	inner := &countingCursorStore{CursorStore: rpatterns.MemCursorStore()}
+	var committed int
+	s := &countingStream{total: 1000, committed: &committed}
+	makeStream := func(ctx context.Context, after string, opts ...reflex.StreamOption) (reflex.StreamClient, error) {
+		return s, nil
+	}
+	cstore := BatchedCursorStore(inner, 300, 0)
+	c := reflex.NewConsumer("test", func(context.Context, *reflex.Event) error { return nil })
+	spec := reflex.NewSpec(makeStream, cstore, c)
+
+	process := ReflexConsumer(awaitFunc, spec, WithBreakableLoop(), WithCursorFlush(cstore))
+	jtest.RequireNil(t, process.Run(context.Background()))
+
+	// Three full batches then the last 100 when the head was reached
+	assert.Equal(t, 4, inner.sets)
+	cursor, err := inner.GetCursor(context.Background(), "test")
+	jtest.RequireNil(t, err)
+	assert.Equal(t, "1000", cursor)
+}
@@ -0,0 +1,180 @@
+package process
+
+import (
+	"cmp"
+	"context"
+	"strings"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/reflex"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/luno/lu"
+)
+
+// MergeSpec describes one of the streams consumed by a MergedReflexConsumer.
+// Unlike a reflex.Spec it has no consumer of its own, the events are handed to the
+// shared handle function of the MergedReflexConsumer instead.
+type MergeSpec struct {
+	// Name identifies the stream, it's used as the cursor name in Cursor
+	Name string
+	// Stream is used to read events from the stream
+	Stream reflex.StreamFunc
+	// Cursor stores the position of this stream, it's only updated after the event has been handled
+	Cursor reflex.CursorStore
+	// StreamOpts are passed to Stream when it's started
+	StreamOpts []reflex.StreamOption
+}
+
+// EventOrder reports whether event a should be handled before event b
+type EventOrder func(a, b *reflex.Event) bool
+
+// ByTimestamp is an EventOrder which handles events in the order of their timestamps
+func ByTimestamp(a, b *reflex.Event) bool {
+	return a.Timestamp.Before(b.Timestamp)
+}
+
+// MergedReflexConsumer creates a lu.Process which consumes events from all the specs and passes
+// them to handle in the merged order defined by order (e.g. ByTimestamp).
+// It reads ahead from each stream so that there is an event pending from every stream, and then
+// handles the first of them according to order, which means that a stream with no new events will
+// hold back delivery from all the others.
+// The cursor for each spec is only advanced after one of its events has been handled successfully.
+// A spec whose stream reaches its head (when configured with reflex.WithStreamToHead) stops holding
+// back the others, once every stream has reached its head the process behaves like a ReflexConsumer
+// which has reached its head.
+func MergedReflexConsumer(
+	awaitFunc AwaitRoleFunc,
+	specs []MergeSpec,
+	order EventOrder,
+	handle func(ctx context.Context, e *reflex.Event) error,
+	ol ...Option,
+) lu.Process {
+	names := make([]string, 0, len(specs))
+	for _, s := range specs {
+		names = append(names, s.Name)
+	}
+	opts := resolveOptions(defaultReflexOptions, append([]Option{WithName(strings.Join(names, "+"))}, ol...))
+	rl := cmp.Or(opts.role, opts.name)
+	m := merger{specs: specs, order: order, handle: handle}
+	p := wrapContextLoop(timeAcquire(awaitFunc(rl), opts), m.run, opts)
+	return lu.Process{Name: opts.name, Run: p}
+}
+
+type merger struct {
+	specs  []MergeSpec
+	order  EventOrder
+	handle func(ctx context.Context, e *reflex.Event) error
+}
+
+// mergeItem is an event which has been read from the stream at idx, waiting to be handled
+type mergeItem struct {
+	idx    int
+	event  *reflex.Event
+	result chan error
+}
+
+// mergeGate is the consumer for each of the streams, it passes events to the merger
+// and blocks until the event has been handled so that reflex only updates the cursor afterwards.
+type mergeGate struct {
+	name   string
+	idx    int
+	offers chan<- mergeItem
+}
+
+func (g mergeGate) Name() string { return g.name }
+
+func (g mergeGate) Consume(ctx context.Context, e *reflex.Event) error {
+	item := mergeItem{idx: g.idx, event: e, result: make(chan error, 1)}
+	select {
+	case g.offers <- item:
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+	err, wErr := lu.WaitFor(ctx, item.result)
+	if wErr != nil {
+		return wErr
+	}
+	return err
+}
+
+func (m merger) run(ctx context.Context) error {
+	eg, ctx := errgroup.WithContext(ctx)
+	offers := make(chan mergeItem)
+	finished := make(chan int)
+
+	for idx, s := range m.specs {
+		spec := reflex.NewSpec(s.Stream, s.Cursor, mergeGate{name: s.Name, idx: idx, offers: offers}, s.StreamOpts...)
+		eg.Go(func() error {
+			err := reflex.Run(ctx, spec)
+			if !reflex.IsHeadReachedErr(err) {
+				return err
+			}
+			// NoReturnErr: This stream is done, the others can continue without it
+			select {
+			case finished <- idx:
+				return nil
+			case <-ctx.Done():
+				return context.Cause(ctx)
+			}
+		})
+	}
+	eg.Go(func() error {
+		return m.deliver(ctx, offers, finished)
+	})
+
+	err := eg.Wait()
+	if reflex.IsExpected(err) {
+		return nil
+	}
+	if reflex.IsHeadReachedErr(err) {
+		return errors.Wrap(ErrBreakContextLoop, err.Error())
+	}
+	return err
+}
+
+// deliver handles the pending events in order, it returns reflex.ErrHeadReached once all the streams are done
+func (m merger) deliver(ctx context.Context, offers <-chan mergeItem, finished <-chan int) error {
+	pending := make([]*mergeItem, len(m.specs))
+	done := make([]bool, len(m.specs))
+	active := len(m.specs)
+	for active > 0 {
+		if item := m.next(pending, done); item != nil {
+			err := m.handle(ctx, item.event)
+			item.result <- err
+			if err != nil {
+				return err
+			}
+			pending[item.idx] = nil
+			continue
+		}
+		select {
+		case item := <-offers:
+			pending[item.idx] = &item
+		case idx := <-finished:
+			done[idx] = true
+			active--
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+	}
+	return reflex.ErrHeadReached
+}
+
+// next returns the first pending item in order, or nil if any of the streams
+// which are still running don't yet have an event pending.
+func (m merger) next(pending []*mergeItem, done []bool) *mergeItem {
+	var first *mergeItem
+	for idx, item := range pending {
+		if item == nil {
+			if !done[idx] {
+				return nil
+			}
+			continue
+		}
+		if first == nil || m.order(item.event, first.event) {
+			first = item
+		}
+	}
+	return first
+}
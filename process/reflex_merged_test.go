@@ -0,0 +1,137 @@
+package process
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/luno/reflex"
+	"github.com/luno/reflex/rpatterns"
+	"github.com/stretchr/testify/assert"
+)
+
+// sliceStream streams the events after the cursor then returns reflex.ErrHeadReached
+type sliceStream struct {
+	events []*reflex.Event
+}
+
+func (s *sliceStream) Recv() (*reflex.Event, error) {
+	if len(s.events) == 0 {
+		return nil, reflex.ErrHeadReached
+	}
+	e := s.events[0]
+	s.events = s.events[1:]
+	return e, nil
+}
+
+func makeSliceStream(events ...*reflex.Event) reflex.StreamFunc {
+	return func(ctx context.Context, after string, opts ...reflex.StreamOption) (reflex.StreamClient, error) {
+		var from int
+		if after != "" {
+			from, _ = strconv.Atoi(after)
+		}
+		var ret []*reflex.Event
+		for _, e := range events {
+			if e.IDInt() > int64(from) {
+				ret = append(ret, e)
+			}
+		}
+		return &sliceStream{events: ret}, nil
+	}
+}
+
+func eventAt(id int, ts time.Time) *reflex.Event {
+	return &reflex.Event{ID: strconv.Itoa(id), ForeignID: strconv.Itoa(id), Timestamp: ts}
+}
+
+func TestMergedReflexConsumer(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	awaitFunc := func(role string) ContextFunc {
+		return func(ctx context.Context) (context.Context, context.CancelFunc, error) {
+			return ctx, func() {}, context.Cause(ctx)
+		}
+	}
+
+	cstore := rpatterns.MemCursorStore()
+	specs := []MergeSpec{
+		{
+			Name: "a",
+			Stream: makeSliceStream(
+				eventAt(1, t0.Add(time.Second)),
+				eventAt(2, t0.Add(4*time.Second)),
+				eventAt(3, t0.Add(5*time.Second)),
+			),
+			Cursor: cstore,
+		},
+		{
+			Name: "b",
+			Stream: makeSliceStream(
+				eventAt(11, t0),
+				eventAt(12, t0.Add(2*time.Second)),
+				eventAt(13, t0.Add(3*time.Second)),
+				eventAt(14, t0.Add(6*time.Second)),
+			),
+			Cursor: cstore,
+		},
+	}
+
+	var handled []string
+	handle := func(ctx context.Context, e *reflex.Event) error {
+		handled = append(handled, e.ID)
+		return nil
+	}
+
+	p := MergedReflexConsumer(awaitFunc, specs, ByTimestamp, handle, WithBreakableLoop())
+	assert.Equal(t, "a+b", p.Name)
+
+	err := p.Run(context.Background())
+	jtest.RequireNil(t, err)
+
+	assert.Equal(t, []string{"11", "1", "12", "13", "2", "3", "14"}, handled)
+
+	curA, err := cstore.GetCursor(context.Background(), "a")
+	jtest.RequireNil(t, err)
+	assert.Equal(t, "3", curA)
+	curB, err := cstore.GetCursor(context.Background(), "b")
+	jtest.RequireNil(t, err)
+	assert.Equal(t, "14", curB)
+}
+
+func TestMergedReflexConsumer_cursorOnlyAdvancesAfterHandling(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	awaitFunc := func(role string) ContextFunc {
+		return func(ctx context.Context) (context.Context, context.CancelFunc, error) {
+			return ctx, func() {}, context.Cause(ctx)
+		}
+	}
+
+	cstore := rpatterns.MemCursorStore()
+	specs := []MergeSpec{
+		{Name: "a", Stream: makeSliceStream(eventAt(1, t0), eventAt(2, t0.Add(2*time.Second))), Cursor: cstore},
+		{Name: "b", Stream: makeSliceStream(eventAt(11, t0.Add(time.Second))), Cursor: cstore},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handle := func(ctx context.Context, e *reflex.Event) error {
+		if e.ID == "11" {
+			cancel()
+			return context.Canceled
+		}
+		return nil
+	}
+
+	p := MergedReflexConsumer(awaitFunc, specs, ByTimestamp, handle, WithErrorSleep(0))
+	err := p.Run(ctx)
+	jtest.Require(t, context.Canceled, err)
+
+	curA, err := cstore.GetCursor(context.Background(), "a")
+	jtest.RequireNil(t, err)
+	assert.Equal(t, "1", curA)
+	curB, err := cstore.GetCursor(context.Background(), "b")
+	jtest.RequireNil(t, err)
+	assert.Equal(t, "", curB)
+}
@@ -2,12 +2,22 @@ package process
 
 import (
 	"context"
+	"strconv"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/luno/jettison/errors"
 	"github.com/luno/jettison/jtest"
 	"github.com/luno/reflex"
 	"github.com/luno/reflex/rpatterns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/luno/lu"
+	"github.com/luno/lu/test"
 )
 
 type stream struct{}
@@ -58,6 +68,40 @@ func Test_ReflexConsumer_afterLoop(t *testing.T) {
 	jtest.Require(t, context.Canceled, err)
 }
 
+// blockingConsumer blocks consuming events until it's stopped
+type blockingConsumer struct {
+	consuming chan struct{}
+	stopped   chan struct{}
+	stopOnce  sync.Once
+}
+
+func (c *blockingConsumer) Name() string { return "blocking" }
+
+func (c *blockingConsumer) Consume(ctx context.Context, event *reflex.Event) error {
+	close(c.consuming)
+	<-c.stopped
+	return reflex.ErrStopped
+}
+
+func (c *blockingConsumer) Stop() error {
+	c.stopOnce.Do(func() { close(c.stopped) })
+	return nil
+}
+
+// Test_ReflexConsumer_stopOnCancel tests that the spec is stopped as soon as the
+// context is cancelled, even in the middle of consuming an event.
+func Test_ReflexConsumer_stopOnCancel(t *testing.T) {
+	makeStream := func(ctx context.Context, after string, opts ...reflex.StreamOption) (reflex.StreamClient, error) {
+		return new(stream), nil
+	}
+	c := &blockingConsumer{consuming: make(chan struct{}), stopped: make(chan struct{})}
+	spec := reflex.NewSpec(makeStream, rpatterns.MemCursorStore(), c)
+	process := ReflexConsumer(AlwaysRole, spec)
+
+	err := test.AssertStopsWithinAfter(t, process, c.consuming, time.Second)
+	jtest.Require(t, context.Canceled, err)
+}
+
 // Test_ReflexConsumer_breakLoop tests that the process run exits with a stream returns an ErrBreakContextLoop error
 // when the stream Recv method returns reflex.ErrHeadReached i.e. a stream configured with the WithStreamToHead option.
 func Test_ReflexConsumer_breakLoop(t *testing.T) {
@@ -83,9 +127,10 @@ func Test_makeBreakableProcessFunc(t *testing.T) {
 	ctx := context.Background()
 	processingErr := errors.New("Some Error")
 	testcases := []struct {
-		name string
-		run  RunFunc
-		err  error
+		name       string
+		run        RunFunc
+		isExpected func(error) bool
+		err        error
 	}{
 		{
 			name: "None: Nil",
@@ -105,13 +150,173 @@ func Test_makeBreakableProcessFunc(t *testing.T) {
 			run:  func(_ context.Context, _ reflex.Spec) error { return processingErr },
 			err:  processingErr,
 		},
+		{
+			name:       "Error: Stopped not expected",
+			run:        func(_ context.Context, _ reflex.Spec) error { return reflex.ErrStopped },
+			isExpected: func(err error) bool { return errors.Is(err, context.Canceled) },
+			err:        reflex.ErrStopped,
+		},
+		{
+			name:       "None: Processing Error expected",
+			run:        func(_ context.Context, _ reflex.Spec) error { return processingErr },
+			isExpected: func(err error) bool { return errors.Is(err, processingErr) },
+		},
 	}
 	for _, tc := range testcases {
 		t.Run(tc.name, func(t *testing.T) {
 			var s reflex.Spec
-			p := makeBreakableProcessFunc(s, tc.run)
+			p := makeBreakableProcessFunc(s, tc.run, tc.isExpected)
 			err := p(ctx)
 			jtest.Require(t, tc.err, err)
 		})
 	}
 }
+
+// countingStream streams total events, tracking how many have been received but not committed to the cursor store
+type countingStream struct {
+	total       int
+	received    int
+	committed   *int
+	maxInFlight int
+}
+
+func (s *countingStream) Recv() (*reflex.Event, error) {
+	if s.received == s.total {
+		return nil, reflex.ErrHeadReached
+	}
+	s.received++
+	s.maxInFlight = max(s.maxInFlight, s.received-*s.committed)
+	return &reflex.Event{ID: strconv.Itoa(s.received)}, nil
+}
+
+type countingCursorStore struct {
+	reflex.CursorStore
+	sets int
+}
+
+func (c *countingCursorStore) SetCursor(ctx context.Context, name string, cursor string) error {
+	c.sets++
+	return c.CursorStore.SetCursor(ctx, name, cursor)
+}
+
+// Test_ReflexConsumer_inFlight tests that catching up on a backlog only has one event in flight at a time
+func Test_ReflexConsumer_inFlight(t *testing.T) {
+	awaitFunc := func(role string) func(ctx context.Context) (context.Context, context.CancelFunc, error) {
+		return func(ctx context.Context) (context.Context, context.CancelFunc, error) {
+			return ctx, func() {}, context.Cause(ctx)
+		}
+	}
+	cstore := &countingCursorStore{CursorStore: rpatterns.MemCursorStore()}
+	s := &countingStream{total: 1000, committed: &cstore.sets}
+	makeStream := func(ctx context.Context, after string, opts ...reflex.StreamOption) (reflex.StreamClient, error) {
+		return s, nil
+	}
+	c := reflex.NewConsumer("test", func(context.Context, *reflex.Event) error { return nil })
+	spec := reflex.NewSpec(makeStream, cstore, c)
+
+	process := ReflexConsumer(awaitFunc, spec, WithBreakableLoop())
+	err := process.Run(context.Background())
+	jtest.RequireNil(t, err)
+
+	assert.Equal(t, 1000, cstore.sets)
+	assert.Equal(t, 1, s.maxInFlight)
+}
+
+func TestReflexConsumerMetricsName(t *testing.T) {
+	makeStream := func(ctx context.Context, after string, opts ...reflex.StreamOption) (reflex.StreamClient, error) {
+		return new(stream), nil
+	}
+	failing := func(context.Context, *reflex.Event) error { return errors.New("failed") }
+	spec := reflex.NewSpec(makeStream, rpatterns.MemCursorStore(), reflex.NewConsumer("named", failing))
+	reg := prometheus.NewRegistry()
+	p := ReflexConsumer(AlwaysRole, spec, WithRegistry(reg), WithErrorSleep(0), WithMaxErrors(1))
+	assert.Equal(t, "named", p.Name)
+	assert.Error(t, p.Run(context.Background()))
+
+	errs := metricsFor(reg).errors
+	assert.Equal(t, 1.0, testutil.ToFloat64(errs.With(label("named"))))
+	assert.Zero(t, testutil.ToFloat64(errs.With(label(""))))
+}
+
+func TestManyReflexConsumers(t *testing.T) {
+	makeStream := func(ctx context.Context, after string, opts ...reflex.StreamOption) (reflex.StreamClient, error) {
+		return new(stream), nil
+	}
+	failing := func(context.Context, *reflex.Event) error { return errors.New("failed") }
+	specs := []reflex.Spec{
+		reflex.NewSpec(makeStream, rpatterns.MemCursorStore(), reflex.NewConsumer("a", failing)),
+		reflex.NewSpec(makeStream, rpatterns.MemCursorStore(), reflex.NewConsumer("b", failing)),
+	}
+	reg := prometheus.NewRegistry()
+	ps := ManyReflexConsumers(AlwaysRole, specs,
+		WithRegistry(reg),
+		WithErrorSleep(0),
+		WithMaxErrors(1),
+		WithSpecOptions("b", WithMaxErrors(2)),
+	)
+	assert.Len(t, ps, 2)
+
+	for _, p := range ps {
+		assert.Error(t, p.Run(context.Background()))
+	}
+
+	errs := metricsFor(reg).errors
+	assert.Equal(t, 1.0, testutil.ToFloat64(errs.With(label("a"))))
+	assert.Equal(t, 2.0, testutil.ToFloat64(errs.With(label("b"))))
+}
+
+func TestManyReflexConsumersSpecRoles(t *testing.T) {
+	makeStream := func(ctx context.Context, after string, opts ...reflex.StreamOption) (reflex.StreamClient, error) {
+		return new(stream), nil
+	}
+	consume := func(context.Context, *reflex.Event) error { return nil }
+	specs := []reflex.Spec{
+		reflex.NewSpec(makeStream, rpatterns.MemCursorStore(), reflex.NewConsumer("read_model", consume)),
+		reflex.NewSpec(makeStream, rpatterns.MemCursorStore(), reflex.NewConsumer("notify", consume)),
+		reflex.NewSpec(makeStream, rpatterns.MemCursorStore(), reflex.NewConsumer("other", consume)),
+	}
+	var roles []string
+	awaitFunc := func(role string) ContextFunc {
+		roles = append(roles, role)
+		return AlwaysRole(role)
+	}
+	ManyReflexConsumers(awaitFunc, specs, WithSpecRoles(map[string]string{
+		"read_model": "read_models",
+		"notify":     "notifications",
+	}))
+	assert.Equal(t, []string{"read_models", "notifications", "other"}, roles)
+}
+
+func TestDrainOnQuit(t *testing.T) {
+	var toHead []bool
+	makeStream := func(ctx context.Context, after string, opts ...reflex.StreamOption) (reflex.StreamClient, error) {
+		var so reflex.StreamOptions
+		for _, opt := range opts {
+			opt(&so)
+		}
+		toHead = append(toHead, so.StreamToHead)
+		if so.StreamToHead {
+			return new(headStream), nil
+		}
+		return new(stream), nil
+	}
+	c := &blockingConsumer{consuming: make(chan struct{}), stopped: make(chan struct{})}
+	spec := reflex.NewSpec(DrainableStream(makeStream), rpatterns.MemCursorStore(), c)
+	p := ReflexConsumer(AlwaysRole, spec, WithDrainOnQuit())
+
+	ac := lu.NewAppContext(context.Background())
+	t.Cleanup(ac.Stop)
+	done := make(chan error)
+	go func() { done <- p.Run(ac.AppContext) }()
+
+	<-c.consuming
+	jtest.RequireNil(t, syscall.Kill(syscall.Getpid(), syscall.SIGQUIT))
+
+	select {
+	case err := <-done:
+		jtest.Require(t, context.Canceled, err)
+	case <-time.After(time.Second):
+		t.Fatal("consumer didn't drain")
+	}
+	assert.Equal(t, []bool{false, true}, toHead)
+}
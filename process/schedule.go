@@ -1,6 +1,7 @@
 package process
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"strconv"
@@ -14,6 +15,12 @@ import (
 	"github.com/luno/lu"
 )
 
+// shouldRunRecheck is how long a run is held for before checking WithShouldRun again
+const shouldRunRecheck = time.Minute
+
+// errRunHeld is returned by doNext when WithShouldRun holds back the run, it's tried again after shouldRunRecheck
+var errRunHeld = errors.New("scheduled run held", j.C("ERR_5e81d3a07c2b94f6"))
+
 func defaultScheduleOptions() options {
 	return options{
 		errorSleep: ErrorSleepFor(10 * time.Minute),
@@ -23,6 +30,7 @@ func defaultScheduleOptions() options {
 // previousAware if a Schedule object implements the previousAware, it will use this method to determine
 // when the last expected run was. This can be used to determine if there were missed intervals between
 // the actual last run and the expected last run.
+// Previous returns the zero time when it can't find the last run, e.g. when it's too long ago to look for.
 type previousAware interface {
 	Previous(now time.Time) time.Time
 }
@@ -32,35 +40,79 @@ type Schedule cron.Schedule
 
 type cronWithPrevious struct {
 	cron.Schedule
+	spec string
+	// maxLookBack is how far back Previous looks for the last run, DefaultCronMaxLookBack when it's zero
+	maxLookBack time.Duration
 }
 
-const maxLookBack = 1000 * 24 * time.Hour
+// DefaultCronMaxLookBack is how far back a cron schedule looks for its last run, see WithMaxLookBack
+const DefaultCronMaxLookBack = 1000 * 24 * time.Hour
 
+// CronOption configures a Schedule made by ParseCron
+type CronOption func(c *cronWithPrevious)
+
+// WithMaxLookBack sets how far back the cron schedule looks for its last run, it defaults to DefaultCronMaxLookBack.
+// Increase it for schedules which run less often, e.g. only on the 29th of February, so that missed runs are caught up.
+// When there's no run within d, the last run isn't known and the schedule runs at its next time as normal.
+func WithMaxLookBack(d time.Duration) CronOption {
+	return func(c *cronWithPrevious) {
+		c.maxLookBack = d
+	}
+}
+
+// Previous returns the last time the schedule fired at or before now, or the zero time if
+// it didn't fire within the max look back.
+// It first doubles a look back window from the next run until the window contains an earlier run,
+// then binary searches the window for the latest time which still has a run between it and next.
+// Cron schedules fire on whole seconds, so we stop searching once the window is a second wide.
 func (c cronWithPrevious) Previous(now time.Time) time.Time {
 	lookBack := 10 * time.Minute
 	next := c.Next(now)
-	prev := next
-	for prev.Equal(next) {
-		if lookBack > maxLookBack {
-			return now
-		}
-		t := next.Add(-lookBack)
+	// hasRunBeforeNext is true for any time before the previous run and false from the previous run onwards
+	hasRunBeforeNext := func(t time.Time) bool {
+		return c.Next(t).Before(next)
+	}
+
+	lo := next.Add(-lookBack)
+	for !hasRunBeforeNext(lo) {
 		lookBack = lookBack * 2
-		prev = c.Next(t)
+		if lookBack > cmp.Or(c.maxLookBack, DefaultCronMaxLookBack) {
+			return time.Time{}
+		}
+		lo = next.Add(-lookBack)
 	}
-	t := prev
-	for !t.Equal(next) {
-		prev, t = t, c.Next(prev)
+
+	// Next(hi) is next, so the previous run is in (lo, hi]
+	hi := now
+	for hi.Sub(lo) > time.Second {
+		mid := lo.Add(hi.Sub(lo) / 2)
+		if hasRunBeforeNext(mid) {
+			lo = mid
+		} else {
+			hi = mid
+		}
 	}
-	return prev
+	return c.Next(lo)
 }
 
-func ParseCron(cronStr string) (Schedule, error) {
+func (c cronWithPrevious) String() string {
+	if c.spec != "" {
+		return c.spec
+	}
+	return describeSchedule(c.Schedule)
+}
+
+// ParseCron parses a standard cron spec, e.g. "0 9 * * 1-5", into a Schedule which can catch up on missed runs.
+func ParseCron(cronStr string, opts ...CronOption) (Schedule, error) {
 	s, err := cron.ParseStandard(cronStr)
 	if err != nil {
 		return nil, err
 	}
-	return cronWithPrevious{Schedule: s}, nil
+	c := cronWithPrevious{Schedule: s, spec: cronStr}
+	for _, o := range opts {
+		o(&c)
+	}
+	return c, nil
 }
 
 type waitSchedule struct {
@@ -72,8 +124,17 @@ func (r waitSchedule) Next(t time.Time) time.Time {
 	return t.Add(r.Wait)
 }
 
+func (r waitSchedule) String() string {
+	return fmt.Sprintf("%v after the last run", r.Wait)
+}
+
 // Poll returns a schedule which runs on a given minimum delay (wait) between successful runs.
+// A wait of zero runs again straight away, each run is for the time it starts so that the cursor
+// keeps moving on. It panics if wait is negative.
 func Poll(wait time.Duration) Schedule {
+	if wait < 0 {
+		panic(fmt.Sprintln("invalid poll wait", wait))
+	}
 	return waitSchedule{Wait: wait}
 }
 
@@ -85,6 +146,15 @@ func WithOffset(offset time.Duration) EveryOption {
 	}
 }
 
+// WithAnchor aligns the periods of Every to anchor rather than to the zero time, e.g. with a period
+// of 7*24*time.Hour and an anchor of midnight on Wednesday 2024-01-03 it runs at midnight every Wednesday.
+// The offset, from WithOffset, is added to the anchored times.
+func WithAnchor(anchor time.Time) EveryOption {
+	return func(s *intervalSchedule) {
+		s.Anchor = anchor
+	}
+}
+
 func WithDescription(desc string) EveryOption {
 	return func(s *intervalSchedule) {
 		s.Description = desc
@@ -94,12 +164,17 @@ func WithDescription(desc string) EveryOption {
 // Every returns a schedule which returns a time equally spaced with a period.
 // e.g. if period is time.Hour and Offset is 5*time.Minute then this schedule will return
 // 12:05, 13:05, 14:05, etc...
-// The time is truncated to the period based on unix time (see time.Truncate for details)
+// The time is truncated to the period since the zero time (see time.Truncate for details),
+// unless the period is aligned to another time using WithAnchor.
+// It panics if period isn't positive, since the schedule would never move on.
 func Every(period time.Duration, opts ...EveryOption) Schedule {
 	return newIntervalSchedule(period, opts...)
 }
 
 func newIntervalSchedule(period time.Duration, opts ...EveryOption) intervalSchedule {
+	if period <= 0 {
+		panic(fmt.Sprintln("invalid period for every", period))
+	}
 	s := intervalSchedule{Period: period}
 	for _, o := range opts {
 		o(&s)
@@ -114,10 +189,25 @@ type intervalSchedule struct {
 	Period time.Duration
 	// Offset is the lag within the period before the first (and subsequent) firing of the Interval
 	Offset time.Duration
+	// Anchor is the time which the periods are aligned to, the zero time when it isn't set
+	Anchor time.Time
+}
+
+// truncate returns the start of the period containing t
+func (r intervalSchedule) truncate(t time.Time) time.Time {
+	if r.Anchor.IsZero() {
+		return t.Truncate(r.Period)
+	}
+	since := t.Sub(r.Anchor)
+	periods := since / r.Period
+	if since < 0 && since%r.Period != 0 {
+		periods--
+	}
+	return r.Anchor.Add(periods * r.Period).In(t.Location())
 }
 
 func (r intervalSchedule) Next(t time.Time) time.Time {
-	next := t.Truncate(r.Period).Add(r.Offset)
+	next := r.truncate(t).Add(r.Offset)
 	if !next.After(t) {
 		next = next.Add(r.Period)
 	}
@@ -128,7 +218,7 @@ func (r intervalSchedule) Next(t time.Time) time.Time {
 // actual last run time and ensure that the process only runs once for all the intervals in between the
 // last run time and "now".
 func (r intervalSchedule) Previous(now time.Time) time.Time {
-	prev := now.Truncate(r.Period).Add(r.Offset)
+	prev := r.truncate(now).Add(r.Offset)
 	if prev.After(now) {
 		prev = prev.Add(-1 * r.Period)
 	}
@@ -136,6 +226,67 @@ func (r intervalSchedule) Previous(now time.Time) time.Time {
 	return prev
 }
 
+// windowStart returns the start of the period which the run at t is for, without the offset
+func (r intervalSchedule) windowStart(t time.Time) time.Time {
+	return r.truncate(t.Add(-r.Offset))
+}
+
+func (r intervalSchedule) String() string {
+	if r.Description != "" {
+		return r.Description
+	}
+	desc := fmt.Sprintf("every %v", r.Period)
+	if !r.Anchor.IsZero() {
+		desc += fmt.Sprintf(" from %v", r.Anchor.Format(time.RFC3339))
+	}
+	if r.Offset != 0 {
+		desc += fmt.Sprintf(" offset by %v", r.Offset)
+	}
+	return desc
+}
+
+// ErrScheduleNeverRuns is returned by ValidateSchedule for schedules which don't run within the horizon
+var ErrScheduleNeverRuns = errors.New("schedule doesn't run", j.C("ERR_3e8a61f0b4c7d259"))
+
+// UpcomingRuns returns the next n times that s will run after from, e.g. to show
+// them when the schedule is being configured.
+// It returns fewer than n times if the schedule stops running.
+func UpcomingRuns(s Schedule, from time.Time, n int) []time.Time {
+	ret := make([]time.Time, 0, n)
+	t := from
+	for len(ret) < n {
+		next := s.Next(t)
+		if next.IsZero() || !next.After(t) {
+			break
+		}
+		ret = append(ret, next)
+		t = next
+	}
+	return ret
+}
+
+// ValidateSchedule returns ErrScheduleNeverRuns if s doesn't run after from and within horizon of it,
+// e.g. for the cron "0 0 31 2 *" which would run on the 31st of February.
+func ValidateSchedule(s Schedule, from time.Time, horizon time.Duration) error {
+	next := s.Next(from)
+	if next.IsZero() || !next.After(from) || next.Sub(from) > horizon {
+		return errors.Wrap(ErrScheduleNeverRuns, "", j.MKV{
+			"schedule": describeSchedule(s),
+			"horizon":  horizon.String(),
+		})
+	}
+	return nil
+}
+
+// describeSchedule returns a human readable description of when s runs,
+// custom schedules are described by their String method if they have one
+func describeSchedule(s Schedule) string {
+	if str, ok := s.(fmt.Stringer); ok {
+		return str.String()
+	}
+	return fmt.Sprintf("%T", s)
+}
+
 // FixedInterval is deprecated.
 // Deprecated: Use Every.
 var FixedInterval = Every
@@ -166,10 +317,156 @@ func (s timeOfDaySchedule) Next(t time.Time) time.Time {
 	)
 }
 
+func (s timeOfDaySchedule) String() string {
+	return fmt.Sprintf("daily at %02d:%02d", s.Hour, s.Minute)
+}
+
+// TimeOfDayIn returns a Schedule that will trigger at hour:minute every day in the timezone tz.
+// Unlike using TimeOfDay with ToTimezone, it has well-defined behaviour over daylight savings changes:
+//   - When the clocks go forward past hour:minute, so that it doesn't exist on that day,
+//     it triggers at the end of the gap instead, e.g. 03:00 when the clocks skip from 02:00 to 03:00.
+//   - When the clocks go back, so that hour:minute happens twice on that day, it triggers
+//     only the first time.
+func TimeOfDayIn(hour, minute int, tz *time.Location) Schedule {
+	return timeOfDayInSchedule{Hour: hour, Minute: minute, TZ: tz}
+}
+
+type timeOfDayInSchedule struct {
+	Hour, Minute int
+	TZ           *time.Location
+}
+
+// on returns when the schedule triggers on the day of t in the schedule's timezone, offset by days
+func (s timeOfDayInSchedule) on(t time.Time, days int) time.Time {
+	t = t.In(s.TZ)
+	ti := time.Date(t.Year(), t.Month(), t.Day()+days, s.Hour, s.Minute, 0, 0, s.TZ)
+	start, end := ti.ZoneBounds()
+	if ti.Hour() != s.Hour || ti.Minute() != s.Minute {
+		// The time doesn't exist, pick the transition at the end of the gap
+		if ti.Hour()*60+ti.Minute() < s.Hour*60+s.Minute {
+			return end
+		}
+		return start
+	}
+	if !start.IsZero() {
+		// If the clocks went back, the same time might have happened before the transition
+		_, prevOffset := start.Add(-time.Nanosecond).Zone()
+		_, offset := ti.Zone()
+		earlier := ti.Add(-time.Duration(prevOffset-offset) * time.Second)
+		if earlier.Before(start) && earlier.Hour() == s.Hour && earlier.Minute() == s.Minute {
+			return earlier
+		}
+	}
+	return ti
+}
+
+func (s timeOfDayInSchedule) Next(t time.Time) time.Time {
+	next := s.on(t, 0)
+	if !next.After(t) {
+		next = s.on(t, 1)
+	}
+	return next.In(t.Location())
+}
+
+// Previous returns the last run at or before now
+func (s timeOfDayInSchedule) Previous(now time.Time) time.Time {
+	prev := s.on(now, 0)
+	if prev.After(now) {
+		prev = s.on(now, -1)
+	}
+	return prev.In(now.Location())
+}
+
+func (s timeOfDayInSchedule) String() string {
+	return fmt.Sprintf("daily at %02d:%02d in %s", s.Hour, s.Minute, s.TZ)
+}
+
+// Weekly returns a Schedule that will trigger once a week on weekday at hour:minute,
+// hour is based on the 24-hour clock.
+func Weekly(weekday time.Weekday, hour, minute int) Schedule {
+	return weeklySchedule{Weekday: weekday, Hour: hour, Minute: minute}
+}
+
+type weeklySchedule struct {
+	Weekday      time.Weekday
+	Hour, Minute int
+}
+
+// at returns the time of the run in the week of t, offset by weeks
+func (s weeklySchedule) at(t time.Time, weeks int) time.Time {
+	days := int(s.Weekday-t.Weekday()) + 7*weeks
+	return time.Date(t.Year(), t.Month(), t.Day()+days, s.Hour, s.Minute, 0, 0, t.Location())
+}
+
+func (s weeklySchedule) Next(t time.Time) time.Time {
+	next := s.at(t, 0)
+	if !next.After(t) {
+		next = s.at(t, 1)
+	}
+	return next
+}
+
+// Previous returns the last run at or before now
+func (s weeklySchedule) Previous(now time.Time) time.Time {
+	prev := s.at(now, 0)
+	if prev.After(now) {
+		prev = s.at(now, -1)
+	}
+	return prev
+}
+
+func (s weeklySchedule) String() string {
+	return fmt.Sprintf("weekly on %v at %02d:%02d", s.Weekday, s.Hour, s.Minute)
+}
+
+// Monthly returns a Schedule that will trigger once a month on dayOfMonth at hour:minute,
+// hour is based on the 24-hour clock.
+// In months which are shorter than dayOfMonth, e.g. 31 in February, it triggers on the last day of the month.
+func Monthly(dayOfMonth, hour, minute int) Schedule {
+	return monthlySchedule{Day: dayOfMonth, Hour: hour, Minute: minute}
+}
+
+type monthlySchedule struct {
+	Day, Hour, Minute int
+}
+
+// at returns the time of the run in the month of t, offset by months
+func (s monthlySchedule) at(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, t.Location())
+	lastDay := first.AddDate(0, 1, -1).Day()
+	return time.Date(first.Year(), first.Month(), min(s.Day, lastDay), s.Hour, s.Minute, 0, 0, t.Location())
+}
+
+func (s monthlySchedule) Next(t time.Time) time.Time {
+	next := s.at(t, 0)
+	if !next.After(t) {
+		next = s.at(t, 1)
+	}
+	return next
+}
+
+// Previous returns the last run at or before now
+func (s monthlySchedule) Previous(now time.Time) time.Time {
+	prev := s.at(now, 0)
+	if prev.After(now) {
+		prev = s.at(now, -1)
+	}
+	return prev
+}
+
+func (s monthlySchedule) String() string {
+	return fmt.Sprintf("monthly on day %d at %02d:%02d", s.Day, s.Hour, s.Minute)
+}
+
 // ToTimezone can be used when a schedule is to be run in a particular timezone.
 // When using this with zones that observe daylight savings, it's important to be aware of the caveats around
 // the boundaries of daylight savings - unit tests demonstrate times being skipped in some cases.
+// If s knows when it previously ran, e.g. Weekly or Monthly, then so will the returned Schedule.
 func ToTimezone(s cron.Schedule, tz *time.Location) cron.Schedule {
+	s = withPrevious(s)
+	if _, ok := s.(previousAware); ok {
+		return tzPreviousSchedule{tzSchedule{s: s, tz: tz}}
+	}
 	return tzSchedule{s: s, tz: tz}
 }
 
@@ -183,6 +480,27 @@ func (s tzSchedule) Next(t time.Time) time.Time {
 	return nxt.In(t.Location())
 }
 
+func (s tzSchedule) windowStart(t time.Time) time.Time {
+	return windowStart(s.s, t.In(s.tz)).In(t.Location())
+}
+
+func (s tzSchedule) String() string {
+	return describeSchedule(s.s) + " in " + s.tz.String()
+}
+
+// tzPreviousSchedule is a tzSchedule for schedules which are previousAware
+type tzPreviousSchedule struct {
+	tzSchedule
+}
+
+func (s tzPreviousSchedule) Previous(now time.Time) time.Time {
+	prev := s.s.(previousAware).Previous(now.In(s.tz))
+	if prev.IsZero() {
+		return prev
+	}
+	return prev.In(now.Location())
+}
+
 type (
 	// ContextFunc should create a child context of ctx and return a cancellation function
 	// the cancel function will be called after the process has been executed
@@ -197,37 +515,79 @@ type Cursor interface {
 	Set(ctx context.Context, name string, value string) error
 }
 
+// RunIDCursor is a Cursor which can also store the runID of the run which moved it on,
+// e.g. in the same transaction, so that a store can tell which runs have completed.
+// Scheduled processes call SetWithRunID instead of Set when their Cursor implements it.
+type RunIDCursor interface {
+	Cursor
+	SetWithRunID(ctx context.Context, name, value, runID string) error
+}
+
+// CompareAndSetCursor is a Cursor which can atomically set a value only when it holds an expected value,
+// it's needed by WithClaimRuns.
+type CompareAndSetCursor interface {
+	Cursor
+	// CompareAndSet sets name to value if it's currently old, which is empty when name isn't set.
+	// It returns false, without an error, when name holds something else.
+	CompareAndSet(ctx context.Context, name, old, value string) (bool, error)
+}
+
 // Scheduled will create a lu.Process which executes according to a Schedule
+//
+// When the process has missed runs, e.g. while the app wasn't running, it only does the latest of them if when knows
+// its previous run, like the schedules in this package and cron schedules. A cron.Schedule parsed with the cron
+// package is given a previous run in the same way as ParseCron. Other schedules catch up by running each missed run
+// in turn, starting from the run after the cursor.
 func Scheduled(awaitFunc AwaitRoleFunc, curs Cursor,
 	name string, when Schedule, f ScheduledFunc,
 	ol ...Option,
 ) lu.Process {
+	when = withPrevious(when)
 	opts := resolveOptions(defaultScheduleOptions(), append(ol, WithName(name)))
+	opts.quiescer = new(quiescer)
 
 	if opts.role == "" {
 		opts.role = opts.name
 	}
 
 	runner := scheduleRunner{cursor: curs, o: opts, when: when, f: f}
-	process := func(ctx context.Context) time.Duration { return processOnce(ctx, awaitFunc, opts, &runner) }
+	process := func(ctx context.Context) (time.Duration, error) { return processOnce(ctx, awaitFunc, opts, &runner) }
 	wait := func(ctx context.Context, sleep time.Duration) error { return lu.Wait(ctx, opts.clock, sleep) }
-	loop := func(ctx context.Context) error { return processLoop(ctx, process, wait) }
+	loop := func(ctx context.Context) error {
+		if err := wait(ctx, opts.initialDelay); err != nil {
+			return err
+		}
+		return processLoop(ctx, process, wait)
+	}
 
 	return lu.Process{
-		Name: opts.name,
-		Run:  loop,
+		Name:      opts.name,
+		Run:       loop,
+		Quiesce:   opts.quiescer.Quiesce,
+		Schedules: []lu.ScheduleInfo{runner.info()},
 	}
 }
 
+// withPrevious wraps a schedule from the cron package so that it knows when it previously ran, like ParseCron
+func withPrevious(s Schedule) Schedule {
+	if spec, ok := s.(*cron.SpecSchedule); ok {
+		return cronWithPrevious{Schedule: spec}
+	}
+	return s
+}
+
 type (
-	processFunc func(context.Context) time.Duration
+	processFunc func(context.Context) (time.Duration, error)
 	waitFunc    func(context.Context, time.Duration) error
 )
 
 // processLoop may panic if processOnce or wait is nil.
 func processLoop(ctx context.Context, process processFunc, wait waitFunc) error {
 	for ctx.Err() == nil {
-		sleep := process(ctx)
+		sleep, err := process(ctx)
+		if err != nil {
+			return err
+		}
 		if err := wait(ctx, sleep); err != nil {
 			return err
 		}
@@ -239,19 +599,29 @@ func processLoop(ctx context.Context, process processFunc, wait waitFunc) error
 // it may also panic if opts.sleep or opts.errSleep are nil as well; which can be avoided by
 // calling resolveOptions on the opts parameter before passing it into this function; it my also panic if
 // runner.f is nil as well.
-func processOnce(ctx context.Context, awaitRole AwaitRoleFunc, opts options, runner *scheduleRunner) time.Duration {
-	err := runWithContext(ctx, awaitRole(opts.role), runner.doNext)
+// It only returns an error when the process should stop, see ErrorStop.
+func processOnce(ctx context.Context, awaitRole AwaitRoleFunc, opts options, runner *scheduleRunner) (time.Duration, error) {
+	err := runWithContext(ctx, acquireWithin(awaitRole(opts.role), opts), runner.doNext)
 	sleep := opts.sleep()
-	if err != nil && !errors.Is(err, context.Canceled) {
+	runner.held = errors.Is(err, errRunHeld)
+	if runner.held {
+		// NoReturnErr: Not an error, check again later
+		return shouldRunRecheck, nil
+	}
+	if opts.isFailure(ctx, err) {
 		// NoReturnErr: Log critical errors and continue loop
 		runner.ErrCount++
-		sleep = opts.errorSleep(runner.ErrCount, err)
+		sleep = opts.errorSleepFor(ctx, runner.ErrCount, err)
 		opts.errCounter.Inc()
-		log.Error(ctx, err)
+		opts.logger.Error(ctx, err)
+		lu.ReportProcessError(ctx, err, runner.ErrCount)
+		if opts.classify(err) == ErrorStop {
+			return 0, err
+		}
 	} else {
 		runner.ErrCount = 0
 	}
-	return sleep
+	return sleep, nil
 }
 
 type scheduleRunner struct {
@@ -259,49 +629,188 @@ type scheduleRunner struct {
 	o      options
 	when   Schedule
 	f      ScheduledFunc
+	// at is the time of the next run when it's already known, otherwise it's worked out from the cursor
+	at time.Time
+	// held is set when the last run was held back by WithShouldRun
+	held bool
 
 	ErrCount uint
 }
 
+// info describes the schedule and reads the last and next run times from the cursor
+func (r scheduleRunner) info() lu.ScheduleInfo {
+	return lu.ScheduleInfo{
+		Name:        r.o.name,
+		Description: describeSchedule(r.when),
+		LastRun: func(ctx context.Context) (time.Time, error) {
+			return getLastRun(ctx, r.cursor, r.o.cursorKey())
+		},
+		NextRun: func(ctx context.Context) (time.Time, error) {
+			last, err := getLastRun(ctx, r.cursor, r.o.cursorKey())
+			if err != nil {
+				return time.Time{}, err
+			}
+			o := r.o
+			// Don't log about skipped runs when we're only looking
+			o.logger = lu.DiscardLogger{}
+			return nextExecution(ctx, o.clock.Now(), last, r.when, o), nil
+		},
+	}
+}
+
 // doNext executes the next iteration of the schedule.
 // We use a cursor to keep track of the last completed run.
 // If we miss running multiple runs of the cron then we will only attempt to run the latest one.
 func (r scheduleRunner) doNext(ctx context.Context) error {
-	lastDone, err := getLastRun(ctx, r.cursor, r.o.name)
+	lastDone, err := getLastRun(ctx, r.cursor, r.o.cursorKey())
 	if err != nil {
 		return err
 	}
 
-	next := nextExecution(r.o.clock.Now(), lastDone, r.when, r.o.name)
+	next := r.at
+	if next.IsZero() {
+		next = nextExecution(ctx, r.o.clock.Now(), lastDone, r.when, r.o)
+	}
 
 	ctx = log.ContextWith(ctx, j.MKV{
+		"schedule":      describeSchedule(r.when),
 		"schedule_last": lastDone,
 		"schedule_next": next,
 	})
 
+	makeRunID := r.o.runID
+	if makeRunID == nil {
+		makeRunID = defaultRunID
+	}
+	runAt := next
+	if r.o.runIDFromWindow {
+		runAt = windowStart(r.when, next)
+	}
+	runID := makeRunID(r.o.name, runAt)
+
 	if r.o.maxErrors > 0 && r.ErrCount >= r.o.maxErrors {
-		return setRunDone(ctx, next, r.cursor, r.o.name)
+		r.o.gaveUp(ctx, r.ErrCount)
+		return setRunDone(ctx, next, r.cursor, r.o.cursorKey(), runID)
 	}
 
 	if err := lu.WaitUntil(ctx, r.o.clock, next); err != nil {
 		return err
 	}
 
-	runID := fmt.Sprintf("%s_%d", r.o.name, next.Unix())
+	if r.o.shouldRun != nil {
+		ok, err := r.o.shouldRun(ctx, next)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errRunHeld
+		}
+	}
 
 	ctx = log.ContextWith(ctx, j.MKV{"schedule_run_id": runID})
 
-	if err := r.f(ctx, lastDone, next, runID); err != nil {
+	if r.o.claimRuns {
+		claimed, err := claimRun(ctx, r.cursor, r.o.cursorKey(), lastDone, next)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			r.o.logger.Info(ctx, "scheduled run already claimed by another instance", nil)
+			return nil
+		}
+	}
+
+	err = runUnlessQuiesced(ctx, r.o.quiescer, func() error {
+		return r.runInSpan(ctx, lastDone, next, runID)
+	})
+	if err != nil {
+		if r.o.claimRuns {
+			// Release the claim so that the run is tried again
+			_, releaseErr := claimRun(ctx, r.cursor, r.o.cursorKey(), next, lastDone)
+			if releaseErr != nil {
+				// NoReturnErr: Return the error from the run
+				r.o.logger.Error(ctx, errors.Wrap(releaseErr, "release scheduled run"))
+			}
+		}
 		return err
 	}
 
-	return setRunDone(ctx, next, r.cursor, r.o.name)
+	if missed := r.missedRuns(r.o.clock.Now(), lastDone, next); missed > 0 {
+		metricsFor(r.o.registry).missedRuns.With(label(r.o.name)).Add(float64(missed))
+	}
+	return setRunDone(ctx, next, r.cursor, r.o.cursorKey(), runID)
 }
 
-func nextExecution(now, last time.Time, s Schedule, name string) time.Time {
+// missedRuns returns how many runs were skipped between lastDone and next,
+// or one when next was run late to catch up because the run after it was also due by now
+func (r scheduleRunner) missedRuns(now, lastDone, next time.Time) int {
+	if lastDone.IsZero() {
+		return 0
+	}
+	if skipped := countRuns(r.when, lastDone, next); skipped > 0 {
+		return skipped
+	}
+	if !r.when.Next(next).After(now) {
+		return 1
+	}
+	return 0
+}
+
+// runInSpan runs f with retries, in a span from the tracer if there is one
+func (r scheduleRunner) runInSpan(ctx context.Context, lastDone, next time.Time, runID string) error {
+	if r.o.tracer == nil {
+		return r.runWithRetries(ctx, lastDone, next, runID)
+	}
+	ctx, end := r.o.tracer(ctx, r.o.name, runID)
+	err := r.runWithRetries(ctx, lastDone, next, runID)
+	end(err)
+	return err
+}
+
+// runWithRetries runs f, retrying up to runRetries times if it fails
+func (r scheduleRunner) runWithRetries(ctx context.Context, lastDone, next time.Time, runID string) error {
+	var attempts uint
+	for {
+		err := r.run(ctx, lastDone, next, runID)
+		if err == nil || attempts >= r.o.runRetries || errors.Is(err, context.Canceled) || r.o.classify(err) == ErrorStop {
+			return err
+		}
+		// NoReturnErr: Retry the run
+		attempts++
+		r.o.logger.Error(ctx, errors.Wrap(err, "scheduled run failed, retrying", j.KV("attempt", attempts)))
+		var backoff time.Duration
+		if r.o.runRetryBackoff != nil {
+			backoff = r.o.runRetryBackoff(attempts, err)
+		}
+		if err := lu.Wait(ctx, r.o.clock, backoff); err != nil {
+			return err
+		}
+	}
+}
+
+// run calls f once, recovering from a panic if recoverIterations is set
+func (r scheduleRunner) run(ctx context.Context, lastDone, next time.Time, runID string) error {
+	if !r.o.recoverIterations {
+		return r.f(ctx, lastDone, next, runID)
+	}
+	return recoverPanic(func() error {
+		return r.f(ctx, lastDone, next, runID)
+	})
+}
+
+func nextExecution(ctx context.Context, now, last time.Time, s Schedule, o options) time.Time {
 	fromNow := s.Next(now)
 	if last.IsZero() {
-		return fromNow
+		return firstExecution(now, fromNow, s, o.startPolicy)
+	}
+	if last.After(now) {
+		// The clock has gone backwards since the last run, so wait for the run after it rather than
+		// running again for a time which has already been done
+		o.logger.Info(ctx, "last scheduled run is after now, waiting for the clock to catch up", map[string]any{
+			"last_run": last,
+			"skew":     last.Sub(now).String(),
+		})
+		return s.Next(last).In(now.Location())
 	}
 
 	// If the expected last run does not match the actual last run, we will
@@ -309,19 +818,78 @@ func nextExecution(now, last time.Time, s Schedule, name string) time.Time {
 	prev, ok := s.(previousAware)
 	if ok {
 		expectedLastRun := prev.Previous(now)
-		if !last.Equal(expectedLastRun) {
+		if expectedLastRun.IsZero() {
+			o.logger.Info(ctx, "couldn't find the previous scheduled run", map[string]any{"last_run": last})
+		} else if expectedLastRun.After(last) {
+			// Only go back to a missed run, the last run may be off the schedule, e.g. after RunImmediately
+			if skipped := countRuns(s, last, expectedLastRun); skipped > 0 {
+				o.logger.Info(ctx, "skipping missed scheduled runs", map[string]any{
+					"skipped_runs": skipped,
+					"skipped_from": last,
+					"skipped_to":   expectedLastRun,
+				})
+			}
 			return expectedLastRun
 		}
 	}
 
 	fromLast := s.Next(last)
+	if !fromLast.After(last) {
+		// The schedule doesn't move on from the last run, e.g. Poll(0), so run for now rather than repeating it
+		return now
+	}
 	if fromLast.Before(fromNow) {
-		scheduleCursorLag.WithLabelValues(name).Set(fromNow.Sub(fromLast).Seconds())
+		metricsFor(o.registry).cursorLag.With(label(o.name)).Set(fromNow.Sub(fromLast).Seconds())
 		return fromLast.In(now.Location())
 	}
 	return fromNow
 }
 
+// firstExecution returns when to run for the first time, when there's no last run, according to policy
+func firstExecution(now, fromNow time.Time, s Schedule, policy StartPolicy) time.Time {
+	switch policy {
+	case CatchUpFromCursor:
+		if prev, ok := s.(previousAware); ok {
+			if p := prev.Previous(now); !p.IsZero() {
+				return p
+			}
+		}
+	case RunImmediately:
+		return now
+	}
+	return fromNow
+}
+
+// windowedSchedule is a Schedule which runs at an offset into each of its windows
+type windowedSchedule interface {
+	windowStart(t time.Time) time.Time
+}
+
+// windowStart returns the start of the window which the run of s at t is for,
+// it's t for schedules without windows
+func windowStart(s Schedule, t time.Time) time.Time {
+	if w, ok := s.(windowedSchedule); ok {
+		return w.windowStart(t)
+	}
+	return t
+}
+
+func defaultRunID(name string, scheduledTime time.Time) string {
+	return fmt.Sprintf("%s_%d", name, scheduledTime.Unix())
+}
+
+// maxCountRuns limits how many runs countRuns will count, so that frequent schedules don't take too long
+const maxCountRuns = 10_000
+
+// countRuns returns how many times s would have run after from and before to, up to maxCountRuns
+func countRuns(s Schedule, from, to time.Time) int {
+	var n int
+	for t := s.Next(from); t.Before(to) && n < maxCountRuns; t = s.Next(t) {
+		n++
+	}
+	return n
+}
+
 // getLastRun returns the last successful run timestamp.
 // Returns a zero time if no run is found.
 func getLastRun(ctx context.Context, curs Cursor, name string) (time.Time, error) {
@@ -343,7 +911,28 @@ func getLastRun(ctx context.Context, curs Cursor, name string) (time.Time, error
 	return time.Unix(unixSec, 0), nil
 }
 
-func setRunDone(ctx context.Context, t time.Time, curs Cursor, name string) error {
+// claimRun moves the cursor from last to next if it's still at last, returning false if it isn't
+func claimRun(ctx context.Context, curs Cursor, name string, last, next time.Time) (bool, error) {
+	cc, ok := curs.(CompareAndSetCursor)
+	if !ok {
+		return false, errors.New("cursor doesn't support CompareAndSet, needed to claim runs")
+	}
+	return cc.CompareAndSet(ctx, name, cursorValue(last), cursorValue(next))
+}
+
+// cursorValue returns how t is stored in a cursor, an empty string for the zero time
+func cursorValue(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+// setRunDone stores t as the last run in curs, along with runID if curs is a RunIDCursor
+func setRunDone(ctx context.Context, t time.Time, curs Cursor, name, runID string) error {
 	unixSec := strconv.FormatInt(t.Unix(), 10)
+	if rc, ok := curs.(RunIDCursor); ok {
+		return rc.SetWithRunID(ctx, name, unixSec, runID)
+	}
 	return curs.Set(ctx, name, unixSec)
 }
@@ -2,16 +2,24 @@ package process
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/luno/jettison/errors"
 	"github.com/luno/jettison/j"
 	"github.com/luno/jettison/jtest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/robfig/cron/v3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/luno/lu"
+	"github.com/luno/lu/test"
 )
 
 type run struct {
@@ -164,12 +172,7 @@ func TestSchedule(t *testing.T) {
 			defer runs.AssertUsed()
 
 			if !tc.setClockTo.IsZero() {
-				go func() {
-					for !cl.HasWaiters() {
-						time.Sleep(time.Millisecond)
-					}
-					cl.SetTime(tc.setClockTo)
-				}()
+				go test.SetClock(t, cl, tc.setClockTo)
 			}
 
 			r := scheduleRunner{
@@ -187,13 +190,464 @@ func TestSchedule(t *testing.T) {
 	}
 }
 
+func TestScheduledWithFakeClock(t *testing.T) {
+	cl := clocktesting.NewFakeClock(time.Date(2024, 1, 1, 0, 30, 0, 0, time.UTC))
+	runs := make(chan time.Time, 1)
+	p := Scheduled(AlwaysRole, make(memCursor), "test", Every(time.Hour),
+		func(_ context.Context, _, runTime time.Time, _ string) error {
+			runs <- runTime
+			return nil
+		},
+		WithClock(cl),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- p.Run(ctx) }()
+
+	test.AdvanceClock(t, cl, 30*time.Minute)
+	assert.Equal(t, time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC), <-runs)
+
+	test.AdvanceClock(t, cl, time.Hour)
+	assert.Equal(t, time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC), <-runs)
+
+	cancel()
+	jtest.Require(t, context.Canceled, <-done)
+}
+
+func TestRunIDFunc(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2022, 1, 22, 13, 24, 1, 0, time.UTC)
+
+	var gotRunID string
+	r := scheduleRunner{
+		cursor: make(memCursor),
+		o: resolveOptions(options{name: "test"}, []Option{
+			WithClock(clocktesting.NewFakeClock(now)),
+			WithRunIDFunc(func(name string, scheduledTime time.Time) string {
+				return name + "@" + scheduledTime.Format(time.RFC3339)
+			}),
+		}),
+		when: Poll(0),
+		f: func(_ context.Context, _, _ time.Time, runID string) error {
+			gotRunID = runID
+			return nil
+		},
+	}
+	jtest.RequireNil(t, r.doNext(ctx))
+	assert.Equal(t, "test@2022-01-22T13:24:01Z", gotRunID)
+}
+
+func TestRunIDFromWindow(t *testing.T) {
+	now := time.Date(2022, 1, 22, 13, 24, 1, 0, time.UTC)
+	sast := time.FixedZone("SAST", 2*60*60)
+	testCases := []struct {
+		name      string
+		when      Schedule
+		opts      []Option
+		expRunID  string
+		expCursor string
+	}{
+		{
+			name:      "default uses the run time",
+			when:      Every(time.Hour, WithOffset(5*time.Minute)),
+			expRunID:  "test_1642856700", // 13:05
+			expCursor: "1642856700",
+		},
+		{
+			name:      "window without the offset",
+			when:      Every(time.Hour, WithOffset(5*time.Minute)),
+			opts:      []Option{WithRunIDFromWindow()},
+			expRunID:  "test_1642856400", // 13:00
+			expCursor: "1642856700",
+		},
+		{
+			name:      "window in a timezone",
+			when:      ToTimezone(Every(time.Hour, WithOffset(5*time.Minute)), sast),
+			opts:      []Option{WithRunIDFromWindow()},
+			expRunID:  "test_1642856400", // 13:00
+			expCursor: "1642856700",
+		},
+		{
+			name:      "no offset",
+			when:      Every(time.Hour),
+			opts:      []Option{WithRunIDFromWindow()},
+			expRunID:  "test_1642856400", // 13:00
+			expCursor: "1642856400",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			cursor := make(memCursor)
+			jtest.RequireNil(t, cursor.Set(ctx, "test", cursorValue(now.Add(-2*time.Hour))))
+
+			var gotRunID string
+			r := scheduleRunner{
+				cursor: cursor,
+				o:      resolveOptions(options{name: "test"}, append([]Option{WithClock(clocktesting.NewFakeClock(now))}, tc.opts...)),
+				when:   tc.when,
+				f: func(_ context.Context, _, _ time.Time, runID string) error {
+					gotRunID = runID
+					return nil
+				},
+			}
+			jtest.RequireNil(t, r.doNext(ctx))
+			assert.Equal(t, tc.expRunID, gotRunID)
+
+			// The cursor is still set to the time of the run
+			gotCursor, err := cursor.Get(ctx, "test")
+			jtest.RequireNil(t, err)
+			assert.Equal(t, tc.expCursor, gotCursor)
+		})
+	}
+}
+
+func TestRunRetries(t *testing.T) {
+	testCases := []struct {
+		name      string
+		retries   uint
+		expCalls  int
+		expErr    error
+		expCursor string
+	}{
+		{name: "no retries", retries: 0, expCalls: 1, expErr: io.ErrUnexpectedEOF},
+		{name: "not enough retries", retries: 1, expCalls: 2, expErr: io.ErrUnexpectedEOF},
+		{name: "succeeds on retry", retries: 2, expCalls: 3, expCursor: "1642857841"},
+		{name: "stops retrying after success", retries: 5, expCalls: 3, expCursor: "1642857841"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Date(2022, 1, 22, 13, 24, 1, 0, time.UTC)
+			var calls int
+			cursor := make(memCursor)
+			r := scheduleRunner{
+				cursor: cursor,
+				o: resolveOptions(options{name: "test"}, []Option{
+					WithClock(clocktesting.NewFakeClock(now)),
+					WithRunRetries(tc.retries, ErrorSleepFor(0)),
+				}),
+				when: Poll(0),
+				f: func(_ context.Context, _, _ time.Time, _ string) error {
+					calls++
+					if calls < 3 {
+						return io.ErrUnexpectedEOF
+					}
+					return nil
+				},
+			}
+			jtest.Require(t, tc.expErr, r.doNext(ctx))
+			assert.Equal(t, tc.expCalls, calls)
+			assert.Equal(t, tc.expCursor, cursor["test"])
+		})
+	}
+}
+
+func TestTracer(t *testing.T) {
+	type spanKey struct{}
+	ctx := context.Background()
+	now := time.Date(2022, 1, 22, 13, 24, 1, 0, time.UTC)
+	var started, ended []string
+	var endErr error
+	r := scheduleRunner{
+		cursor: make(memCursor),
+		o: resolveOptions(options{name: "test"}, []Option{
+			WithClock(clocktesting.NewFakeClock(now)),
+			WithTracer(func(ctx context.Context, name, runID string) (context.Context, func(error)) {
+				started = append(started, name+" "+runID)
+				return context.WithValue(ctx, spanKey{}, runID), func(err error) {
+					ended = append(ended, runID)
+					endErr = err
+				}
+			}),
+		}),
+		when: Poll(0),
+		f: func(ctx context.Context, _, _ time.Time, runID string) error {
+			assert.Equal(t, runID, ctx.Value(spanKey{}))
+			assert.Len(t, ended, 0)
+			return io.ErrUnexpectedEOF
+		},
+	}
+	jtest.Require(t, io.ErrUnexpectedEOF, r.doNext(ctx))
+	assert.Equal(t, []string{"test test_1642857841"}, started)
+	assert.Equal(t, []string{"test_1642857841"}, ended)
+	jtest.Require(t, io.ErrUnexpectedEOF, endErr)
+}
+
+func TestShouldRun(t *testing.T) {
+	ctx := context.Background()
+	cl := clocktesting.NewFakeClock(time.Date(2022, 1, 22, 13, 24, 1, 0, time.UTC))
+	cursor := make(memCursor)
+	shouldRun := false
+	var runs int
+	r := scheduleRunner{
+		cursor: cursor,
+		o: resolveOptions(options{name: "test"}, []Option{
+			WithClock(cl),
+			WithShouldRun(func(context.Context, time.Time) (bool, error) {
+				return shouldRun, nil
+			}),
+		}),
+		when: Poll(0),
+		f: func(context.Context, time.Time, time.Time, string) error {
+			runs++
+			return nil
+		},
+	}
+
+	jtest.Require(t, errRunHeld, r.doNext(ctx))
+	sleep, err := processOnce(ctx, AlwaysRole, r.o, &r)
+	jtest.RequireNil(t, err)
+	assert.Equal(t, shouldRunRecheck, sleep)
+	assert.True(t, r.held)
+	assert.Equal(t, 0, runs)
+	assert.Empty(t, cursor["test"])
+
+	cl.Step(sleep)
+	shouldRun = true
+	jtest.RequireNil(t, r.doNext(ctx))
+	assert.Equal(t, 1, runs)
+	assert.Equal(t, "1642857901", cursor["test"])
+}
+
+func TestCursorName(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2022, 1, 22, 13, 24, 1, 0, time.UTC)
+	cursor := memCursor{"old": "1642857780"}
+	var lastRuns []time.Time
+	r := scheduleRunner{
+		cursor: cursor,
+		o: resolveOptions(options{}, []Option{
+			WithName("new"),
+			WithCursorName("old"),
+			WithClock(clocktesting.NewFakeClock(now)),
+		}),
+		when: Every(time.Minute),
+		f: func(_ context.Context, last, _ time.Time, _ string) error {
+			lastRuns = append(lastRuns, last)
+			return nil
+		},
+	}
+	jtest.RequireNil(t, r.doNext(ctx))
+	assert.Equal(t, []time.Time{time.Unix(1642857780, 0)}, lastRuns)
+	assert.Equal(t, "1642857840", cursor["old"])
+	assert.NotContains(t, cursor, "new")
+}
+
+// runIDCursor is a memCursor which records the runIDs set with it
+type runIDCursor struct {
+	memCursor
+	runIDs map[string]string
+}
+
+func (c runIDCursor) SetWithRunID(ctx context.Context, name, value, runID string) error {
+	c.runIDs[name] = runID
+	return c.Set(ctx, name, value)
+}
+
+func TestRunIDCursor(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2022, 1, 22, 13, 24, 1, 0, time.UTC)
+	cursor := runIDCursor{memCursor: make(memCursor), runIDs: make(map[string]string)}
+	var runIDs []string
+	r := scheduleRunner{
+		cursor: cursor,
+		o: resolveOptions(options{name: "test"}, []Option{
+			WithClock(clocktesting.NewFakeClock(now)),
+		}),
+		when: Poll(0),
+		f: func(_ context.Context, _, _ time.Time, runID string) error {
+			runIDs = append(runIDs, runID)
+			return nil
+		},
+	}
+	jtest.RequireNil(t, r.doNext(ctx))
+	assert.Equal(t, []string{"test_1642857841"}, runIDs)
+	assert.Equal(t, "1642857841", cursor.memCursor["test"])
+	assert.Equal(t, map[string]string{"test": "test_1642857841"}, cursor.runIDs)
+}
+
+// casCursor is a memCursor which supports CompareAndSet
+type casCursor struct {
+	memCursor
+}
+
+func (c casCursor) CompareAndSet(_ context.Context, name, old, value string) (bool, error) {
+	if c.memCursor[name] != old {
+		return false, nil
+	}
+	c.memCursor[name] = value
+	return true, nil
+}
+
+func TestClaimRuns(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2022, 1, 22, 13, 24, 1, 0, time.UTC)
+	cursor := casCursor{memCursor: memCursor{"test": "1642852800"}} // 12:00
+	var runs int
+	var runErr error
+	r := scheduleRunner{
+		cursor: cursor,
+		o: resolveOptions(options{name: "test"}, []Option{
+			WithClock(clocktesting.NewFakeClock(now)),
+			WithLogger(lu.DiscardLogger{}),
+			WithClaimRuns(),
+		}),
+		when: Every(time.Hour),
+		f: func(context.Context, time.Time, time.Time, string) error {
+			runs++
+			return runErr
+		},
+	}
+
+	// A failed run releases its claim
+	runErr = io.ErrUnexpectedEOF
+	jtest.Require(t, io.ErrUnexpectedEOF, r.doNext(ctx))
+	assert.Equal(t, 1, runs)
+	assert.Equal(t, "1642852800", cursor.memCursor["test"])
+
+	runErr = nil
+	jtest.RequireNil(t, r.doNext(ctx))
+	assert.Equal(t, 2, runs)
+	assert.Equal(t, "1642856400", cursor.memCursor["test"]) // 13:00
+
+	// Another instance claims the next run just before this one does
+	r.o.shouldRun = func(_ context.Context, next time.Time) (bool, error) {
+		cursor.memCursor["test"] = cursorValue(next)
+		return true, nil
+	}
+	r.o.clock = clocktesting.NewFakeClock(now.Add(time.Hour))
+	jtest.RequireNil(t, r.doNext(ctx))
+	assert.Equal(t, 2, runs)
+	assert.Equal(t, "1642860000", cursor.memCursor["test"]) // 14:00
+}
+
+func Test_missedRuns(t *testing.T) {
+	testCases := []struct {
+		name      string
+		when      Schedule
+		now       time.Time
+		last      time.Time
+		next      time.Time
+		expMissed int
+	}{
+		{
+			name: "never ran",
+			when: Every(time.Hour),
+			now:  must(time.Parse(time.RFC3339, "2022-01-22T13:24:01Z")),
+			next: must(time.Parse(time.RFC3339, "2022-01-22T14:00:00Z")),
+		},
+		{
+			name: "on time",
+			when: Every(time.Hour),
+			now:  must(time.Parse(time.RFC3339, "2022-01-22T13:24:01Z")),
+			last: must(time.Parse(time.RFC3339, "2022-01-22T12:00:00Z")),
+			next: must(time.Parse(time.RFC3339, "2022-01-22T13:00:00Z")),
+		},
+		{
+			name:      "skipped runs",
+			when:      Every(time.Hour),
+			now:       must(time.Parse(time.RFC3339, "2022-01-22T13:24:01Z")),
+			last:      must(time.Parse(time.RFC3339, "2022-01-22T09:00:00Z")),
+			next:      must(time.Parse(time.RFC3339, "2022-01-22T13:00:00Z")),
+			expMissed: 3,
+		},
+		{
+			name:      "catching up",
+			when:      must(cron.ParseStandard("0 7,10,14 * * 1-5")),
+			now:       must(time.Parse(time.RFC3339, "2022-01-21T15:04:53Z")),
+			last:      must(time.Parse(time.RFC3339, "2022-01-21T07:00:00Z")),
+			next:      must(time.Parse(time.RFC3339, "2022-01-21T10:00:00Z")),
+			expMissed: 1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := scheduleRunner{when: tc.when}
+			assert.Equal(t, tc.expMissed, r.missedRuns(tc.now, tc.last, tc.next))
+		})
+	}
+}
+
+func TestMissedRunsMetric(t *testing.T) {
+	ctx := context.Background()
+	now := must(time.Parse(time.RFC3339, "2022-01-22T13:24:01Z"))
+	reg := prometheus.NewRegistry()
+	cursor := make(memCursor)
+	jtest.RequireNil(t, setRunDone(ctx, must(time.Parse(time.RFC3339, "2022-01-22T09:00:00Z")), cursor, "test", ""))
+	r := scheduleRunner{
+		cursor: cursor,
+		o: resolveOptions(options{name: "test"}, []Option{
+			WithClock(clocktesting.NewFakeClock(now)),
+			WithRegistry(reg),
+			WithLogger(lu.DiscardLogger{}),
+		}),
+		when: Every(time.Hour),
+		f:    func(context.Context, time.Time, time.Time, string) error { return nil },
+	}
+	jtest.RequireNil(t, r.doNext(ctx))
+	assert.Equal(t, 3.0, testutil.ToFloat64(metricsFor(reg).missedRuns.With(label("test"))))
+}
+
+func TestScheduledRecoverIterations(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2022, 1, 22, 13, 24, 1, 0, time.UTC)
+	cursor := make(memCursor)
+	r := scheduleRunner{
+		cursor: cursor,
+		o: resolveOptions(options{name: "test"}, []Option{
+			WithClock(clocktesting.NewFakeClock(now)),
+			WithRecoverIterations(),
+		}),
+		when: Poll(0),
+		f: func(context.Context, time.Time, time.Time, string) error {
+			panic("oops")
+		},
+	}
+	jtest.Require(t, ErrIterationPanicked, r.doNext(ctx))
+	assert.Empty(t, cursor["test"])
+}
+
+func TestRunImmediatelyRunsOnce(t *testing.T) {
+	now := time.Date(2022, 1, 22, 13, 24, 1, 0, time.UTC)
+	cl := clocktesting.NewFakeClock(now)
+	cursor := make(memCursor)
+	var calls int
+	r := scheduleRunner{
+		cursor: cursor,
+		o:      resolveOptions(options{name: "test"}, []Option{WithClock(cl), WithStartPolicy(RunImmediately)}),
+		when:   Every(time.Hour),
+		f: func(context.Context, time.Time, time.Time, string) error {
+			calls++
+			return nil
+		},
+	}
+	jtest.RequireNil(t, r.doNext(context.Background()))
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, cursorValue(now), cursor["test"])
+
+	// The next run is at 14:00, so it waits rather than running again for 13:00
+	cl.Step(time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	jtest.Require(t, context.Canceled, r.doNext(ctx))
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, cursorValue(now), cursor["test"])
+
+	cl.SetTime(time.Date(2022, 1, 22, 14, 0, 0, 0, time.UTC))
+	jtest.RequireNil(t, r.doNext(context.Background()))
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, cursorValue(cl.Now()), cursor["test"])
+}
+
 func TestNextExecution(t *testing.T) {
 	testCases := []struct {
 		name string
 
-		now  time.Time
-		last time.Time
-		spec cron.Schedule
+		now    time.Time
+		last   time.Time
+		spec   cron.Schedule
+		policy StartPolicy
 
 		expNext time.Time
 	}{
@@ -203,6 +657,42 @@ func TestNextExecution(t *testing.T) {
 			spec:    Every(time.Hour),
 			expNext: must(time.Parse(time.RFC3339, "2022-01-22T14:00:00Z")),
 		},
+		{
+			name:    "never ran, catching up returns previous",
+			now:     must(time.Parse(time.RFC3339, "2022-01-22T13:24:01Z")),
+			spec:    Every(time.Hour),
+			policy:  CatchUpFromCursor,
+			expNext: must(time.Parse(time.RFC3339, "2022-01-22T13:00:00Z")),
+		},
+		{
+			name:    "never ran, catching up without previous returns next",
+			now:     must(time.Parse(time.RFC3339, "2022-01-21T15:04:53Z")),
+			spec:    must(cron.ParseStandard("0 7,10,14 * * 1-5")),
+			policy:  CatchUpFromCursor,
+			expNext: must(time.Parse(time.RFC3339, "2022-01-24T07:00:00Z")),
+		},
+		{
+			name:    "never ran, run immediately returns now",
+			now:     must(time.Parse(time.RFC3339, "2022-01-22T13:24:01Z")),
+			spec:    Every(time.Hour),
+			policy:  RunImmediately,
+			expNext: must(time.Parse(time.RFC3339, "2022-01-22T13:24:01Z")),
+		},
+		{
+			name:    "run immediately ignored when there's a last run",
+			now:     must(time.Parse(time.RFC3339, "2022-01-22T13:24:01Z")),
+			last:    must(time.Parse(time.RFC3339, "2022-01-22T13:00:00Z")),
+			spec:    Every(time.Hour),
+			policy:  RunImmediately,
+			expNext: must(time.Parse(time.RFC3339, "2022-01-22T14:00:00Z")),
+		},
+		{
+			name:    "last between runs after running immediately returns next",
+			now:     must(time.Parse(time.RFC3339, "2022-01-22T13:24:02Z")),
+			last:    must(time.Parse(time.RFC3339, "2022-01-22T13:24:01Z")),
+			spec:    Every(time.Hour),
+			expNext: must(time.Parse(time.RFC3339, "2022-01-22T14:00:00Z")),
+		},
 		{
 			name:    "missed previous one, returns previous",
 			now:     must(time.Parse(time.RFC3339, "2022-01-22T13:24:01Z")),
@@ -218,11 +708,11 @@ func TestNextExecution(t *testing.T) {
 			expNext: must(time.Parse(time.RFC3339, "2022-01-22T14:00:00Z")),
 		},
 		{
-			name:    "last in the future returns previous",
+			name:    "last in the future waits for the run after it",
 			now:     must(time.Parse(time.RFC3339, "2022-01-22T13:24:01Z")),
 			last:    must(time.Parse(time.RFC3339, "2022-01-22T13:44:00Z")),
 			spec:    Every(time.Hour),
-			expNext: must(time.Parse(time.RFC3339, "2022-01-22T13:00:00Z")),
+			expNext: must(time.Parse(time.RFC3339, "2022-01-22T14:00:00Z")),
 		},
 		{
 			name:    "offset handled",
@@ -252,6 +742,13 @@ func TestNextExecution(t *testing.T) {
 			spec:    must(cron.ParseStandard("0 7,10,14 * * 1-5")),
 			expNext: must(time.Parse(time.RFC3339, "2022-01-24T07:00:00Z")), // 21st was a Friday, so should skip to Monday 24th
 		},
+		{
+			name:    "catches up from last when the previous run can't be found",
+			now:     must(time.Parse(time.RFC3339, "2027-03-01T00:00:00Z")),
+			last:    must(time.Parse(time.RFC3339, "2020-02-29T00:00:00Z")),
+			spec:    must(ParseCron("0 0 29 2 *")),
+			expNext: must(time.Parse(time.RFC3339, "2024-02-29T00:00:00Z")),
+		},
 		{
 			name:    "tod handles current run",
 			now:     must(time.Parse(time.RFC3339, "2022-01-21T15:00:00Z")),
@@ -263,7 +760,8 @@ func TestNextExecution(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			next := nextExecution(tc.now, tc.last, tc.spec, "")
+			o := resolveOptions(options{}, []Option{WithStartPolicy(tc.policy)})
+			next := nextExecution(context.Background(), tc.now, tc.last, tc.spec, o)
 			assert.Equal(t, tc.expNext, next)
 		})
 	}
@@ -276,6 +774,47 @@ func must[T any](v T, err error) T {
 	return v
 }
 
+func TestNextExecutionClockBackwards(t *testing.T) {
+	// The clock jumped back an hour and a half after the run at 10:00
+	last := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	now := time.Date(2024, 1, 1, 8, 30, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name    string
+		s       Schedule
+		expNext time.Time
+	}{
+		{name: "every", s: Every(time.Hour), expNext: time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{name: "cron", s: must(ParseCron("0 * * * *")), expNext: time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{name: "poll", s: Poll(10 * time.Minute), expNext: time.Date(2024, 1, 1, 10, 10, 0, 0, time.UTC)},
+		{name: "time of day", s: TimeOfDay(10, 0), expNext: time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)},
+		{name: "weekly", s: Weekly(time.Monday, 10, 0), expNext: time.Date(2024, 1, 8, 10, 0, 0, 0, time.UTC)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var l test.Logger
+			o := resolveOptions(options{}, []Option{WithLogger(&l)})
+			next := nextExecution(context.Background(), now, last, tc.s, o)
+			assert.Equal(t, tc.expNext, next)
+			assert.Equal(t, []string{"last scheduled run is after now, waiting for the clock to catch up"}, l.Infos())
+		})
+	}
+}
+
+func TestNextExecutionLogsSkips(t *testing.T) {
+	var l test.Logger
+	o := resolveOptions(options{}, []Option{WithLogger(&l)})
+
+	now := must(time.Parse(time.RFC3339, "2022-01-22T13:24:01Z"))
+	last := must(time.Parse(time.RFC3339, "2022-01-22T09:00:00Z"))
+	next := nextExecution(context.Background(), now, last, Every(time.Hour), o)
+
+	assert.Equal(t, must(time.Parse(time.RFC3339, "2022-01-22T13:00:00Z")), next)
+	assert.Equal(t, []string{"skipping missed scheduled runs"}, l.Infos())
+
+	assert.Equal(t, 3, countRuns(Every(time.Hour), last, next))
+}
+
 func TestNextExecutionMany(t *testing.T) {
 	timezoneAmericaNewYork, err := time.LoadLocation("America/New_York")
 	if err != nil {
@@ -476,6 +1015,7 @@ func TestRetries(t *testing.T) {
 				errorSleep: ErrorSleepFor(0),
 				maxErrors:  tc.maxErrors,
 				clock:      clock,
+				logger:     lu.DiscardLogger{},
 			}
 
 			r := scheduleRunner{
@@ -489,7 +1029,7 @@ func TestRetries(t *testing.T) {
 			}
 
 			if tc.expWait {
-				go step(clock, time.Minute)
+				go test.AdvanceClock(t, clock, time.Minute)
 			}
 
 			jtest.Assert(t, tc.expErr, r.doNext(context.Background()))
@@ -501,13 +1041,6 @@ func TestRetries(t *testing.T) {
 	}
 }
 
-func step(clock *clocktesting.FakeClock, d time.Duration) {
-	for !clock.HasWaiters() {
-		time.Sleep(time.Millisecond)
-	}
-	clock.Step(d)
-}
-
 type testContext struct {
 	errCalled int
 	err       []error
@@ -542,7 +1075,7 @@ func (*testContext) String() string {
 }
 
 func Test_processLoop(t *testing.T) {
-	process := func(context.Context) time.Duration { return time.Minute }
+	process := func(context.Context) (time.Duration, error) { return time.Minute, nil }
 
 	tests := []struct {
 		name       string
@@ -653,11 +1186,7 @@ func Test_processOnce(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			if tt.awaitRole == nil {
-				tt.awaitRole = func(role string) ContextFunc {
-					return func(ctx context.Context) (context.Context, context.CancelFunc, error) {
-						return ctx, func() {}, nil
-					}
-				}
+				tt.awaitRole = AlwaysRole
 			}
 			if tt.f == nil {
 				tt.f = func(_ context.Context, _, _ time.Time, _ string) error {
@@ -680,12 +1209,15 @@ func Test_processOnce(t *testing.T) {
 			}
 			opts = resolveOptions(opts, nil)
 
-			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			// No deadline, errorSleep would be capped to it
+			ctx, cancel := context.WithCancel(context.Background())
 			t.Cleanup(cancel)
-			sleep := processOnce(ctx, tt.awaitRole, opts, &r)
+			sleep, err := processOnce(ctx, tt.awaitRole, opts, &r)
+			jtest.RequireNil(t, err)
 			require.Equal(t, tt.sleep, sleep)
 			require.Equal(t, tt.errCount, errCount)
-			_ = processOnce(ctx, tt.awaitRole, opts, &r)
+			_, err = processOnce(ctx, tt.awaitRole, opts, &r)
+			jtest.RequireNil(t, err)
 			// If there was no error, we still expect errCount=0.
 			// If there was an error, we expect another so errCount=2.
 			require.Equal(t, tt.errCount*2, errCount)
@@ -693,6 +1225,89 @@ func Test_processOnce(t *testing.T) {
 	}
 }
 
+func Test_processOnceErrorStop(t *testing.T) {
+	r := scheduleRunner{
+		cursor: make(memCursor),
+		o:      options{name: "test", clock: clocktesting.NewFakeClock(time.Unix(10_000, 0))},
+		when:   Poll(0),
+		f: func(context.Context, time.Time, time.Time, string) error {
+			return io.ErrUnexpectedEOF
+		},
+	}
+	opts := resolveOptions(options{}, []Option{
+		WithErrorClassifier(func(err error) ErrorClass { return ErrorStop }),
+	})
+
+	_, err := processOnce(context.Background(), AlwaysRole, opts, &r)
+	jtest.Require(t, io.ErrUnexpectedEOF, err)
+	assert.Equal(t, uint(1), r.ErrCount)
+}
+
+func Test_processOnceErrFatal(t *testing.T) {
+	var calls int
+	r := scheduleRunner{
+		cursor: make(memCursor),
+		o: resolveOptions(options{name: "test"}, []Option{
+			WithClock(clocktesting.NewFakeClock(time.Unix(10_000, 0))),
+			WithRunRetries(5, ErrorSleepFor(0)),
+		}),
+		when: Poll(0),
+		f: func(context.Context, time.Time, time.Time, string) error {
+			calls++
+			return errors.Wrap(ErrFatal, "bad config")
+		},
+	}
+	opts := resolveOptions(options{}, []Option{WithLogger(lu.DiscardLogger{})})
+
+	_, err := processOnce(context.Background(), AlwaysRole, opts, &r)
+	jtest.Require(t, ErrFatal, err)
+	assert.Equal(t, 1, calls)
+}
+
+func Test_processOnceRoleAcquireTimeout(t *testing.T) {
+	cl := clocktesting.NewFakeClock(time.Unix(10_000, 0))
+	neverGranted := func(string) ContextFunc {
+		return func(ctx context.Context) (context.Context, context.CancelFunc, error) {
+			<-ctx.Done()
+			return nil, nil, context.Cause(ctx)
+		}
+	}
+	var runs int
+	r := scheduleRunner{
+		cursor: make(memCursor),
+		o:      options{name: "test", clock: cl},
+		when:   Poll(0),
+		f: func(context.Context, time.Time, time.Time, string) error {
+			runs++
+			return nil
+		},
+	}
+	opts := resolveOptions(options{}, []Option{
+		WithClock(cl),
+		WithLogger(lu.DiscardLogger{}),
+		WithRoleAcquireTimeout(time.Minute),
+	})
+
+	go test.AdvanceClock(t, cl, time.Minute)
+	_, err := processOnce(context.Background(), neverGranted, opts, &r)
+	jtest.RequireNil(t, err)
+	assert.Equal(t, uint(1), r.ErrCount)
+
+	opts = resolveOptions(opts, []Option{
+		WithErrorClassifier(func(err error) ErrorClass {
+			if errors.Is(err, ErrRoleNotAcquired) {
+				return ErrorStop
+			}
+			return ErrorRetry
+		}),
+	})
+	go test.AdvanceClock(t, cl, time.Minute)
+	_, err = processOnce(context.Background(), neverGranted, opts, &r)
+	jtest.Require(t, ErrRoleNotAcquired, err)
+	assert.Equal(t, uint(2), r.ErrCount)
+	assert.Equal(t, 0, runs)
+}
+
 func TestLastScheduled(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -712,12 +1327,7 @@ func TestLastScheduled(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
 			t.Cleanup(cancel)
-			awaitRole := func(role string) ContextFunc {
-				return func(ctx context.Context) (context.Context, context.CancelFunc, error) {
-					return ctx, func() {}, nil
-				}
-			}
-			process := Scheduled(awaitRole, make(memCursor), "TestLastScheduled", Poll(1), tt.f)
+			process := Scheduled(AlwaysRole, make(memCursor), "TestLastScheduled", Poll(1), tt.f)
 			tf := func() { _ = process.Run(ctx) }
 			if tt.panics {
 				require.Panics(t, tf)
@@ -732,6 +1342,7 @@ func TestCronWithPrevious(t *testing.T) {
 	testCases := []struct {
 		name        string
 		cron        string
+		opts        []CronOption
 		now         time.Time
 		expPrevious time.Time
 		expNext     time.Time
@@ -740,9 +1351,24 @@ func TestCronWithPrevious(t *testing.T) {
 			name:        "cron that never runs, gives up",
 			cron:        "0 0 31 2 *",
 			now:         time.Date(2024, 1, 1, 0, 0, 59, 0, time.UTC),
-			expPrevious: time.Date(2024, 1, 1, 0, 0, 59, 0, time.UTC),
+			expPrevious: time.Time{},
 			expNext:     time.Time{},
 		},
+		{
+			name:        "leap day beyond the default look back, gives up",
+			cron:        "0 0 29 2 *",
+			now:         time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC),
+			expPrevious: time.Time{},
+			expNext:     time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:        "leap day with a longer look back",
+			cron:        "0 0 29 2 *",
+			opts:        []CronOption{WithMaxLookBack(5 * 365 * 24 * time.Hour)},
+			now:         time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC),
+			expPrevious: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+			expNext:     time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC),
+		},
 		{
 			name:        "look back over a year",
 			cron:        "1 1 1 1 *",
@@ -764,6 +1390,13 @@ func TestCronWithPrevious(t *testing.T) {
 			expPrevious: time.Date(2024, 10, 3, 8, 14, 0, 0, time.UTC),
 			expNext:     time.Date(2024, 10, 3, 8, 15, 0, 0, time.UTC),
 		},
+		{
+			name:        "weekdays at 9am, over the weekend",
+			cron:        "0 9 * * 1-5",
+			now:         time.Date(2024, 10, 7, 8, 59, 59, 0, time.UTC),
+			expPrevious: time.Date(2024, 10, 4, 9, 0, 0, 0, time.UTC),
+			expNext:     time.Date(2024, 10, 7, 9, 0, 0, 0, time.UTC),
+		},
 		{
 			name:        "every minute of every day, now is on schedule",
 			cron:        "* * * * *",
@@ -775,11 +1408,10 @@ func TestCronWithPrevious(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			cr, err := cron.ParseStandard(tc.cron)
+			s, err := ParseCron(tc.cron, tc.opts...)
 			jtest.RequireNil(t, err)
-			s := cronWithPrevious{Schedule: cr}
 
-			prev := s.Previous(tc.now)
+			prev := s.(previousAware).Previous(tc.now)
 			assert.Equal(t, tc.expPrevious, prev)
 
 			next := s.Next(tc.now)
@@ -787,3 +1419,429 @@ func TestCronWithPrevious(t *testing.T) {
 		})
 	}
 }
+
+func TestToTimezoneCronPrevious(t *testing.T) {
+	sast := time.FixedZone("SAST", 2*60*60)
+	weekdays := ToTimezone(must(ParseCron("0 9 * * 1-5")), sast)
+
+	prev, ok := weekdays.(previousAware)
+	require.True(t, ok)
+	now := time.Date(2024, 1, 8, 6, 0, 0, 0, time.UTC) // 08:00 SAST on a Monday
+	assert.Equal(t, time.Date(2024, 1, 5, 7, 0, 0, 0, time.UTC), prev.Previous(now))
+	assert.Equal(t, time.Date(2024, 1, 8, 7, 0, 0, 0, time.UTC), weekdays.Next(now))
+
+	// Missed runs are skipped to the previous run, in the timezone of now
+	o := resolveOptions(options{}, []Option{WithLogger(lu.DiscardLogger{})})
+	last := time.Date(2024, 1, 3, 7, 0, 0, 0, time.UTC)
+	next := nextExecution(context.Background(), now, last, weekdays, o)
+	assert.Equal(t, time.Date(2024, 1, 5, 7, 0, 0, 0, time.UTC), next)
+	assert.Equal(t, time.UTC, next.Location())
+
+	never := ToTimezone(must(ParseCron("0 0 31 2 *")), sast)
+	assert.True(t, never.(previousAware).Previous(now).IsZero())
+}
+
+func TestRawCronCatchesUpLikeParseCron(t *testing.T) {
+	raw := must(cron.ParseStandard("0 9 * * *"))
+	parsed := must(ParseCron("0 9 * * *"))
+
+	_, ok := withPrevious(raw).(previousAware)
+	assert.True(t, ok)
+	_, ok = ToTimezone(raw, time.UTC).(previousAware)
+	assert.True(t, ok)
+	_, ok = withPrevious(Poll(time.Minute)).(previousAware)
+	assert.False(t, ok)
+
+	now := time.Date(2024, 10, 5, 10, 0, 0, 0, time.UTC)
+	last := time.Date(2024, 10, 1, 9, 0, 0, 0, time.UTC)
+	o := resolveOptions(options{}, []Option{WithLogger(lu.DiscardLogger{})})
+	ctx := context.Background()
+	exp := time.Date(2024, 10, 5, 9, 0, 0, 0, time.UTC)
+	assert.Equal(t, exp, nextExecution(ctx, now, last, parsed, o))
+	assert.Equal(t, exp, nextExecution(ctx, now, last, withPrevious(raw), o))
+
+	assert.Equal(t, "*cron.SpecSchedule", describeSchedule(withPrevious(raw)))
+}
+
+func TestScheduledQuiesce(t *testing.T) {
+
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	var runs atomic.Int32
+	f := func(ctx context.Context, _, _ time.Time, _ string) error {
+		runs.Add(1)
+		started <- struct{}{}
+		<-release
+		return nil
+	}
+
+	var a lu.App
+	a.AddProcess(Scheduled(AlwaysRole, make(memCursor), "quiesce", Poll(time.Millisecond), f))
+	jtest.RequireNil(t, a.Launch(context.Background()))
+	t.Cleanup(func() { _ = a.Shutdown() })
+
+	<-started
+
+	quiesced := make(chan error)
+	go func() {
+		quiesced <- a.Quiesce(context.Background())
+	}()
+
+	select {
+	case <-quiesced:
+		require.Fail(t, "quiesce returned before the run completed")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+
+	select {
+	case err := <-quiesced:
+		jtest.RequireNil(t, err)
+	case <-time.After(time.Second):
+		require.Fail(t, "timeout waiting for quiesce")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(1), runs.Load())
+	assert.Empty(t, started)
+}
+
+func TestScheduleInfo(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2022, 1, 22, 13, 24, 1, 0, time.UTC)
+	cl := clocktesting.NewFakeClock(now)
+	cursor := make(memCursor)
+	f := func(ctx context.Context, lastRunTime, runTime time.Time, runID string) error { return nil }
+	cr, err := ParseCron("0 9 * * *")
+	jtest.RequireNil(t, err)
+
+	var a lu.App
+	a.AddProcess(
+		Scheduled(AlwaysRole, cursor, "hourly", Every(time.Hour), f, WithClock(cl)),
+		Scheduled(AlwaysRole, cursor, "daily", cr, f, WithClock(cl)),
+		Loop(func(ctx context.Context) error { return nil }),
+	)
+
+	jtest.RequireNil(t, setRunDone(ctx, now.Add(-84*time.Minute), cursor, "hourly", ""))
+
+	infos := a.Schedules()
+	require.Len(t, infos, 2)
+
+	assert.Equal(t, "hourly", infos[0].Name)
+	assert.Equal(t, "every 1h0m0s", infos[0].Description)
+	last, err := infos[0].LastRun(ctx)
+	jtest.RequireNil(t, err)
+	assert.True(t, last.Equal(now.Add(-84*time.Minute)))
+	next, err := infos[0].NextRun(ctx)
+	jtest.RequireNil(t, err)
+	assert.Equal(t, time.Date(2022, 1, 22, 13, 0, 0, 0, time.UTC), next)
+
+	assert.Equal(t, "daily", infos[1].Name)
+	assert.Equal(t, "0 9 * * *", infos[1].Description)
+	last, err = infos[1].LastRun(ctx)
+	jtest.RequireNil(t, err)
+	assert.True(t, last.IsZero())
+	next, err = infos[1].NextRun(ctx)
+	jtest.RequireNil(t, err)
+	assert.Equal(t, time.Date(2022, 1, 23, 9, 0, 0, 0, time.UTC), next)
+}
+
+func TestUpcomingRuns(t *testing.T) {
+	from := time.Date(2024, 1, 1, 12, 30, 0, 0, time.UTC)
+	cr, err := ParseCron("0 9 * * 1-5")
+	jtest.RequireNil(t, err)
+	never, err := ParseCron("0 0 31 2 *")
+	jtest.RequireNil(t, err)
+
+	assert.Equal(t, []time.Time{
+		time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 3, 9, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 4, 9, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 5, 9, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC),
+	}, UpcomingRuns(cr, from, 5))
+	assert.Equal(t, []time.Time{
+		time.Date(2024, 1, 1, 13, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 1, 14, 0, 0, 0, time.UTC),
+	}, UpcomingRuns(Every(time.Hour), from, 2))
+	assert.Empty(t, UpcomingRuns(never, from, 5))
+	assert.Empty(t, UpcomingRuns(Poll(0), from, 5))
+}
+
+func TestEveryWithAnchor(t *testing.T) {
+	wednesday := time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)
+	weekly := Every(7*24*time.Hour, WithAnchor(wednesday))
+
+	testCases := []struct {
+		name    string
+		s       Schedule
+		t       time.Time
+		expNext time.Time
+		expPrev time.Time
+	}{
+		{
+			name:    "within a period",
+			s:       weekly,
+			t:       time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC),
+			expNext: time.Date(2024, 3, 6, 0, 0, 0, 0, time.UTC),
+			expPrev: time.Date(2024, 2, 28, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "on the anchor",
+			s:       weekly,
+			t:       wednesday,
+			expNext: wednesday.AddDate(0, 0, 7),
+			expPrev: wednesday,
+		},
+		{
+			name:    "before the anchor",
+			s:       weekly,
+			t:       time.Date(2023, 12, 25, 12, 0, 0, 0, time.UTC),
+			expNext: time.Date(2023, 12, 27, 0, 0, 0, 0, time.UTC),
+			expPrev: time.Date(2023, 12, 20, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "with offset",
+			s:       Every(7*24*time.Hour, WithAnchor(wednesday), WithOffset(9*time.Hour)),
+			t:       time.Date(2024, 3, 6, 8, 0, 0, 0, time.UTC),
+			expNext: time.Date(2024, 3, 6, 9, 0, 0, 0, time.UTC),
+			expPrev: time.Date(2024, 2, 28, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "in another timezone",
+			s:       weekly,
+			t:       time.Date(2024, 3, 6, 1, 0, 0, 0, time.FixedZone("UTC+2", 2*60*60)),
+			expNext: time.Date(2024, 3, 6, 2, 0, 0, 0, time.FixedZone("UTC+2", 2*60*60)),
+			expPrev: time.Date(2024, 2, 28, 2, 0, 0, 0, time.FixedZone("UTC+2", 2*60*60)),
+		},
+		{
+			name:    "aligned to mondays without anchor",
+			s:       Every(7 * 24 * time.Hour),
+			t:       time.Date(2024, 3, 6, 12, 0, 0, 0, time.UTC),
+			expNext: time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC),
+			expPrev: time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expNext, tc.s.Next(tc.t))
+			assert.Equal(t, tc.expPrev, tc.s.(intervalSchedule).Previous(tc.t))
+		})
+	}
+
+	assert.Equal(t, "every 168h0m0s from 2024-01-03T00:00:00Z", describeSchedule(weekly))
+}
+
+func TestInvalidPeriodsPanic(t *testing.T) {
+	assert.Panics(t, func() { Every(0) })
+	assert.Panics(t, func() { Every(-time.Hour) })
+	assert.Panics(t, func() { Poll(-time.Second) })
+	assert.NotPanics(t, func() { Poll(0) })
+}
+
+func TestPollZeroMovesOn(t *testing.T) {
+	now := time.Date(2022, 1, 22, 13, 24, 1, 0, time.UTC)
+	cl := clocktesting.NewFakeClock(now)
+	cursor := make(memCursor)
+	var runIDs []string
+	r := scheduleRunner{
+		cursor: cursor,
+		o:      resolveOptions(options{name: "test"}, []Option{WithClock(cl)}),
+		when:   Poll(0),
+		f: func(_ context.Context, _, _ time.Time, runID string) error {
+			runIDs = append(runIDs, runID)
+			return nil
+		},
+	}
+	jtest.RequireNil(t, r.doNext(context.Background()))
+	cl.Step(time.Second)
+	jtest.RequireNil(t, r.doNext(context.Background()))
+
+	assert.Equal(t, []string{"test_1642857841", "test_1642857842"}, runIDs)
+	assert.Equal(t, cursorValue(cl.Now()), cursor["test"])
+}
+
+func TestValidateSchedule(t *testing.T) {
+	from := time.Date(2024, 1, 1, 12, 30, 0, 0, time.UTC)
+	never, err := ParseCron("0 0 31 2 *")
+	jtest.RequireNil(t, err)
+	yearly, err := ParseCron("0 0 1 1 *")
+	jtest.RequireNil(t, err)
+
+	testCases := []struct {
+		name    string
+		s       Schedule
+		horizon time.Duration
+		expErr  error
+	}{
+		{name: "hourly", s: Every(time.Hour), horizon: 24 * time.Hour},
+		{name: "never runs", s: never, horizon: 10 * 365 * 24 * time.Hour, expErr: ErrScheduleNeverRuns},
+		{name: "beyond horizon", s: yearly, horizon: 30 * 24 * time.Hour, expErr: ErrScheduleNeverRuns},
+		{name: "within horizon", s: yearly, horizon: 366 * 24 * time.Hour},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			jtest.Require(t, tc.expErr, ValidateSchedule(tc.s, from, tc.horizon))
+		})
+	}
+}
+
+func TestTimeOfDayIn(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	jtest.RequireNil(t, err)
+
+	testCases := []struct {
+		name    string
+		s       Schedule
+		now     time.Time
+		expNext time.Time
+		expPrev time.Time
+	}{
+		{
+			name:    "normal day",
+			s:       TimeOfDayIn(9, 0, ny),
+			now:     time.Date(2022, 3, 10, 12, 0, 0, 0, time.UTC),
+			expNext: time.Date(2022, 3, 10, 14, 0, 0, 0, time.UTC),
+			expPrev: time.Date(2022, 3, 9, 14, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "clocks go forward past the time",
+			s:       TimeOfDayIn(2, 30, ny),
+			now:     time.Date(2022, 3, 13, 0, 0, 0, 0, time.UTC),
+			expNext: time.Date(2022, 3, 13, 7, 0, 0, 0, time.UTC), // 03:00 EDT
+			expPrev: time.Date(2022, 3, 12, 7, 30, 0, 0, time.UTC),
+		},
+		{
+			name:    "day after clocks go forward",
+			s:       TimeOfDayIn(2, 30, ny),
+			now:     time.Date(2022, 3, 13, 7, 0, 0, 0, time.UTC),
+			expNext: time.Date(2022, 3, 14, 6, 30, 0, 0, time.UTC),
+			expPrev: time.Date(2022, 3, 13, 7, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "clocks go back over the time",
+			s:       TimeOfDayIn(1, 30, ny),
+			now:     time.Date(2022, 11, 6, 0, 0, 0, 0, time.UTC),
+			expNext: time.Date(2022, 11, 6, 5, 30, 0, 0, time.UTC), // 01:30 EDT
+			expPrev: time.Date(2022, 11, 5, 5, 30, 0, 0, time.UTC),
+		},
+		{
+			name:    "only runs once when clocks go back",
+			s:       TimeOfDayIn(1, 30, ny),
+			now:     time.Date(2022, 11, 6, 5, 30, 0, 0, time.UTC),
+			expNext: time.Date(2022, 11, 7, 6, 30, 0, 0, time.UTC),
+			expPrev: time.Date(2022, 11, 6, 5, 30, 0, 0, time.UTC),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expNext, tc.s.Next(tc.now))
+			prev, ok := tc.s.(previousAware)
+			require.True(t, ok)
+			assert.Equal(t, tc.expPrev, prev.Previous(tc.now))
+		})
+	}
+}
+
+func TestWeeklyAndMonthly(t *testing.T) {
+	sast := time.FixedZone("SAST", 2*60*60)
+	testCases := []struct {
+		name    string
+		s       Schedule
+		now     time.Time
+		expNext time.Time
+		expPrev time.Time
+	}{
+		{
+			name:    "weekly later in the week",
+			s:       Weekly(time.Friday, 17, 30),
+			now:     time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), // Monday
+			expNext: time.Date(2024, 1, 5, 17, 30, 0, 0, time.UTC),
+			expPrev: time.Date(2023, 12, 29, 17, 30, 0, 0, time.UTC),
+		},
+		{
+			name:    "weekly same day before the time",
+			s:       Weekly(time.Monday, 9, 0),
+			now:     time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC),
+			expNext: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC),
+			expPrev: time.Date(2023, 12, 25, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "weekly exactly on the run",
+			s:       Weekly(time.Monday, 9, 0),
+			now:     time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC),
+			expNext: time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC),
+			expPrev: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "monthly",
+			s:       Monthly(15, 0, 0),
+			now:     time.Date(2024, 1, 20, 0, 0, 0, 0, time.UTC),
+			expNext: time.Date(2024, 2, 15, 0, 0, 0, 0, time.UTC),
+			expPrev: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "monthly across the year",
+			s:       Monthly(1, 6, 0),
+			now:     time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC),
+			expNext: time.Date(2024, 1, 1, 6, 0, 0, 0, time.UTC),
+			expPrev: time.Date(2023, 12, 1, 6, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "monthly on a day which february doesn't have",
+			s:       Monthly(31, 9, 0),
+			now:     time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC),
+			expNext: time.Date(2024, 2, 29, 9, 0, 0, 0, time.UTC),
+			expPrev: time.Date(2024, 1, 31, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "monthly after the end of a short month",
+			s:       Monthly(31, 9, 0),
+			now:     time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			expNext: time.Date(2024, 3, 31, 9, 0, 0, 0, time.UTC),
+			expPrev: time.Date(2024, 2, 29, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "weekly in another timezone",
+			s:       ToTimezone(Weekly(time.Monday, 9, 0), sast),
+			now:     time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC), // 10:00 SAST
+			expNext: time.Date(2024, 1, 8, 7, 0, 0, 0, time.UTC),
+			expPrev: time.Date(2024, 1, 1, 7, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expNext, tc.s.Next(tc.now))
+			prev, ok := tc.s.(previousAware)
+			require.True(t, ok)
+			assert.Equal(t, tc.expPrev, prev.Previous(tc.now))
+		})
+	}
+}
+
+func TestScheduleString(t *testing.T) {
+	cronSchedule, err := ParseCron("0 9 * * *")
+	jtest.RequireNil(t, err)
+	sast := time.FixedZone("SAST", 2*60*60)
+
+	testCases := []struct {
+		name string
+		s    Schedule
+		exp  string
+	}{
+		{name: "every", s: Every(time.Hour, WithOffset(5*time.Minute)), exp: "every 1h0m0s offset by 5m0s"},
+		{name: "poll", s: Poll(30 * time.Second), exp: "30s after the last run"},
+		{name: "time of day", s: TimeOfDay(9, 5), exp: "daily at 09:05"},
+		{name: "weekly", s: Weekly(time.Friday, 17, 0), exp: "weekly on Friday at 17:00"},
+		{name: "monthly", s: Monthly(1, 6, 30), exp: "monthly on day 1 at 06:30"},
+		{name: "cron", s: cronSchedule, exp: "0 9 * * *"},
+		{name: "in a timezone", s: ToTimezone(TimeOfDay(9, 0), sast), exp: "daily at 09:00 in SAST"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.exp, fmt.Sprint(tc.s))
+			assert.Equal(t, tc.exp, describeSchedule(tc.s))
+		})
+	}
+}
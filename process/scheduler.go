@@ -0,0 +1,122 @@
+package process
+
+import (
+	"cmp"
+	"context"
+	"time"
+
+	"github.com/luno/lu"
+)
+
+// Scheduler runs many scheduled jobs as a single lu.Process, using one goroutine rather than one for each job.
+// Each job works like a Scheduled process, with its own cursor, named after the job, its own errors and metrics.
+// Jobs are run one at a time in the order they're due, so a job which takes a long time delays the others.
+// A job held back by WithShouldRun doesn't hold up the others.
+type Scheduler struct {
+	awaitFunc AwaitRoleFunc
+	cursor    Cursor
+	ol        []Option
+	opts      options
+	jobs      []*schedulerJob
+}
+
+type schedulerJob struct {
+	// runner.at is the time of the job's next run, it's kept when backing off from an error to try the run again
+	runner scheduleRunner
+	// due is when the job should next be run, it's zero when it needs working out from the cursor
+	due time.Time
+}
+
+// NewScheduler returns a Scheduler which stores the last run of each job in curs.
+// The jobs only run when the role is held, the role is the name of the Scheduler unless set with WithRole.
+// The Scheduler is named "scheduler", use WithName to change it. The options also apply to every job.
+func NewScheduler(awaitFunc AwaitRoleFunc, curs Cursor, ol ...Option) *Scheduler {
+	opts := resolveOptions(defaultScheduleOptions(), append([]Option{WithName("scheduler")}, ol...))
+	return &Scheduler{awaitFunc: awaitFunc, cursor: curs, ol: ol, opts: opts}
+}
+
+// Add registers a job which runs f according to when, name is used for the cursor and to label metrics.
+// Options given here are applied after the options of the Scheduler. Jobs must be added before calling Process.
+func (s *Scheduler) Add(name string, when Schedule, f ScheduledFunc, ol ...Option) {
+	jobOpts := append(append(append([]Option{}, s.ol...), ol...), WithName(name))
+	opts := resolveOptions(defaultScheduleOptions(), jobOpts)
+	s.jobs = append(s.jobs, &schedulerJob{
+		runner: scheduleRunner{cursor: s.cursor, o: opts, when: withPrevious(when), f: f},
+	})
+}
+
+// Process returns the lu.Process which runs all the jobs
+func (s *Scheduler) Process() lu.Process {
+	getCtx := timeAcquire(s.awaitFunc(cmp.Or(s.opts.role, s.opts.name)), s.opts)
+	schedules := make([]lu.ScheduleInfo, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		schedules = append(schedules, job.runner.info())
+	}
+	return lu.Process{
+		Name:      s.opts.name,
+		Schedules: schedules,
+		Run: func(ctx context.Context) error {
+			for ctx.Err() == nil {
+				err := runWithContext(ctx, getCtx, s.run)
+				if s.opts.isFailure(ctx, err) {
+					return err
+				}
+			}
+			return context.Cause(ctx)
+		},
+	}
+}
+
+// run runs the jobs as they become due until ctx is cancelled
+func (s *Scheduler) run(ctx context.Context) error {
+	if len(s.jobs) == 0 {
+		<-ctx.Done()
+		return context.Cause(ctx)
+	}
+	for ctx.Err() == nil {
+		job := s.nextDue(ctx)
+		if err := lu.WaitUntil(ctx, s.opts.clock, job.due); err != nil {
+			return err
+		}
+		sleep, err := processOnce(ctx, AlwaysRole, job.runner.o, &job.runner)
+		if err != nil {
+			return err
+		}
+		if job.runner.ErrCount > 0 || job.runner.held {
+			// Try the same run again after sleeping, running the other jobs in the meantime
+			job.due = s.opts.clock.Now().Add(sleep)
+		} else {
+			job.runner.at, job.due = time.Time{}, time.Time{}
+		}
+	}
+	return context.Cause(ctx)
+}
+
+// nextDue returns the job which is due to run first
+func (s *Scheduler) nextDue(ctx context.Context) *schedulerJob {
+	var first *schedulerJob
+	for _, job := range s.jobs {
+		if job.due.IsZero() {
+			job.due = job.nextRun(ctx)
+		}
+		if first == nil || job.due.Before(first.due) {
+			first = job
+		}
+	}
+	return first
+}
+
+// nextRun works out the time of the job's next run from its cursor and returns when the job is due.
+// If the cursor can't be read it's due now, so that the error is handled when running the job.
+func (j *schedulerJob) nextRun(ctx context.Context) time.Time {
+	o := j.runner.o
+	last, err := getLastRun(ctx, j.runner.cursor, o.cursorKey())
+	if err != nil {
+		// NoReturnErr: The job will fail to read the cursor again when it's run
+		return o.clock.Now()
+	}
+	// Don't log about skipped runs until the job is run
+	o.logger = lu.DiscardLogger{}
+	j.runner.at = nextExecution(ctx, o.clock.Now(), last, j.runner.when, o)
+	return j.runner.at
+}
@@ -0,0 +1,121 @@
+package process
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/luno/lu"
+	"github.com/luno/lu/test"
+)
+
+// syncCursor is a Cursor which is safe to use from more than one goroutine
+type syncCursor struct {
+	mu sync.Mutex
+	m  memCursor
+}
+
+func (c *syncCursor) Get(ctx context.Context, name string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.m.Get(ctx, name)
+}
+
+func (c *syncCursor) Set(ctx context.Context, name string, value string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.m.Set(ctx, name, value)
+}
+
+func TestScheduler(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cl := clocktesting.NewFakeClock(t0)
+	reg := prometheus.NewRegistry()
+	cursor := &syncCursor{m: make(memCursor)}
+
+	s := NewScheduler(AlwaysRole, cursor,
+		WithClock(cl),
+		WithRegistry(reg),
+		WithLogger(lu.DiscardLogger{}),
+	)
+	hourly := make(chan time.Time, 1)
+	s.Add("hourly", Every(time.Hour), func(_ context.Context, _, runTime time.Time, _ string) error {
+		hourly <- runTime
+		return nil
+	})
+	var failures int
+	s.Add("failing", Every(20*time.Minute), func(context.Context, time.Time, time.Time, string) error {
+		failures++
+		return io.ErrUnexpectedEOF
+	}, WithErrorSleep(time.Hour))
+
+	p := s.Process()
+	assert.Equal(t, "scheduler", p.Name)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- p.Run(ctx) }()
+
+	// The failing job runs at 00:20 and then backs off for an hour
+	test.AdvanceClock(t, cl, 20*time.Minute)
+	test.AdvanceClock(t, cl, 40*time.Minute)
+	assert.Equal(t, t0.Add(time.Hour), <-hourly)
+
+	cancel()
+	jtest.Require(t, context.Canceled, <-done)
+
+	assert.Equal(t, 1, failures)
+	assert.Equal(t, 1.0, testutil.ToFloat64(metricsFor(reg).errors.With(label("failing"))))
+	assert.Equal(t, 0.0, testutil.ToFloat64(metricsFor(reg).errors.With(label("hourly"))))
+	assert.Equal(t, "1704070800", cursor.m["hourly"])
+	assert.Empty(t, cursor.m["failing"])
+}
+
+func TestSchedulerShouldRun(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cl := clocktesting.NewFakeClock(t0)
+	cursor := &syncCursor{m: make(memCursor)}
+
+	s := NewScheduler(AlwaysRole, cursor, WithClock(cl), WithRegistry(prometheus.NewRegistry()))
+	hourly := make(chan time.Time, 1)
+	s.Add("hourly", Every(time.Hour), func(_ context.Context, _, runTime time.Time, _ string) error {
+		hourly <- runTime
+		return nil
+	})
+	s.Add("held", Every(20*time.Minute), func(context.Context, time.Time, time.Time, string) error {
+		t.Error("held job ran")
+		return nil
+	}, WithShouldRun(func(context.Context, time.Time) (bool, error) { return false, nil }))
+
+	p := s.Process()
+	require.Len(t, p.Schedules, 2)
+	assert.Equal(t, "hourly", p.Schedules[0].Name)
+	assert.Equal(t, "held", p.Schedules[1].Name)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- p.Run(ctx) }()
+
+	// The held job is checked again in a minute, the hourly job runs in the meantime
+	test.SetClock(t, cl, t0.Add(30*time.Minute))
+	test.SetClock(t, cl, t0.Add(time.Hour))
+	select {
+	case runTime := <-hourly:
+		assert.Equal(t, t0.Add(time.Hour), runTime)
+	case <-time.After(time.Second):
+		t.Error("hourly job held up")
+	}
+
+	cancel()
+	jtest.Require(t, context.Canceled, <-done)
+	assert.Empty(t, cursor.m["held"])
+}
@@ -0,0 +1,40 @@
+package process
+
+import (
+	"context"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+	"github.com/luno/jettison/log"
+
+	"github.com/luno/lu"
+)
+
+// Sequence is a Process which runs each of the steps one after another, each step starts
+// once the previous one has returned. It stops at the first step which returns an error,
+// returning that error, and it won't start any more steps once ctx has been cancelled.
+// The start and the duration of each step are logged with the Logger of the App.
+// The Process is named "sequence", set Name on the returned Process to change it.
+func Sequence(steps ...lu.ProcessFunc) lu.Process {
+	return lu.Process{
+		Name: "sequence",
+		Run: func(ctx context.Context) error {
+			logger := lu.LoggerFromContext(ctx)
+			for idx, step := range steps {
+				if err := context.Cause(ctx); err != nil {
+					return err
+				}
+				stepCtx := log.ContextWith(ctx, j.MKV{"step": idx + 1, "steps": len(steps)})
+				logger.Info(stepCtx, "Running sequence step", nil)
+				start := time.Now()
+				err := step(stepCtx)
+				logger.Info(stepCtx, "Finished sequence step", map[string]any{"duration": time.Since(start).String()})
+				if err != nil {
+					return errors.Wrap(err, "sequence step", j.KV("step", idx+1))
+				}
+			}
+			return nil
+		},
+	}
+}
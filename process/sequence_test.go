@@ -0,0 +1,65 @@
+package process_test
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/luno/jettison/jtest"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/luno/lu"
+	"github.com/luno/lu/process"
+)
+
+func TestSequence(t *testing.T) {
+	var ran []int
+	step := func(n int, err error) lu.ProcessFunc {
+		return func(ctx context.Context) error {
+			ran = append(ran, n)
+			return err
+		}
+	}
+
+	testCases := []struct {
+		name   string
+		ctx    func() context.Context
+		steps  []lu.ProcessFunc
+		expRan []int
+		expErr error
+	}{
+		{
+			name:   "all steps",
+			steps:  []lu.ProcessFunc{step(1, nil), step(2, nil), step(3, nil)},
+			expRan: []int{1, 2, 3},
+		},
+		{
+			name:   "stops at error",
+			steps:  []lu.ProcessFunc{step(1, nil), step(2, io.ErrUnexpectedEOF), step(3, nil)},
+			expRan: []int{1, 2},
+			expErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name: "cancelled",
+			ctx: func() context.Context {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx
+			},
+			steps:  []lu.ProcessFunc{step(1, nil)},
+			expErr: context.Canceled,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ran = nil
+			ctx := context.Background()
+			if tc.ctx != nil {
+				ctx = tc.ctx()
+			}
+			err := process.Sequence(tc.steps...).Run(ctx)
+			jtest.Require(t, tc.expErr, err)
+			assert.Equal(t, tc.expRan, ran)
+		})
+	}
+}
@@ -28,3 +28,50 @@ func WrapProcessFunc[P Processable](p P) ProcessFunc {
 	}
 	panic("unreachable") // Should never be reached due to constraint
 }
+
+// Runner is the one method that a service passed to ProcessFromService must have, it's used as Process.Run
+type Runner interface {
+	Run(ctx context.Context) error
+}
+
+// Starter is an optional method of a service passed to ProcessFromService, it's used as Process.Start
+type Starter interface {
+	Start(ctx context.Context) error
+}
+
+// Shutdowner is an optional method of a service passed to ProcessFromService, it's used as Process.Shutdown
+type Shutdowner interface {
+	Shutdown(ctx context.Context) error
+}
+
+// Quiescer is an optional method of a service passed to ProcessFromService, it's used as Process.Quiesce
+type Quiescer interface {
+	Quiesce(ctx context.Context) error
+}
+
+// Named is an optional method of a service passed to ProcessFromService, it's used as Process.Name
+type Named interface {
+	Name() string
+}
+
+// ProcessFromService builds a Process from a service which has its lifecycle as methods,
+// so that the service can be added to an App directly.
+// Run is required, Start, Shutdown, Quiesce and Name are optional and are used when s has them,
+// see Starter, Shutdowner, Quiescer and Named.
+func ProcessFromService[S Runner](s S) Process {
+	p := Process{Run: s.Run}
+	var x any = s
+	if st, ok := x.(Starter); ok {
+		p.Start = st.Start
+	}
+	if sh, ok := x.(Shutdowner); ok {
+		p.Shutdown = sh.Shutdown
+	}
+	if q, ok := x.(Quiescer); ok {
+		p.Quiesce = q.Quiesce
+	}
+	if n, ok := x.(Named); ok {
+		p.Name = n.Name()
+	}
+	return p
+}
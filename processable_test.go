@@ -42,3 +42,51 @@ func TestErrorFuncMakeProcessFunc(t *testing.T) {
 	require.NotNil(t, err)
 	require.True(t, called)
 }
+
+type runService struct{}
+
+func (runService) Run(ctx context.Context) error { return nil }
+
+type fullService struct {
+	runService
+	started, stopped, quiesced bool
+}
+
+func (s *fullService) Start(ctx context.Context) error {
+	s.started = true
+	return nil
+}
+
+func (s *fullService) Shutdown(ctx context.Context) error {
+	s.stopped = true
+	return nil
+}
+
+func (s *fullService) Quiesce(ctx context.Context) error {
+	s.quiesced = true
+	return nil
+}
+
+func (s *fullService) Name() string { return "full" }
+
+func TestProcessFromService(t *testing.T) {
+	ctx := context.Background()
+
+	p := ProcessFromService(runService{})
+	require.NotNil(t, p.Run)
+	require.Nil(t, p.Start)
+	require.Nil(t, p.Shutdown)
+	require.Nil(t, p.Quiesce)
+	require.Empty(t, p.Name)
+
+	s := new(fullService)
+	p = ProcessFromService(s)
+	require.Equal(t, "full", p.Name)
+	require.NoError(t, p.Run(ctx))
+	require.NoError(t, p.Start(ctx))
+	require.NoError(t, p.Shutdown(ctx))
+	require.NoError(t, p.Quiesce(ctx))
+	require.True(t, s.started)
+	require.True(t, s.stopped)
+	require.True(t, s.quiesced)
+}
@@ -0,0 +1,267 @@
+package lu
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/j"
+)
+
+// inheritedListenersEnv is set by ReExec to the keys of the listeners handed over to the new copy of the app,
+// separated by commas. The files of the listeners follow stdin, stdout and stderr in the same order.
+const inheritedListenersEnv = "LU_INHERITED_LISTENERS"
+
+// Keys of the files handed over by a graceful restart which aren't listeners
+const (
+	// restartReadyKey is the write end of a pipe which the new copy of the app writes to once it has launched
+	restartReadyKey = "lu/ready"
+	// pidFileKeyPrefix is followed by the path of the process file which is handed over
+	pidFileKeyPrefix = "lu/pidfile:"
+)
+
+var errRestartNotLaunched = errors.New("new copy of the app didn't launch", j.C("ERR_7d24c0e9b1f65a38"))
+
+// RestartFunc starts a new copy of the app for a graceful restart. listeners holds a file for each listener
+// opened with Listen, keyed by its network and address, as well as the files used by the new copy to take over
+// the process file and to report that it has launched. They must all be passed to the new copy, the files are
+// closed once RestartFunc returns.
+type RestartFunc func(ctx context.Context, listeners map[string]*os.File) error
+
+var (
+	listenMu    sync.Mutex
+	inheritOnce sync.Once
+	inherited   map[string]uintptr
+	listeners   = make(map[string]*handoverListener)
+)
+
+// Listen announces on the local network address, see net.ListenConfig.Listen.
+// When the app was started by a graceful restart, the listener for the same network and address which was
+// handed over by the previous copy of the app is used instead. The listener is handed over again when
+// the app is restarted, see App.EnableGracefulRestart.
+func Listen(ctx context.Context, network, addr string) (net.Listener, error) {
+	key := network + "/" + addr
+	listenMu.Lock()
+	defer listenMu.Unlock()
+	ln, err := takeInherited(key)
+	if err != nil {
+		return nil, err
+	}
+	if ln == nil {
+		var lc net.ListenConfig
+		ln, err = lc.Listen(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	l := &handoverListener{Listener: ln, key: key}
+	listeners[key] = l
+	return l, nil
+}
+
+// takeInherited returns the listener handed over for key, or nil if there isn't one, listenMu must be held
+func takeInherited(key string) (net.Listener, error) {
+	f := takeInheritedFile(key)
+	if f == nil {
+		return nil, nil
+	}
+	defer f.Close()
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "inherit listener", j.KS("listener", key))
+	}
+	return ln, nil
+}
+
+// takeInheritedFile returns the file handed over for key, or nil if there isn't one, listenMu must be held
+func takeInheritedFile(key string) *os.File {
+	inheritOnce.Do(func() {
+		inherited = parseInherited(os.Getenv(inheritedListenersEnv))
+	})
+	fd, ok := inherited[key]
+	if !ok {
+		return nil
+	}
+	delete(inherited, key)
+	return os.NewFile(fd, key)
+}
+
+// inheritedFile returns the file handed over for key, which isn't a listener, or nil if there isn't one
+func inheritedFile(key string) *os.File {
+	listenMu.Lock()
+	defer listenMu.Unlock()
+	return takeInheritedFile(key)
+}
+
+func pidFileKey(path string) string {
+	return pidFileKeyPrefix + path
+}
+
+// parseInherited returns the file descriptors of the listeners named in value, as set by ReExec
+func parseInherited(value string) map[string]uintptr {
+	fds := make(map[string]uintptr)
+	if value == "" {
+		return fds
+	}
+	for i, key := range strings.Split(value, ",") {
+		fds[key] = uintptr(3 + i)
+	}
+	return fds
+}
+
+// handoverListener is a listener opened with Listen, it's only handed over whilst it's open
+type handoverListener struct {
+	net.Listener
+	key string
+}
+
+func (l *handoverListener) Close() error {
+	listenMu.Lock()
+	if listeners[l.key] == l {
+		delete(listeners, l.key)
+	}
+	listenMu.Unlock()
+	return l.Listener.Close()
+}
+
+// listenerFiles returns a copy of the file of each open listener, to be passed to the new copy of the app
+func listenerFiles() (map[string]*os.File, error) {
+	listenMu.Lock()
+	defer listenMu.Unlock()
+	files := make(map[string]*os.File, len(listeners))
+	for key, l := range listeners {
+		filer, ok := l.Listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			closeFiles(files)
+			return nil, errors.New("listener can't be handed over", j.KS("listener", key))
+		}
+		f, err := filer.File()
+		if err != nil {
+			closeFiles(files)
+			return nil, errors.Wrap(err, "listener file", j.KS("listener", key))
+		}
+		files[key] = f
+	}
+	return files, nil
+}
+
+func closeFiles(files map[string]*os.File) {
+	for _, f := range files {
+		_ = f.Close()
+	}
+}
+
+// ReExec is the default RestartFunc, it starts the executable of the app again with the same arguments
+// and environment, passing the listeners so that Listen uses them in the new process.
+// It returns once the new process has started, without waiting for it to launch.
+func ReExec(ctx context.Context, listeners map[string]*os.File) error {
+	path, err := os.Executable()
+	if err != nil {
+		return errors.Wrap(err, "find executable")
+	}
+	keys := make([]string, 0, len(listeners))
+	for key := range listeners {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	files := make([]*os.File, 0, len(keys))
+	for _, key := range keys {
+		files = append(files, listeners[key])
+	}
+
+	var env []string
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, inheritedListenersEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+	env = append(env, inheritedListenersEnv+"="+strings.Join(keys, ","))
+
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Env = env
+	cmd.ExtraFiles = files
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Start(); err != nil {
+		return errors.Wrap(err, "start new process", j.KS("path", path))
+	}
+	return cmd.Process.Release()
+}
+
+// restart hands the open listeners, and the process file, over to a new copy of the app using Restart.
+// It waits for the new copy to launch, so that this copy is only stopped once the new one is running.
+func (a *App) restart(ctx context.Context) error {
+	files, err := listenerFiles()
+	if err != nil {
+		return err
+	}
+	defer closeFiles(files)
+	a.Logger.Info(ctx, "restarting app", map[string]any{"listeners": len(files)})
+
+	pidFile, handOver := a.PIDFile.(pidFileHandover)
+	handOver = handOver && a.UseProcessFile
+	if handOver {
+		key, f, err := pidFile.handover()
+		if err != nil {
+			return errors.Wrap(err, "hand over pid file")
+		}
+		files[key] = f
+	}
+
+	ready, w, err := os.Pipe()
+	if err != nil {
+		return errors.Wrap(err, "create restart pipe")
+	}
+	defer ready.Close()
+	files[restartReadyKey] = w
+
+	if err := a.Restart(ctx, files); err != nil {
+		return err
+	}
+	// Close our end so that reading fails if the new copy exits without launching
+	_ = w.Close()
+	if err := waitLaunched(ctx, ready); err != nil {
+		return err
+	}
+	a.pidFileHandedOver.Store(handOver)
+	return nil
+}
+
+// waitLaunched waits for the new copy of the app to write to ready once it has launched,
+// it returns errRestartNotLaunched if the new copy closes it first, e.g. by exiting when Launch fails
+func waitLaunched(ctx context.Context, ready *os.File) error {
+	res := make(chan error, 1)
+	go func() {
+		_, err := ready.Read(make([]byte, 1))
+		res <- err
+	}()
+	err, ctxErr := WaitFor(ctx, res)
+	if ctxErr != nil {
+		return errors.Wrap(ctxErr, "wait for new copy to launch")
+	}
+	if errors.Is(err, io.EOF) {
+		return errRestartNotLaunched
+	} else if err != nil {
+		return errors.Wrap(err, "wait for new copy to launch")
+	}
+	return nil
+}
+
+// notifyLaunched tells the previous copy of the app whether this copy has launched, when it was started by
+// a graceful restart, so that the previous copy carries on running if this one fails to launch
+func notifyLaunched(launched bool) {
+	f := inheritedFile(restartReadyKey)
+	if f == nil {
+		return
+	}
+	defer f.Close()
+	if launched {
+		// NoReturnErr: The previous copy sees the failure when the file is closed
+		_, _ = f.Write([]byte{1})
+	}
+}
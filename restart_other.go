@@ -0,0 +1,8 @@
+//go:build !unix
+
+package lu
+
+import "os"
+
+// restartSignal is nil as there's no SIGUSR2, so graceful restarts aren't supported
+var restartSignal os.Signal
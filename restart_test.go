@@ -0,0 +1,191 @@
+//go:build unix
+
+package lu
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/luno/jettison/errors"
+	"github.com/luno/jettison/jtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppContext_RestartEndsBothContexts(t *testing.T) {
+	ac := newAppContext(context.Background(), JettisonLogger{}, nil, nil, func(ctx context.Context) error {
+		return nil
+	})
+	t.Cleanup(ac.Stop)
+
+	ac.signals <- syscall.SIGUSR2
+
+	assert.Eventually(t, func() bool {
+		return errors.Is(ac.TerminationContext.Err(), context.Canceled)
+	}, time.Second, time.Millisecond)
+	jtest.Assert(t, ErrSignalReceived, context.Cause(ac.AppContext))
+}
+
+func TestAppContext_FailedRestartKeepsRunning(t *testing.T) {
+	restarted := make(chan struct{})
+	ac := newAppContext(context.Background(), JettisonLogger{}, nil, nil, func(ctx context.Context) error {
+		defer close(restarted)
+		return io.ErrUnexpectedEOF
+	})
+	t.Cleanup(ac.Stop)
+
+	ac.signals <- syscall.SIGUSR2
+	<-restarted
+
+	// Check that the contexts aren't cancelled after the restart fails
+	time.Sleep(10 * time.Millisecond)
+	jtest.RequireNil(t, ac.AppContext.Err())
+	jtest.RequireNil(t, ac.TerminationContext.Err())
+}
+
+func TestParseInherited(t *testing.T) {
+	assert.Empty(t, parseInherited(""))
+
+	assert.Equal(t, map[string]uintptr{
+		"tcp/:http":  3,
+		"tcp/:https": 4,
+	}, parseInherited("tcp/:http,tcp/:https"))
+}
+
+func TestListenHandover(t *testing.T) {
+	ctx := context.Background()
+	ln, err := Listen(ctx, "tcp", "127.0.0.1:0")
+	jtest.RequireNil(t, err)
+	addr := ln.Addr().String()
+
+	var handedOver map[string]uintptr
+	a := App{
+		Logger: DiscardLogger{},
+		Restart: copyFiles(func(files map[string]uintptr) {
+			handedOver = files
+			ready := os.NewFile(files[restartReadyKey], restartReadyKey)
+			defer ready.Close()
+			_, _ = ready.Write([]byte{1})
+		}),
+	}
+	jtest.RequireNil(t, a.restart(ctx))
+	require.Contains(t, handedOver, "tcp/127.0.0.1:0")
+
+	// Closing the listener stops it being handed over
+	jtest.RequireNil(t, ln.Close())
+	files, err := listenerFiles()
+	jtest.RequireNil(t, err)
+	assert.NotContains(t, files, "tcp/127.0.0.1:0")
+
+	// Listen uses the handed over listener rather than binding a new port
+	listenMu.Lock()
+	inheritOnce.Do(func() {})
+	inherited = handedOver
+	listenMu.Unlock()
+
+	ln, err = Listen(ctx, "tcp", "127.0.0.1:0")
+	jtest.RequireNil(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+	assert.Equal(t, addr, ln.Addr().String())
+
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			_ = conn.Close()
+		}
+	}()
+	conn, err := net.Dial("tcp", addr)
+	jtest.RequireNil(t, err)
+	jtest.RequireNil(t, conn.Close())
+}
+
+func TestRestartHandsOverPIDFile(t *testing.T) {
+	testCases := []struct {
+		name    string
+		pidFile func(path string) PIDFile
+	}{
+		{name: "exclusive", pidFile: func(path string) PIDFile { return ExclusivePIDFile{Path: path} }},
+		{name: "flock", pidFile: func(path string) PIDFile { return &FlockPIDFile{Path: path} }},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "lu.pid")
+			a := App{
+				Logger:         DiscardLogger{},
+				UseProcessFile: true,
+				PIDFile:        tc.pidFile(path),
+			}
+			jtest.RequireNil(t, a.PIDFile.Create())
+
+			// The new copy takes over the file whilst this one is still running, then reports that it's launched
+			next := tc.pidFile(path)
+			a.Restart = copyFiles(func(files map[string]uintptr) {
+				inheritFiles(files)
+				go func() {
+					time.Sleep(10 * time.Millisecond)
+					jtest.RequireNil(t, next.Create())
+					notifyLaunched(true)
+				}()
+			})
+			jtest.RequireNil(t, a.restart(context.Background()))
+
+			a.cleanup(context.Background())
+			_, err := os.Stat(path)
+			jtest.RequireNil(t, err)
+
+			jtest.RequireNil(t, next.Remove())
+			_, err = os.Stat(path)
+			jtest.Assert(t, os.ErrNotExist, err)
+		})
+	}
+}
+
+func TestRestartNotLaunched(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lu.pid")
+	a := App{
+		Logger:         DiscardLogger{},
+		UseProcessFile: true,
+		PIDFile:        ExclusivePIDFile{Path: path},
+		Restart: copyFiles(func(files map[string]uintptr) {
+			inheritFiles(files)
+			notifyLaunched(false)
+		}),
+	}
+	jtest.RequireNil(t, a.PIDFile.Create())
+	jtest.Assert(t, errRestartNotLaunched, a.restart(context.Background()))
+
+	// Not handed over, so it's removed as usual
+	a.cleanup(context.Background())
+	_, err := os.Stat(path)
+	jtest.Assert(t, os.ErrNotExist, err)
+}
+
+// copyFiles returns a RestartFunc which calls f with copies of the files handed over, as a new process would get
+func copyFiles(f func(files map[string]uintptr)) RestartFunc {
+	return func(ctx context.Context, files map[string]*os.File) error {
+		fds := make(map[string]uintptr)
+		for key, file := range files {
+			fd, err := syscall.Dup(int(file.Fd()))
+			if err != nil {
+				return err
+			}
+			fds[key] = uintptr(fd)
+		}
+		f(fds)
+		return nil
+	}
+}
+
+// inheritFiles makes the files available as if they were handed over to this process
+func inheritFiles(files map[string]uintptr) {
+	listenMu.Lock()
+	defer listenMu.Unlock()
+	inheritOnce.Do(func() {})
+	inherited = files
+}
@@ -0,0 +1,11 @@
+//go:build unix
+
+package lu
+
+import (
+	"os"
+	"syscall"
+)
+
+// restartSignal starts a graceful restart when App.EnableGracefulRestart is set
+var restartSignal os.Signal = syscall.SIGUSR2
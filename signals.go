@@ -2,14 +2,17 @@ package lu
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 
+	"github.com/luno/jettison/errors"
 	"github.com/luno/jettison/j"
-	"github.com/luno/jettison/log"
 )
 
+var errSignalPanicked = errors.New("panicked handling OS signal", j.C("ERR_3c9e1b74f0a2d586"))
+
 // AppContext manages two contexts for running an app. It responds to different signals by
 // cancelling one or both of these contexts. This behaviour allows us to do graceful shutdown
 // in kubernetes using a stop script. If the application terminates before the stop script finishes
@@ -23,42 +26,97 @@ import (
 //
 // For SIGQUIT, we cancel just the AppContext, the application should shut down all
 // processes and wait for termination.
+//
+// For SIGHUP, when the App has reload hooks, we run them without cancelling either context.
+//
+// For SIGUSR2, when the App has EnableGracefulRestart set, we start a new copy of the app and
+// then cancel both contexts, see App.EnableGracefulRestart.
+//
+// When the App has a PreShutdownDelay, SIGTERM waits for the delay before cancelling both contexts,
+// a SIGINT or SIGTERM received during the delay cancels them straight away.
 type AppContext struct {
-	signals chan os.Signal
+	signals         chan os.Signal
+	logger          Logger
+	onReload        func(ctx context.Context)
+	beforeTerminate func(ctx context.Context)
+	onRestart       func(ctx context.Context) error
 
 	// AppContext should be used for running the application.
 	// When it's cancelled, the application should stop running all processes.
 	AppContext context.Context
-	appCancel  context.CancelFunc
+	appCancel  context.CancelCauseFunc
 
 	// TerminationContext should be used for the execution of application.
 	// When it's cancelled the application binary should terminate.
 	// AppContext will be cancelled with this context as well.
 	TerminationContext context.Context
-	termCancel         context.CancelFunc
+	termCancel         context.CancelCauseFunc
 }
 
 func NewAppContext(ctx context.Context) AppContext {
+	return newAppContext(ctx, JettisonLogger{}, nil, nil, nil)
+}
+
+// newAppContext creates an AppContext which will call onReload when receiving SIGHUP,
+// SIGHUP is left with its default behaviour when onReload is nil.
+// When beforeTerminate is not nil, it's called on receiving SIGTERM before cancelling the contexts.
+// When onRestart is not nil, it's called on receiving SIGUSR2 and the contexts are cancelled if it succeeds.
+func newAppContext(
+	ctx context.Context,
+	logger Logger,
+	onReload func(ctx context.Context),
+	beforeTerminate func(ctx context.Context),
+	onRestart func(ctx context.Context) error,
+) AppContext {
 	c := AppContext{
-		signals: make(chan os.Signal, 1),
+		signals:         make(chan os.Signal, 1),
+		logger:          logger,
+		onReload:        onReload,
+		beforeTerminate: beforeTerminate,
+		onRestart:       onRestart,
 	}
 
-	c.TerminationContext, c.termCancel = context.WithCancel(ctx)
-	c.AppContext, c.appCancel = context.WithCancel(c.TerminationContext)
+	c.TerminationContext, c.termCancel = context.WithCancelCause(ctx)
+	c.AppContext, c.appCancel = context.WithCancelCause(c.TerminationContext)
+	c.AppContext = withTerminationContext(c.AppContext, c.TerminationContext)
 
-	signal.Notify(c.signals, syscall.SIGQUIT, syscall.SIGINT, syscall.SIGTERM)
+	sigs := []os.Signal{syscall.SIGQUIT, syscall.SIGINT, syscall.SIGTERM}
+	if onReload != nil {
+		sigs = append(sigs, syscall.SIGHUP)
+	}
+	if onRestart != nil && restartSignal != nil {
+		sigs = append(sigs, restartSignal)
+	}
+	signal.Notify(c.signals, sigs...)
 
 	go c.monitor(ctx)
 
 	return c
 }
 
+type terminationKey struct{}
+
+func withTerminationContext(ctx, termCtx context.Context) context.Context {
+	return context.WithValue(ctx, terminationKey{}, termCtx)
+}
+
+// TerminationContext returns the TerminationContext of the AppContext which ctx is derived from,
+// e.g. in a Process started by App.Run. It can be used to carry on working after SIGQUIT, until the
+// app is terminated. When ctx isn't derived from an AppContext then ctx is returned.
+func TerminationContext(ctx context.Context) context.Context {
+	if termCtx, ok := ctx.Value(terminationKey{}).(context.Context); ok {
+		return termCtx
+	}
+	return ctx
+}
+
 func (c AppContext) Stop() {
 	signal.Stop(c.signals)
 	close(c.signals)
 }
 
 func (c AppContext) monitor(ctx context.Context) {
+	var terminating bool
 	for {
 		select {
 		case <-ctx.Done():
@@ -67,18 +125,91 @@ func (c AppContext) monitor(ctx context.Context) {
 			if !ok {
 				return
 			}
-			call, ok := s.(syscall.Signal)
-			if !ok {
-				log.Info(ctx, "received unknown OS signal", j.KV("signal", s))
-				continue
-			}
-			log.Info(ctx, "received OS signal", j.KV("signal", call))
-			switch call {
-			case syscall.SIGQUIT:
-				c.appCancel()
-			case syscall.SIGINT, syscall.SIGTERM:
-				c.termCancel()
-			}
+			c.handleSignal(ctx, s, &terminating)
 		}
 	}
 }
+
+// handleSignal responds to s and then logs it, so that the app can still be stopped when the logger panics.
+// It recovers from a panic so that later signals are still handled.
+func (c AppContext) handleSignal(ctx context.Context, s os.Signal, terminating *bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.logPanic(ctx, s, r)
+		}
+	}()
+
+	if !c.respond(ctx, s, terminating) {
+		c.logger.Info(ctx, "received unknown OS signal", map[string]any{"signal": s})
+		return
+	}
+	c.logger.Info(ctx, "received OS signal", map[string]any{"signal": s})
+}
+
+// respond acts on s, it returns false if s isn't a signal that it knows about
+func (c AppContext) respond(ctx context.Context, s os.Signal, terminating *bool) bool {
+	cause := errors.Wrap(ErrSignalReceived, "", j.KV("signal", s.String()))
+	if s == restartSignal && c.onRestart != nil {
+		// Keep handling signals while the new copy of the app starts
+		c.goRecover(ctx, s, func() { c.restart(cause) })
+		return true
+	}
+	call, ok := s.(syscall.Signal)
+	if !ok {
+		return false
+	}
+	switch call {
+	case syscall.SIGQUIT:
+		c.appCancel(cause)
+	case syscall.SIGTERM:
+		if c.beforeTerminate == nil || *terminating {
+			c.termCancel(cause)
+			return true
+		}
+		*terminating = true
+		// Keep handling signals so that we can still be stopped during the delay
+		c.goRecover(ctx, s, func() {
+			defer c.termCancel(cause)
+			c.beforeTerminate(c.TerminationContext)
+		})
+	case syscall.SIGINT:
+		c.termCancel(cause)
+	case syscall.SIGHUP:
+		if c.onReload != nil {
+			// Don't block handling other signals whilst reloading
+			c.goRecover(ctx, s, func() { c.onReload(c.AppContext) })
+		}
+	}
+	return true
+}
+
+// goRecover calls f in a new goroutine, logging a panic from f rather than crashing the app
+func (c AppContext) goRecover(ctx context.Context, s os.Signal, f func()) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				c.logPanic(ctx, s, r)
+			}
+		}()
+		f()
+	}()
+}
+
+// logPanic logs r, the panic from handling s, ignoring the logger panicking again
+func (c AppContext) logPanic(ctx context.Context, s os.Signal, r any) {
+	defer func() {
+		// NoReturnErr: Nothing else to report it to
+		_ = recover()
+	}()
+	c.logger.Error(ctx, errors.Wrap(errSignalPanicked, "", j.MKV{"signal": s.String(), "panic": fmt.Sprint(r)}))
+}
+
+// restart calls onRestart and then cancels both contexts with cause, leaving the app running if it fails
+func (c AppContext) restart(cause error) {
+	if err := c.onRestart(c.AppContext); err != nil {
+		// NoReturnErr: Carry on running as we are
+		c.logger.Error(c.AppContext, errors.Wrap(err, "graceful restart"))
+		return
+	}
+	c.termCancel(cause)
+}
@@ -2,6 +2,7 @@ package lu
 
 import (
 	"context"
+	"sync/atomic"
 	"syscall"
 	"testing"
 	"time"
@@ -26,6 +27,18 @@ func TestAppContext_QuitOnlyEndsTheAppContext(t *testing.T) {
 	}, time.Second, time.Millisecond)
 }
 
+func TestTerminationContext(t *testing.T) {
+	ac := NewAppContext(context.Background())
+	t.Cleanup(ac.Stop)
+
+	ctx, cancel := context.WithCancel(ac.AppContext)
+	t.Cleanup(cancel)
+	assert.Equal(t, ac.TerminationContext, TerminationContext(ctx))
+
+	other := context.Background()
+	assert.Equal(t, other, TerminationContext(other))
+}
+
 func TestAppContext_IntEndsBothContexts(t *testing.T) {
 	ac := NewAppContext(context.Background())
 	t.Cleanup(ac.Stop)
@@ -41,6 +54,21 @@ func TestAppContext_IntEndsBothContexts(t *testing.T) {
 	}, time.Second, time.Millisecond)
 }
 
+func TestAppContext_SignalCause(t *testing.T) {
+	ac := NewAppContext(context.Background())
+	t.Cleanup(ac.Stop)
+
+	ac.signals <- syscall.SIGTERM
+
+	assert.Eventually(t, func() bool {
+		return ac.AppContext.Err() != nil
+	}, time.Second, time.Millisecond)
+
+	cause := context.Cause(ac.AppContext)
+	jtest.Assert(t, ErrSignalReceived, cause)
+	jtest.Assert(t, context.Canceled, cause)
+}
+
 func TestAppContext_QuitThenTerminate(t *testing.T) {
 	// This is the sequence of signals we will receive in kubernetes (when using the stop script)
 	ac := NewAppContext(context.Background())
@@ -80,9 +108,140 @@ func TestAppContext_CancelledContext(t *testing.T) {
 	ac := NewAppContext(context.Background())
 	t.Cleanup(ac.Stop)
 
-	ac.appCancel()
+	ac.appCancel(nil)
+
+	assert.Eventually(t, func() bool {
+		return errors.Is(ac.AppContext.Err(), context.Canceled)
+	}, time.Second, time.Millisecond)
+}
+
+func TestAppContext_HangUpReloads(t *testing.T) {
+	reloaded := make(chan struct{})
+	ac := newAppContext(context.Background(), JettisonLogger{}, func(ctx context.Context) {
+		close(reloaded)
+	}, nil, nil)
+	t.Cleanup(ac.Stop)
+
+	ac.signals <- syscall.SIGHUP
+
+	select {
+	case <-reloaded:
+	case <-time.After(time.Second):
+		assert.Fail(t, "timeout waiting for reload")
+	}
+
+	jtest.AssertNil(t, ac.AppContext.Err())
+	jtest.AssertNil(t, ac.TerminationContext.Err())
+}
+
+func TestAppContext_TerminateWaitsBeforeCancelling(t *testing.T) {
+	release := make(chan struct{})
+	ac := newAppContext(context.Background(), JettisonLogger{}, nil, func(ctx context.Context) {
+		_, _ = WaitFor(ctx, release)
+	}, nil)
+	t.Cleanup(ac.Stop)
+
+	ac.signals <- syscall.SIGTERM
+
+	assert.Never(t, func() bool {
+		return ac.AppContext.Err() != nil
+	}, 100*time.Millisecond, time.Millisecond)
+
+	close(release)
+
+	assert.Eventually(t, func() bool {
+		return errors.Is(ac.AppContext.Err(), context.Canceled)
+	}, time.Second, time.Millisecond)
+	assert.Eventually(t, func() bool {
+		return errors.Is(ac.TerminationContext.Err(), context.Canceled)
+	}, time.Second, time.Millisecond)
+}
+
+func TestAppContext_InterruptDuringDelay(t *testing.T) {
+	ac := newAppContext(context.Background(), JettisonLogger{}, nil, func(ctx context.Context) {
+		<-ctx.Done()
+	}, nil)
+	t.Cleanup(ac.Stop)
+
+	ac.signals <- syscall.SIGTERM
+	ac.signals <- syscall.SIGINT
+
+	assert.Eventually(t, func() bool {
+		return errors.Is(ac.TerminationContext.Err(), context.Canceled)
+	}, time.Second, time.Millisecond)
+}
+
+// panicLogger panics in Info until it has panicked the number of times in panics
+type panicLogger struct {
+	DiscardLogger
+	panics atomic.Int32
+}
+
+func (l *panicLogger) Info(context.Context, string, map[string]any) {
+	if l.panics.Add(-1) >= 0 {
+		panic("log sink failed")
+	}
+}
+
+func TestAppContext_SurvivesPanic(t *testing.T) {
+	l := new(panicLogger)
+	l.panics.Store(1)
+	ac := newAppContext(context.Background(), l, func(ctx context.Context) {}, nil, nil)
+	t.Cleanup(ac.Stop)
+
+	ac.signals <- syscall.SIGHUP
+	ac.signals <- syscall.SIGQUIT
 
 	assert.Eventually(t, func() bool {
 		return errors.Is(ac.AppContext.Err(), context.Canceled)
 	}, time.Second, time.Millisecond)
+	jtest.AssertNil(t, ac.TerminationContext.Err())
+}
+
+func TestAppContext_TerminatesAfterPanic(t *testing.T) {
+	l := new(panicLogger)
+	l.panics.Store(100)
+	ac := newAppContext(context.Background(), l, nil, nil, nil)
+	t.Cleanup(ac.Stop)
+
+	ac.signals <- syscall.SIGTERM
+
+	assert.Eventually(t, func() bool {
+		return errors.Is(context.Cause(ac.TerminationContext), ErrSignalReceived)
+	}, time.Second, time.Millisecond)
+}
+
+func TestAppContext_ActsBeforeLogging(t *testing.T) {
+	l := new(panicLogger)
+	l.panics.Store(100)
+
+	var drained atomic.Bool
+	ac := newAppContext(context.Background(), l, nil, func(context.Context) { drained.Store(true) }, nil)
+	t.Cleanup(ac.Stop)
+
+	ac.signals <- syscall.SIGQUIT
+	assert.Eventually(t, func() bool {
+		return errors.Is(context.Cause(ac.AppContext), ErrSignalReceived)
+	}, time.Second, time.Millisecond)
+	jtest.AssertNil(t, ac.TerminationContext.Err())
+
+	ac.signals <- syscall.SIGTERM
+	assert.Eventually(t, func() bool {
+		return errors.Is(context.Cause(ac.TerminationContext), ErrSignalReceived)
+	}, time.Second, time.Millisecond)
+	assert.True(t, drained.Load())
+}
+
+func TestAppContext_SurvivesReloadPanic(t *testing.T) {
+	ac := newAppContext(context.Background(), DiscardLogger{}, func(context.Context) {
+		panic("reload failed")
+	}, nil, nil)
+	t.Cleanup(ac.Stop)
+
+	ac.signals <- syscall.SIGHUP
+	ac.signals <- syscall.SIGINT
+
+	assert.Eventually(t, func() bool {
+		return errors.Is(ac.TerminationContext.Err(), context.Canceled)
+	}, time.Second, time.Millisecond)
 }
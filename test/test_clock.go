@@ -0,0 +1,38 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+// Only for testing purposes - do not import into main code builds
+
+// AdvanceClock waits until something is waiting on clock, e.g. a process.Scheduled using process.WithClock
+// which is waiting for its next run, then steps clock forward by d.
+// It can be called in a goroutine, the test fails if nothing waits on clock within a second.
+func AdvanceClock(t testing.TB, clock *clocktesting.FakeClock, d time.Duration) {
+	if awaitWaiters(t, clock) {
+		clock.Step(d)
+	}
+}
+
+// SetClock waits until something is waiting on clock, in the same way as AdvanceClock, then sets clock to ti.
+func SetClock(t testing.TB, clock *clocktesting.FakeClock, ti time.Time) {
+	if awaitWaiters(t, clock) {
+		clock.SetTime(ti)
+	}
+}
+
+func awaitWaiters(t testing.TB, clock *clocktesting.FakeClock) bool {
+	deadline := time.Now().Add(time.Second)
+	for !clock.HasWaiters() {
+		if time.Now().After(deadline) {
+			t.Errorf("nothing is waiting on the clock")
+			return false
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return true
+}
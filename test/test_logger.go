@@ -0,0 +1,41 @@
+package test
+
+import (
+	"context"
+	"sync"
+)
+
+// Only for testing purposes - do not import into main code builds
+
+// Logger is a lu.Logger which records everything that's logged to it
+type Logger struct {
+	mu     sync.Mutex
+	infos  []string
+	errors []error
+}
+
+func (l *Logger) Info(_ context.Context, msg string, _ map[string]any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.infos = append(l.infos, msg)
+}
+
+func (l *Logger) Error(_ context.Context, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errors = append(l.errors, err)
+}
+
+// Infos returns the messages logged with Info so far
+func (l *Logger) Infos() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.infos...)
+}
+
+// Errors returns the errors logged with Error so far
+func (l *Logger) Errors() []error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]error(nil), l.errors...)
+}
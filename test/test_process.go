@@ -0,0 +1,50 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/luno/lu"
+)
+
+// Only for testing purposes - do not import into main code builds
+
+// AssertStopsWithin runs p, cancels its context straight away, and fails the test if Run doesn't return within d.
+// It returns the error from Run, or nil if Run didn't return in time.
+func AssertStopsWithin(t testing.TB, p lu.Process, d time.Duration) error {
+	t.Helper()
+	return AssertStopsWithinAfter(t, p, nil, d)
+}
+
+// AssertStopsWithinAfter runs p and waits for started to be closed, or receive a value, e.g. once p is part way
+// through its work, then cancels the context of p and fails the test if Run doesn't return within d.
+// The test also fails if started isn't ready within d, a nil started doesn't wait. It returns the error from Run, or nil if Run didn't return in time.
+func AssertStopsWithinAfter(t testing.TB, p lu.Process, started <-chan struct{}, d time.Duration) error {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- p.Run(ctx) }()
+
+	if started != nil {
+		select {
+		case <-started:
+		case err := <-done:
+			t.Errorf("process %q returned before it was cancelled: %v", p.Name, err)
+			return err
+		case <-time.After(d):
+			t.Errorf("process %q didn't start within %v", p.Name, d)
+			return nil
+		}
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(d):
+		t.Errorf("process %q didn't stop within %v of being cancelled", p.Name, d)
+		return nil
+	}
+}